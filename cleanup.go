@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var (
+	cleanupMu sync.Mutex
+	cleanups  []func()
+)
+
+// onExit registers a function to run before watchfor exits, including when it
+// is interrupted by SIGINT or SIGTERM. Functions run in reverse order.
+func onExit(fn func()) {
+	cleanupMu.Lock()
+	defer cleanupMu.Unlock()
+
+	if cleanups == nil {
+		go handleSignals()
+	}
+	cleanups = append(cleanups, fn)
+}
+
+// runCleanups runs and clears the registered functions.
+func runCleanups() {
+	cleanupMu.Lock()
+	fns := cleanups
+	cleanups = []func(){}
+	cleanupMu.Unlock()
+
+	for i := len(fns) - 1; i >= 0; i-- {
+		fns[i]()
+	}
+}
+
+// exit runs the registered functions and exits with the given code.
+func exit(code int) {
+	runCleanups()
+	os.Exit(code)
+}
+
+func handleSignals() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	sig := <-sigs
+	// Follow the shell convention of 128 + signal number.
+	exit(128 + int(sig.(syscall.Signal)))
+}
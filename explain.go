@@ -0,0 +1,407 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/gregory-chatelier/watchfor/pkg/poller"
+)
+
+// maxExplainedWaits limits how much of the poll schedule --explain prints.
+const maxExplainedWaits = 10
+
+// explain prints the effective configuration and the resulting poll schedule.
+func explain(extraPatterns []string, successCommand string) {
+	fmt.Println("Effective configuration:")
+	if len(configFiles) > 0 {
+		fmt.Printf("  Config files:   %s\n", strings.Join(configFiles, ", "))
+	}
+	switch {
+	case len(*commands) > 0 && *ptyMode:
+		fmt.Printf("  Source:         command %q (under a pseudo-terminal)\n", (*commands)[0])
+	case len(*commands) == 1 && *commandInput != "":
+		fmt.Printf("  Source:         command %q, reading %s on stdin\n", (*commands)[0], *commandInput)
+	case len(*commands) == 1:
+		fmt.Printf("  Source:         command %q\n", (*commands)[0])
+	case len(*commands) > 1:
+		order := ""
+		if *shuffleSources {
+			order = ", started in a random order"
+		}
+		fmt.Printf("  Source:         commands %q, combined (%d at a time%s)\n", *commands, *maxParallel, order)
+	case *fifo != "":
+		fmt.Printf("  Source:         named pipe %q\n", *fifo)
+	case *watchDir != "":
+		fmt.Printf("  Source:         new files matching %q in %q\n", *glob, *watchDir)
+	case *source != "":
+		fmt.Printf("  Source:         %s\n", *source)
+	case *waitsFile != "":
+		fmt.Printf("  Source:         %s\n", describeWaits())
+	case *pid != 0:
+		fmt.Printf("  Source:         usage of process %d", *pid)
+		if *cpuBelow > 0 {
+			fmt.Printf(", cpu below %g%%", *cpuBelow)
+		}
+		if *memBelow > 0 {
+			fmt.Printf(", memory below %d MiB", *memBelow)
+		}
+		fmt.Println()
+	case *unit != "":
+		fmt.Printf("  Source:         journal of unit %q (new entries only)\n", *unit)
+	case *tlsCert != "" && *minDaysLeft > 0:
+		fmt.Printf("  Source:         TLS certificate of %s, ready with at least %d days left\n", *tlsCert, *minDaysLeft)
+	case *tlsCert != "":
+		fmt.Printf("  Source:         TLS certificate of %s\n", *tlsCert)
+	case *redisAddr != "" && *redisChannel != "":
+		fmt.Printf("  Source:         messages on Redis channel %q at %s\n", *redisChannel, *redisAddr)
+	case *redisAddr != "":
+		fmt.Printf("  Source:         Redis key %q at %s\n", *redisKey, *redisAddr)
+	case *listenAddr != "":
+		fmt.Printf("  Source:         HTTP requests to %s on %s, checked as they arrive\n", *listenPath, *listenAddr)
+	case *waitUnlock != "":
+		fmt.Printf("  Source:         lock on %q, free or held by another process\n", *waitUnlock)
+	case *mqttBroker != "":
+		fmt.Printf("  Source:         messages on MQTT topic %q at %s (QoS %d)\n", *mqttTopic, *mqttBroker, *mqttQoS)
+	case *completeLines:
+		fmt.Printf("  Source:         file %q (new complete lines only)\n", *file)
+	default:
+		fmt.Printf("  Source:         file %q (new content only)\n", *file)
+	}
+	if *stdoutOnly {
+		fmt.Println("  Stderr:         not matched, shown with --verbose")
+	}
+	if *passthrough {
+		fmt.Printf("  Passthrough:    raw output printed, lines prefixed with %q\n", *passPrefix)
+	}
+	if *annotate {
+		fmt.Println("  Annotate:       printed output lines prefixed with [attempt=N t=HH:MM:SS]")
+	}
+	if *dedupLog {
+		fmt.Println("  Dedup log:      repeated printed output lines collapsed into one with (xN)")
+	}
+	if *normNewlines {
+		fmt.Println("  Newlines:       CRLF and CR converted to LF")
+	}
+	if *decode != "" {
+		fmt.Printf("  Decode:         %s\n", *decode)
+	}
+	if *transformCmd != "" {
+		fmt.Printf("  Transform:      %s\n", *transformCmd)
+	}
+	if *since != "" {
+		fmt.Printf("  Since:          %s", *since)
+		if *dropUntimed {
+			fmt.Print(" (dropping lines without a timestamp)")
+		}
+		fmt.Println()
+	}
+	for _, expr := range *normalize {
+		fmt.Printf("  Normalize:      %s\n", expr)
+	}
+	if *lineRange != "" {
+		fmt.Printf("  Line range:     %s\n", *lineRange)
+	}
+	if len(*between) == 2 {
+		fmt.Printf("  Region:         between %q and %q\n", (*between)[0], (*between)[1])
+	}
+	if *diffOnly {
+		fmt.Println("  Diff only:      lines new since the previous output")
+	}
+	if *jsonSchema != "" {
+		fmt.Printf("  Schema:         JSON valid against %s\n", *jsonSchema)
+	}
+	if *waitsFile != "" {
+		fmt.Println("  Matcher:        the pattern of each wait")
+	} else if *equalsEnv != "" {
+		fmt.Printf("  Matcher:        equals $%s", *equalsEnv)
+		if *ignoreCase {
+			fmt.Print(", ignore case")
+		}
+		fmt.Println()
+	} else if *jsonLogField != "" {
+		if *jsonLogText == "" {
+			fmt.Printf("  Matcher:        JSON log entries with field %s", *jsonLogField)
+		} else {
+			fmt.Printf("  Matcher:        JSON log field %s containing %q", *jsonLogField, *jsonLogText)
+		}
+		if *ignoreCase {
+			fmt.Print(", ignore case")
+		}
+		fmt.Println()
+	} else if *xpathExpr != "" {
+		fmt.Printf("  Matcher:        xpath %q", *xpathExpr)
+		if *xpathEquals != "" {
+			fmt.Printf(" equals %q", *xpathEquals)
+		}
+		fmt.Println()
+	} else {
+		mode := "substring"
+		if *regex {
+			mode = "regex"
+		}
+		if *fuzzy {
+			mode = fmt.Sprintf("fuzzy (at most %d edits)", *maxDistance)
+		}
+		if *ignoreCase {
+			mode += ", ignore case"
+		}
+		if *regexDotAll {
+			mode += ", dot matches newline"
+		}
+		if *regexMultiline {
+			mode += ", multiline anchors"
+		}
+		patterns := extraPatterns
+		if *pattern != "" {
+			patterns = append([]string{*pattern}, extraPatterns...)
+		}
+		switch len(patterns) {
+		case 0:
+			if *listenAddr != "" && *jsonSchema == "" {
+				fmt.Println("  Matcher:        any request")
+			} else if *jsonSchema == "" {
+				fmt.Println("  Matcher:        any output")
+			}
+		case 1:
+			fmt.Printf("  Matcher:        %s %q\n", mode, patterns[0])
+		default:
+			quantifier := "any of"
+			if *matchAll {
+				quantifier = "all of"
+			}
+			fmt.Printf("  Matcher:        %s, %s %q\n", mode, quantifier, patterns)
+		}
+	}
+	if *minCount > 0 {
+		fmt.Printf("  Count:          %d occurrences\n", *minCount)
+	}
+	if *minDistinct > 0 {
+		fmt.Printf("  Lines:          %d distinct matching lines\n", *minDistinct)
+	}
+	if *skipUnchanged {
+		fmt.Println("  Unchanged:      output identical to the last one is not matched again")
+	}
+	if *stableOutput > 0 {
+		fmt.Printf("  Stable:         same output for %d checks in a row\n", *stableOutput)
+	}
+	if *matchTimeout > 0 {
+		fmt.Printf("  Match timeout:  %s\n", *matchTimeout)
+	}
+	if *matchHistory {
+		fmt.Printf("  History:        last %d distinct outputs", *historySize)
+		if *maxAccumulate > 0 {
+			fmt.Printf(", at most %d bytes", *maxAccumulate)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("  Interval:       %s\n", *interval)
+	fmt.Printf("  Backoff:        %g", *backoff)
+	if *backoffMode == "anchored" {
+		fmt.Print(", anchored to the previous delay")
+	}
+	if *maxDelay > 0 {
+		fmt.Printf(", up to %s", *maxDelay)
+	}
+	fmt.Println()
+	fmt.Printf("  Jitter:         %g\n", *jitter)
+	if *progressRe != "" {
+		fmt.Printf("  Adaptive:       %s to %s as %q reports 0-100%%\n", *interval, *minInterval, *progressRe)
+	}
+	if *maxRetries > 0 {
+		fmt.Printf("  Max retries:    %d\n", *maxRetries)
+	} else {
+		fmt.Println("  Max retries:    unlimited")
+	}
+	if *timeout > 0 {
+		fmt.Printf("  Timeout:        %s", *timeout)
+		if *timeoutGrace > 0 {
+			fmt.Printf(", plus %s for a check in progress", *timeoutGrace)
+		}
+		if *finalCheck {
+			fmt.Print(", then a final check")
+		}
+		fmt.Println()
+	} else {
+		fmt.Println("  Timeout:        none")
+	}
+	if len(*abortExit) > 0 {
+		fmt.Printf("  Abort on exit:  %s\n", joinCodes(*abortExit))
+	}
+	abortTypes := poller.DefaultAbortTypes()
+	if pflag.CommandLine.Changed("abort-on-error-type") {
+		abortTypes = *abortOnErr
+	}
+	fmt.Printf("  Abort on error: %s\n", strings.Join(abortTypes, ", "))
+	if *maxWaitTotal > 0 {
+		fmt.Printf("  Wait budget:    %s of waits between checks\n", *maxWaitTotal)
+	}
+	if *maxEmpty > 0 {
+		fmt.Printf("  Max empty:      %d checks in a row\n", *maxEmpty)
+	}
+	if *patternTimeout > 0 {
+		fmt.Printf("  Match window:   %s from the first output\n", *patternTimeout)
+	}
+	if *triggerFile != "" {
+		fmt.Printf("  Trigger file:   %s\n", *triggerFile)
+	}
+	if *envFile != "" {
+		fmt.Printf("  Env file:       %s\n", *envFile)
+	}
+	for _, kv := range *envVars {
+		key, _, _ := strings.Cut(kv, "=")
+		fmt.Printf("  Env:            %s\n", key)
+	}
+	if *settle > 0 {
+		fmt.Printf("  Settle:         %s after a match\n", *settle)
+	}
+	if *minElapsed > 0 {
+		fmt.Printf("  Min elapsed:    %s from the start\n", *minElapsed)
+	}
+	if *setupCommand != "" {
+		fmt.Printf("  Setup:          %s\n", *setupCommand)
+	}
+	if *probeCommand != "" {
+		fmt.Printf("  Probe:          %s\n", *probeCommand)
+	}
+	if *heartbeatFile != "" {
+		fmt.Printf("  Heartbeat file: %s\n", *heartbeatFile)
+	}
+	if *onMatch != "" {
+		fmt.Printf("  On match:       %s\n", *onMatch)
+	}
+	if *pidFile != "" {
+		fmt.Printf("  PID file:       %s\n", *pidFile)
+	}
+	if *noExec {
+		successCommand = ""
+	}
+	if *thenWait {
+		fmt.Printf("  Then wait:      for %q in the output of %s, within the same timeout\n", *thenPattern, successCommand)
+	} else {
+		fmt.Printf("  On success:     %s", orNone(successCommand))
+		if *templateCmd {
+			fmt.Print(" (a template, rendered with the match)")
+		}
+		fmt.Println()
+	}
+	if *exitInvert {
+		fmt.Println("  Exit code:      inverted (0 if the pattern is not found)")
+	}
+	if len(*exitMap) > 0 {
+		// Already validated by main; parsing resolves aliases such as abort.
+		codes, _ := poller.ParseExitCodes(*exitMap)
+		fmt.Print("  Exit codes:    ")
+		for _, reason := range poller.Reasons {
+			if code, ok := codes[reason]; ok {
+				fmt.Printf(" %s=%d", reason, code)
+			}
+		}
+		fmt.Println()
+	}
+	if *repeatSuccess > 1 && successCommand != "" {
+		fmt.Printf("  Repeat:         %d times\n", *repeatSuccess)
+	}
+	if successCommand != "" && !*thenWait {
+		if !slices.Equal(*successCodes, []int{0}) {
+			fmt.Printf("  Success codes:  %s\n", joinCodes(*successCodes))
+		}
+		if *teeFile != "" {
+			fmt.Printf("  Tee:            output also written to %s\n", *teeFile)
+		}
+		if *lockFile != "" {
+			fmt.Printf("  Lock file:      %s, held while the command runs", *lockFile)
+			if *lockTimeout > 0 {
+				fmt.Printf(", waiting up to %s for it", *lockTimeout)
+			}
+			fmt.Println()
+		}
+	}
+	if *confirmInteractive {
+		fmt.Print("  Confirm:        ask on the terminal")
+		if *confirmTimeout > 0 {
+			fmt.Printf(", %s after %s", *confirmTimeoutAct, *confirmTimeout)
+		}
+		fmt.Println()
+	}
+	if *noExec {
+		fmt.Println("  On fail:        (none)")
+		fmt.Println("  No exec:        success and fail commands are skipped, only the exit code is set")
+	} else if len(*failCommands) == 0 {
+		fmt.Println("  On fail:        (none)")
+	}
+	for _, cmd := range *failCommands {
+		if !*noExec {
+			fmt.Printf("  On fail:        %s\n", cmd)
+		}
+	}
+	if len(*failCommands) > 0 && !*noExec && !slices.Equal(*failCodes, []int{0}) {
+		fmt.Printf("  Fail codes:     %s\n", joinCodes(*failCodes))
+	}
+	if *failEscalate != "" && !*noExec {
+		fmt.Printf("  Escalate:       %s\n", *failEscalate)
+	}
+	if *dumpFile != "" {
+		fmt.Printf("  Dump on fail:   %s\n", *dumpFile)
+	}
+	if *junitFile != "" {
+		fmt.Printf("  JUnit report:   %s\n", *junitFile)
+	}
+	if *bell || *notifyDesktop {
+		var ways []string
+		if *bell {
+			ways = append(ways, "terminal bell")
+		}
+		if *notifyDesktop {
+			ways = append(ways, "desktop notification")
+		}
+		fmt.Printf("  When over:      %s, if stdout is a terminal\n", strings.Join(ways, " and "))
+	}
+
+	waits := maxExplainedWaits
+	if *maxRetries > 0 && *maxRetries-1 < waits {
+		waits = *maxRetries - 1
+	}
+
+	fmt.Println("\nPoll schedule:")
+	fmt.Println("  Attempt 1 at 0s")
+	var elapsed time.Duration
+	for i, delay := range poller.Schedule(*interval, *backoff, waits) {
+		if *maxDelay > 0 {
+			delay = min(delay, *maxDelay)
+		}
+		elapsed += delay
+		if *timeout > 0 && elapsed > *timeout {
+			fmt.Printf("  Timeout at %s, before attempt %d\n", *timeout, i+2)
+			return
+		}
+		fmt.Printf("  Attempt %d at %s (after waiting %s)\n", i+2, elapsed, delay)
+	}
+	if *maxRetries == 0 || *maxRetries-1 > waits {
+		fmt.Println("  ...")
+	}
+	if *jitter > 0 {
+		fmt.Printf("  Each wait may be extended by up to %g%% jitter.\n", *jitter*100)
+	}
+	fmt.Println()
+}
+
+// joinCodes lists exit codes, e.g. "0, 3".
+func joinCodes(codes []int) string {
+	s := make([]string, len(codes))
+	for i, code := range codes {
+		s[i] = strconv.Itoa(code)
+	}
+	return strings.Join(s, ", ")
+}
+
+func orNone(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return "(none)"
+	}
+	return s
+}
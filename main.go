@@ -1,16 +1,33 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/spf13/pflag"
 
+	"github.com/gregory-chatelier/watchfor/pkg/config"
+	"github.com/gregory-chatelier/watchfor/pkg/confirm"
+	"github.com/gregory-chatelier/watchfor/pkg/duration"
+	"github.com/gregory-chatelier/watchfor/pkg/envfile"
 	"github.com/gregory-chatelier/watchfor/pkg/executor"
+	"github.com/gregory-chatelier/watchfor/pkg/filelock"
+	"github.com/gregory-chatelier/watchfor/pkg/junit"
+	"github.com/gregory-chatelier/watchfor/pkg/matcher"
+	"github.com/gregory-chatelier/watchfor/pkg/notify"
+	"github.com/gregory-chatelier/watchfor/pkg/pidfile"
+	"github.com/gregory-chatelier/watchfor/pkg/policy"
 	"github.com/gregory-chatelier/watchfor/pkg/poller"
+	"github.com/gregory-chatelier/watchfor/pkg/profile"
+	"github.com/gregory-chatelier/watchfor/pkg/transform"
 	"github.com/gregory-chatelier/watchfor/pkg/watcher"
 )
 
@@ -18,24 +35,138 @@ var version = "dev" // Default version, will be overwritten by linker
 
 var (
 	// Watch Options
-	command    = pflag.StringP("command", "c", "", "The command to execute and inspect.")
-	file       = pflag.StringP("file", "f", "", "The path to the file to read and inspect.")
-	pattern    = pflag.StringP("pattern", "p", "", "The exact string to search for in the output or file content.")
-	regex      = pflag.Bool("regex", false, "Enable regex matching for the pattern.")
-	ignoreCase = pflag.Bool("ignore-case", false, "Enable case-insensitive matching for the pattern.")
+	commands       = pflag.StringArrayP("command", "c", nil, "The command to execute and inspect. Repeatable: the outputs of all commands are combined.")
+	commandStdin   = pflag.Bool("command-stdin", false, "Read the command to execute and inspect from stdin, e.g. a generated multi-line script. Replaces --command.")
+	commandInput   = pflag.String("command-stdin-file", "", "Feed this file to the standard input of the --command on every check, e.g. a query for psql. It is read anew each time.")
+	shuffleSources = pflag.Bool("shuffle-sources", false, "With several --command, start them in a random order on each check, so that the first one is not always favored.")
+	stdoutOnly     = pflag.Bool("stdout-only", false, "With --command, only match the command's standard output. Its standard error is shown with --verbose, and dropped otherwise.")
+	maxParallel    = pflag.Int("max-parallel", 4, "With several --command, or --waits, how many of them run at the same time.")
+	file           = pflag.StringP("file", "f", "", "The path to the file to read and inspect.")
+	ptyMode        = pflag.Bool("pty", false, "With --command, run the command under a pseudo-terminal, for programs that only report progress to a terminal. Unix only.")
+	completeLines  = pflag.Bool("complete-lines", false, "With --file, only match complete lines, holding back a partial last line until its newline is written.")
+	fifo           = pflag.String("fifo", "", "The path to a named pipe to read and inspect without blocking (Unix only).")
+	watchDir       = pflag.String("watch-dir", "", "A directory in which to wait for new files matching --glob. Their names are inspected; without --pattern, any new file matches.")
+	glob           = pflag.String("glob", "*", "With --watch-dir, the file name pattern to watch for, e.g. `*.tar.gz`.")
+	unit           = pflag.String("unit", "", "A systemd unit whose new journal entries are inspected, like journalctl -fu (Linux only).")
+	source         = pflag.String("source", "", "A source given as `scheme://spec`, e.g. cmd://..., file://..., or a scheme registered by a custom build.")
+	waitsFile      = pflag.String("waits", "", "A JSON file listing several waits, each a --source spec and a pattern, to run in parallel. Succeeds when all of them match.")
+	anyWait        = pflag.Bool("any", false, "With --waits, succeed as soon as any one of the waits matches.")
+	pid            = pflag.Int("pid", 0, "A process whose CPU and memory usage are inspected, with --cpu-below and --mem-below. Exits when it does. Linux only.")
+	cpuBelow       = pflag.Float64("cpu-below", 0, "With --pid, treat CPU usage at or above this percentage of one core as not ready.")
+	memBelow       = pflag.Int64("mem-below", 0, "With --pid, treat resident memory at or above this many MiB as not ready.")
+	waitUnlock     = pflag.String("wait-unlock", "", "A file whose advisory lock (flock, or LockFileEx on Windows) to wait for another process to release. A missing file is retried. Without --pattern, the free lock matches.")
+	tlsCert        = pflag.String("tls-cert", "", "A host:port whose TLS certificate details (subject, serial, notAfter, ...) are inspected.")
+	redisAddr      = pflag.String("redis", "", "A Redis server, as host:port or a redis:// URL, whose --redis-key or --redis-channel is inspected.")
+	redisKey       = pflag.String("redis-key", "", "With --redis, a key whose value is inspected. A missing key has no output.")
+	redisChannel   = pflag.String("redis-channel", "", "With --redis, a channel whose messages, published since the previous check, are inspected.")
+	mqttBroker     = pflag.String("mqtt", "", "An MQTT broker, as host:port or a tcp://, ssl:// or ws:// URL, whose --topic is inspected.")
+	mqttTopic      = pflag.String("topic", "", "With --mqtt, a topic, wildcards allowed, whose messages received since the previous check are inspected.")
+	mqttQoS        = pflag.Int("mqtt-qos", 0, "With --mqtt, the quality of service of the subscription: 0, 1 or 2.")
+	mqttUsername   = pflag.String("mqtt-username", "", "With --mqtt, the username sent to the broker.")
+	mqttPassword   = pflag.String("mqtt-password", "", "With --mqtt, the password sent to the broker.")
+	listenAddr     = pflag.String("listen", "", "Listen for HTTP requests on this host:port instead of polling, e.g. :8099. The body of each request to --listen-path is inspected.")
+	listenPath     = pflag.String("listen-path", "/", "With --listen, the path whose requests are inspected. Other paths get a 404.")
+	minDaysLeft    = pflag.Int("min-days-left", 0, "With --tls-cert, treat certificates expiring in fewer days as not ready.")
+	pattern        = pflag.StringP("pattern", "p", "", "The exact string to search for in the output or file content.")
+	matchHistory   = pflag.Bool("match-history", false, "Match against the combined, de-duplicated outputs of recent attempts instead of the latest one.")
+	historySize    = pflag.Int("history-size", 100, "With --match-history, the number of distinct outputs to keep.")
+	maxAccumulate  = pflag.Int("max-accumulate-bytes", 0, "With --match-history, cap the combined history to this many bytes, evicting the oldest outputs first. `0` means no cap.")
+	fuzzy          = pflag.Bool("fuzzy", false, "Match when the output contains text within --max-distance edits of the pattern, for noisy sources such as OCR.")
+	maxDistance    = pflag.Int("max-distance", 1, "With --fuzzy, the maximum number of inserted, deleted or substituted characters.")
+	minCount       = pflag.Int("min-count", 0, "Succeed once the pattern has occurred this many times, counted across checks. Best with sources returning new content only, such as --file.")
+	minDistinct    = pflag.Int("min-distinct-lines", 0, "Match line by line and succeed once this many distinct lines have matched, possibly across attempts.")
+	regex          = pflag.Bool("regex", false, "Enable regex matching for the pattern.")
+	regexDotAll    = pflag.Bool("regex-dotall", false, "With --regex, let . match newlines, for patterns spanning several lines.")
+	regexMultiline = pflag.Bool("regex-multiline", false, "With --regex, make ^ and $ match at the start and end of every line, not only of the whole output.")
+	ignoreCase     = pflag.Bool("ignore-case", false, "Enable case-insensitive matching for the pattern.")
+	strictPattern  = pflag.Bool("strict-pattern", false, "Exit with an error, instead of warning, when a pattern matches any output, such as \".\" or \".*\" as a regex.")
+	patternsIn     = pflag.Bool("patterns-stdin", false, "Read additional patterns from stdin, one per line. Blank lines are ignored.")
+	matchAll       = pflag.Bool("all", false, "Require every pattern to be seen, possibly across different attempts, instead of any one of them.")
+	decode         = pflag.String("decode", "", "Decode the output before matching: `base64` or `base64url`.")
+	transformCmd   = pflag.String("transform", "", "A command that receives each output on stdin; its stdout is matched instead.")
+	since          = pflag.String("since", "", "Skip lines whose timestamp is before this RFC 3339 time, e.g. `2024-05-01T10:00:00Z`.")
+	timestampRegex = pflag.String("timestamp-regex", "", "With --since, a regex extracting each line's timestamp (its first capture group, or the whole match). Defaults to any RFC 3339 timestamp.")
+	dropUntimed    = pflag.Bool("drop-untimed", false, "With --since, also skip lines without a parseable timestamp.")
+	matchTimeout   = durationFlag("match-timeout", 0, "Give up on matching a single output after this long, counting it as a non-match. `0` means no limit.")
+	skipUnchanged  = pflag.Bool("skip-unchanged", false, "Skip preprocessing and matching when the output is identical to the last one, reusing its result.")
+	stableOutput   = pflag.Int("stable-output", 0, "Succeed once this many checks in a row return the same output, e.g. for a replica count to converge. --pattern is then optional.")
+	normNewlines   = pflag.Bool("normalize-newlines", false, "Convert CRLF and CR line endings to LF before any other preprocessing and matching.")
+	normalize      = pflag.StringArray("normalize", nil, "A sed-style substitution `s/regex/replacement/` applied to the output before matching. Repeatable.")
+	lineRange      = pflag.String("line-range", "", "Only match lines START to END of the output, numbered from 1, e.g. `5:10`. Either end may be omitted.")
+	diffOnly       = pflag.Bool("diff-only", false, "Only match the lines that are new compared to the previous output, for commands that print their whole history every time.")
+	between        = pflag.StringSlice("between", nil, "Only match within the region between a start and an end marker, given as `start,end`.")
+	jsonSchema     = pflag.String("json-schema", "", "Only match outputs that are JSON documents valid against the JSON Schema in this file. Without --pattern, any valid document matches.")
+	jsonLogField   = pflag.String("json-log-field", "", "Treat the output as JSON-lines logs, and match when an entry has this field, dots for nested ones, containing --json-log-contains. Other lines are skipped. Works with --ignore-case.")
+	jsonLogText    = pflag.String("json-log-contains", "", "With --json-log-field, the text the field must contain. Without it, any entry with the field matches.")
+	equalsEnv      = pflag.String("equals-env", "", "Match when the output, trimmed, equals the value of this environment variable, e.g. an expected commit hash. Works with --ignore-case.")
+	xpathExpr      = pflag.String("xpath", "", "Parse the output as XML and match when the XPath selector finds a node. Replaces --pattern.")
+	xpathEquals    = pflag.String("xpath-equals", "", "Require the text of the node selected by --xpath to equal this value.")
 
 	// Retry Options
-	interval    = pflag.Duration("interval", 1*time.Second, "The initial interval between polling attempts (e.g., `5s`, `1m`).")
-	maxRetries  = pflag.Int("max-retries", 10, "The maximum number of polling attempts before giving up. `0` means retry forever.")
-	backoff     = pflag.Float64("backoff", 1, "The exponential backoff factor. A factor of `1` disables exponential backoff.")
-	jitter      = pflag.Float64("jitter", 0, "The jitter factor to apply to the backoff delay (0 to 1). `0` disables jitter.")
-	timeout     = pflag.Duration("timeout", 0, "Overall max wait time. Overrides --max-retries. `0` means no timeout.")
-	failCommand = pflag.String("on-fail", "", "The command to execute if the pattern is not found.")
+	interval           = durationFlag("interval", 1*time.Second, "The initial interval between polling attempts (e.g., `5s`, `1m`, `PT5S`).")
+	maxRetries         = pflag.Int("max-retries", 10, "The maximum number of polling attempts before giving up. `0` means retry forever.")
+	maxDelay           = durationFlag("max-delay", 0, "The longest wait between two attempts, at which backoff levels off. `0` means an hour.")
+	retryPolicy        = pflag.String("policy", "", "Retry settings in one string, e.g. `interval=2s,backoff=2,max=30s,jitter=0.3,retries=20`. Keys: interval, backoff, max, jitter, retries, timeout. Explicit flags take precedence.")
+	backoffMode        = pflag.String("backoff-mode", "standard", "How delays grow: `standard` computes each from --interval, anchored from the previous delay, jitter included.")
+	backoff            = pflag.Float64("backoff", 1, "The exponential backoff factor. A factor of `1` disables exponential backoff.")
+	jitter             = pflag.Float64("jitter", 0, "The jitter factor to apply to the backoff delay (0 to 1). `0` disables jitter.")
+	timeout            = durationFlag("timeout", 0, "Overall max wait time (e.g., `5m`, `PT5M`). Overrides --max-retries. `0` means no timeout.")
+	maxWaitTotal       = durationFlag("max-wait-total", 0, "Fail once the waits between checks add up to this long, however long the checks take. `0` means no limit.")
+	maxEmpty           = pflag.Int("max-empty", 0, "Fail when more than this many successful checks in a row return no output, e.g. because a log's producer died. `0` means no limit.")
+	timeoutGrace       = durationFlag("timeout-grace", 0, "When --timeout expires during a check, let the check go on for up to this long, and succeed if it matches.")
+	finalCheck         = pflag.Bool("final-check", false, "When --timeout expires during a wait, check one last time before giving up. Stopping at --max-retries makes no extra check.")
+	patternTimeout     = durationFlag("pattern-timeout", 0, "Fail if the pattern is not found within this long of the first non-empty output, e.g. a service stuck while starting. `0` means no limit.")
+	templateCmd        = pflag.Bool("template-command", false, "Render the success command as a Go text/template with the match: {{.Group.name}}, {{.Line}}, {{.Text}} and {{.Output}}. Values are inserted as is; use {{quote ...}} for shell arguments.")
+	abortExit          = pflag.IntSlice("abort-exit", nil, "Exit codes of the watched command that stop polling immediately as a failure instead of retrying, e.g. 127,2.")
+	abortOnErr         = pflag.StringSlice("abort-on-error-type", nil, "Watcher error types that stop polling immediately instead of retrying: dns, timeout, network, exit, not-found, permission, exited, other, or none. Default: dns,permission,exited.")
+	onMatch            = pflag.String("on-match", "", "A command to run as soon as the pattern matches, before the success command. Its failure is logged but does not affect the result.")
+	teeFile            = pflag.String("tee", "", "Also write the success command's output to this file (created or truncated).")
+	successCodes       = pflag.IntSlice("success-exit-codes", []int{0}, "Exit codes of the success command that count as success.")
+	failCodes          = pflag.IntSlice("fail-exit-codes", []int{0}, "Exit codes of the fail command that count as success.")
+	dumpFile           = pflag.String("dump-on-failure", "", "On failure, write the complete output of the last check that returned any to this file, or with --file, --fifo, --unit, --mqtt or --redis-channel, the last MiB read.")
+	junitFile          = pflag.String("junit-file", "", "Write the outcome of the wait to this file as a JUnit XML report with one test case, for CI test dashboards.")
+	thenWait           = pflag.Bool("then-wait", false, "After a match, run the success command as a second source and wait for --then-pattern in its output, instead of running it once.")
+	thenPattern        = pflag.String("then-pattern", "", "With --then-wait, the pattern to wait for in the success command's output. Uses --regex and --ignore-case like --pattern.")
+	repeatSuccess      = pflag.Int("repeat-success", 1, "Run the success command this many times in sequence after a match, e.g. to warm caches. Fails if any run fails.")
+	confirmInteractive = pflag.Bool("confirm-interactive", false, "Ask for confirmation on the terminal before running the success command. Skipped when stdin is not a terminal.")
+	confirmTimeout     = durationFlag("confirm-timeout", 0, "How long to wait for --confirm-interactive. `0` means wait forever.")
+	confirmTimeoutAct  = pflag.String("confirm-timeout-action", "abort", "What to do when --confirm-timeout expires: `abort` or `proceed`.")
+	pidFile            = pflag.String("pidfile", "", "Write watchfor's PID to this file while it runs, so it can be signalled, e.g. kill -TERM $(cat file). A file left by a process that is no longer running is replaced.")
+	cpuProfile         = pflag.String("cpuprofile", "", "Write a pprof CPU profile of the whole run to this file.")
+	memProfile         = pflag.String("memprofile", "", "Write a pprof heap profile to this file when watchfor exits.")
+	lockFile           = pflag.String("lock-file", "", "Hold an exclusive lock on this file while the success command runs, serializing it across watchfor processes.")
+	lockTimeout        = durationFlag("lock-timeout", 0, "How long to wait for --lock-file before failing. `0` means wait forever.")
+	failCommands       = pflag.StringArray("on-fail", nil, "A command to execute if the pattern is not found. Repeatable; all of them run in order, even if one fails.")
+	failEscalate       = pflag.String("on-fail-escalate", "", "A command to execute if any --on-fail command fails, e.g. to alert someone.")
+	progressRe         = pflag.String("progress-regex", "", "Regex whose first capture group extracts a progress percentage (0-100) to shorten the wait as it grows.")
+	minInterval        = durationFlag("min-interval", 0, "The interval used at 100% progress with --progress-regex.")
+	setupCommand       = pflag.String("setup", "", "A command run once before the first check, e.g. to start a deployment to wait for. Watchfor exits with 1 if it fails.")
+	probeCommand       = pflag.String("probe-command", "", "A cheap command run before each check. When it fails, the check is skipped and counts as a non-match.")
+	settle             = durationFlag("settle", 0, "Wait this long after a match before running the success command, e.g. to let caches or DNS catch up. A timeout meanwhile fails with the timeout-after-match reason.")
+	minElapsed         = durationFlag("min-elapsed", 0, "Succeed no sooner than this long after the start, waiting after an earlier match, e.g. to respect a rate limit.")
+	noExec             = pflag.Bool("no-exec", false, "Never run the success or fail commands, even if given; only set the exit code. Useful as a pure readiness gate.")
+	triggerFile        = pflag.String("trigger-file", "", "Also check immediately whenever this file changes, in addition to the interval.")
 
 	// General Options
-	verbose     = pflag.BoolP("verbose", "v", false, "Enable verbose logging.")
-	help        = pflag.BoolP("help", "h", false, "Show the help message.")
-	showVersion = pflag.BoolP("version", "", false, "Show watchfor version.")
+	envFile       = pflag.String("env-file", "", "Load KEY=VALUE lines from this file into the environment of every command run.")
+	envVars       = pflag.StringArray("env", nil, "Set an environment variable, given as `KEY=VALUE`, for every command run. Repeatable; overrides --env-file.")
+	heartbeatFile = pflag.String("heartbeat-file", "", "Touch this file after every check, so a watchdog can detect a stuck process.")
+	bell          = pflag.Bool("bell", false, "Ring the terminal bell when the wait is over. Ignored when stdout is not a terminal.")
+	notifyDesktop = pflag.Bool("notify-desktop", false, "Show a desktop notification when the wait is over. Ignored when stdout is not a terminal.")
+	exitMap       = pflag.StringToInt("exit-map", nil, "Exit codes for the reasons the wait stopped, given as `reason=code`, e.g. timeout=75,max-retries=76. See WATCHFOR_REASON for the reasons.")
+	exitInvert    = pflag.Bool("exit-invert", false, "Exit with 0 when the pattern is not found and 1 when it is. Which command runs is unchanged.")
+	noEmoji       = pflag.Bool("no-emoji", false, "Use ASCII symbols such as [OK] and [FAIL] in the result banners, for logs that mangle Unicode.")
+	symbols       = pflag.StringToString("symbols", nil, "Override the symbols of the result banners, given as `success=...,fail=...,escalate=...`. An empty value removes the symbol.")
+	passthrough   = pflag.Bool("passthrough", false, "Print the raw output of every check as soon as it returns, independently of --verbose, to follow the source live.")
+	passPrefix    = pflag.String("passthrough-prefix", "", "With --passthrough, a prefix for each line, e.g. \"[app] \".")
+	annotate      = pflag.Bool("annotate", false, "Prefix each line of the output printed by --verbose and --passthrough with [attempt=N t=HH:MM:SS]. Matching is not affected.")
+	dedupLog      = pflag.Bool("dedup-log", false, "Collapse identical consecutive lines of the output printed by --verbose and --passthrough into one line followed by (xN). Matching is not affected.")
+	verbose       = pflag.BoolP("verbose", "v", false, "Enable verbose logging.")
+	validateOnly  = pflag.Bool("validate", false, "Check that the shell, source, commands and patterns are usable, print a report and exit without polling.")
+	explainRun    = pflag.Bool("explain", false, "Print the effective configuration and poll schedule before polling.")
+	configFile    = pflag.String("config", "", "A YAML config file of flag defaults, taking precedence over the global one in $XDG_CONFIG_HOME/watchfor/config.yaml. Command line flags take precedence over both.")
+	help          = pflag.BoolP("help", "h", false, "Show the help message.")
+	showVersion   = pflag.BoolP("version", "", false, "Show watchfor version.")
 )
 
 func init() {
@@ -57,6 +188,7 @@ func init() {
 
 func main() {
 	pflag.Parse()
+	defer runCleanups()
 
 	if *help {
 		pflag.Usage()
@@ -68,19 +200,237 @@ func main() {
 		os.Exit(0)
 	}
 
+	// A --policy on the command line takes precedence over the config files,
+	// and one from a config file over the builtin defaults only.
+	cliPolicy := pflag.CommandLine.Changed("policy")
+	if cliPolicy {
+		if err := policy.Apply(pflag.CommandLine, *retryPolicy); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --policy: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if err := applyConfigFiles(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if !cliPolicy {
+		if err := policy.Apply(pflag.CommandLine, *retryPolicy); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --policy: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// --- Argument Validation ---
-	if *command != "" && *file != "" {
-		fmt.Fprintln(os.Stderr, "Error: --command (-c) and --file (-f) cannot be used together.")
+	if *commandStdin {
+		if len(*commands) > 0 || *patternsIn {
+			fmt.Fprintln(os.Stderr, "Error: --command-stdin cannot be used with --command (-c) or --patterns-stdin.")
+			os.Exit(1)
+		}
+		script, err := readScript(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading the command from stdin: %v\n", err)
+			os.Exit(1)
+		}
+		if script == "" {
+			fmt.Fprintln(os.Stderr, "Error: --command-stdin read an empty command.")
+			os.Exit(1)
+		}
+		*commands = []string{script}
+	}
+	sources := 0
+	for _, s := range []string{*file, *fifo, *watchDir, *unit, *tlsCert, *waitUnlock, *redisAddr, *mqttBroker, *listenAddr, *source, *waitsFile} {
+		if s != "" {
+			sources++
+		}
+	}
+	if len(*commands) > 0 {
+		sources++
+	}
+	if *pid != 0 {
+		sources++
+	}
+	if sources > 1 {
+		fmt.Fprintln(os.Stderr, "Error: only one of --command (-c), --file (-f), --fifo, --watch-dir, --unit, --pid, --tls-cert, --wait-unlock, --redis, --mqtt, --listen, --source or --waits can be used.")
+		os.Exit(1)
+	}
+	if sources == 0 {
+		fmt.Fprintln(os.Stderr, "Error: one of --command (-c), --file (-f), --fifo, --watch-dir, --unit, --pid, --tls-cert, --wait-unlock, --redis, --mqtt, --listen, --source or --waits must be specified.")
+		os.Exit(1)
+	}
+	if *waitsFile != "" && (*pattern != "" || *patternsIn || *xpathExpr != "" || *jsonSchema != "" || *equalsEnv != "" || *jsonLogField != "" || *thenWait) {
+		fmt.Fprintln(os.Stderr, "Error: --waits sets the pattern of each wait, and cannot be used with --pattern (-p), --patterns-stdin, --xpath, --json-schema, --equals-env, --json-log-field or --then-wait.")
+		os.Exit(1)
+	}
+	if *waitsFile != "" && (*setupCommand != "" || *onMatch != "" || *teeFile != "" || *lockFile != "" || *confirmInteractive || *failEscalate != "" || *dumpFile != "" || *junitFile != "" || *exitInvert || len(*exitMap) > 0) {
+		fmt.Fprintln(os.Stderr, "Error: --waits cannot be used with --setup, --on-match, --tee, --lock-file, --confirm-interactive, --on-fail-escalate, --dump-on-failure, --junit-file, --exit-invert or --exit-map.")
+		os.Exit(1)
+	}
+	if *anyWait && *waitsFile == "" {
+		fmt.Fprintln(os.Stderr, "Error: --any requires --waits.")
+		os.Exit(1)
+	}
+	if *pid < 0 || *cpuBelow < 0 || *memBelow < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --pid, --cpu-below and --mem-below must not be negative.")
+		os.Exit(1)
+	}
+	if (*cpuBelow > 0 || *memBelow > 0) && *pid == 0 {
+		fmt.Fprintln(os.Stderr, "Error: --cpu-below and --mem-below require --pid.")
+		os.Exit(1)
+	}
+	if *commandInput != "" && (len(*commands) != 1 || *ptyMode) {
+		fmt.Fprintln(os.Stderr, "Error: --command-stdin-file requires a single --command (-c), without --pty.")
+		os.Exit(1)
+	}
+	if *shuffleSources && len(*commands) < 2 {
+		fmt.Fprintln(os.Stderr, "Error: --shuffle-sources requires several --command (-c).")
+		os.Exit(1)
+	}
+	if *stdoutOnly && (len(*commands) == 0 || *ptyMode) {
+		fmt.Fprintln(os.Stderr, "Error: --stdout-only requires --command (-c), without --pty.")
+		os.Exit(1)
+	}
+	if *ptyMode && len(*commands) != 1 {
+		fmt.Fprintln(os.Stderr, "Error: --pty requires a single --command (-c).")
+		os.Exit(1)
+	}
+	if *maxParallel < 1 {
+		fmt.Fprintln(os.Stderr, "Error: --max-parallel must be at least 1.")
+		os.Exit(1)
+	}
+	if *confirmTimeoutAct != "abort" && *confirmTimeoutAct != "proceed" {
+		fmt.Fprintln(os.Stderr, "Error: --confirm-timeout-action must be 'abort' or 'proceed'.")
+		os.Exit(1)
+	}
+	exitCodes, exitMapErr := poller.ParseExitCodes(*exitMap)
+	if err := exitMapErr; err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --exit-map: %v\n", err)
+		os.Exit(1)
+	}
+	if err := setSymbols(*noEmoji, *symbols); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --symbols: %v\n", err)
+		os.Exit(1)
+	}
+	if *repeatSuccess < 1 {
+		fmt.Fprintln(os.Stderr, "Error: --repeat-success must be at least 1.")
+		os.Exit(1)
+	}
+	if *maxAccumulate < 0 || (*maxAccumulate > 0 && !*matchHistory) {
+		fmt.Fprintln(os.Stderr, "Error: --max-accumulate-bytes must be positive and requires --match-history.")
+		os.Exit(1)
+	}
+	if *fuzzy && (*regex || *xpathExpr != "" || *patternsIn || *minDistinct > 0) {
+		fmt.Fprintln(os.Stderr, "Error: --fuzzy cannot be used with --regex, --xpath, --patterns-stdin or --min-distinct-lines.")
+		os.Exit(1)
+	}
+	if *maxDistance < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --max-distance must not be negative.")
+		os.Exit(1)
+	}
+	if *minCount < 0 || (*minCount > 0 && (*pattern == "" || *xpathExpr != "" || *patternsIn || *fuzzy || *minDistinct > 0 || *matchHistory || *matchAll || *skipUnchanged)) {
+		fmt.Fprintln(os.Stderr, "Error: --min-count must be positive, needs --pattern (-p) and cannot be used with --xpath, --patterns-stdin, --fuzzy, --min-distinct-lines, --match-history, --all or --skip-unchanged.")
+		os.Exit(1)
+	}
+	if *minDistinct < 0 || (*minDistinct > 0 && ((*pattern == "" && !*patternsIn) || *xpathExpr != "")) {
+		fmt.Fprintln(os.Stderr, "Error: --min-distinct-lines must be positive, needs --pattern (-p) or --patterns-stdin and cannot be used with --xpath.")
+		os.Exit(1)
+	}
+	if *diffOnly && *xpathExpr != "" {
+		fmt.Fprintln(os.Stderr, "Error: --diff-only cannot be used with --xpath, as it breaks up the document.")
+		os.Exit(1)
+	}
+	if *historySize < 1 {
+		fmt.Fprintln(os.Stderr, "Error: --history-size must be at least 1.")
+		os.Exit(1)
+	}
+	if (*regexDotAll || *regexMultiline) && !*regex {
+		fmt.Fprintln(os.Stderr, "Error: --regex-dotall and --regex-multiline require --regex.")
+		os.Exit(1)
+	}
+	if *completeLines && *file == "" {
+		fmt.Fprintln(os.Stderr, "Error: --complete-lines requires --file (-f).")
+		os.Exit(1)
+	}
+	if *redisAddr != "" && (*redisKey == "") == (*redisChannel == "") {
+		fmt.Fprintln(os.Stderr, "Error: --redis requires exactly one of --redis-key or --redis-channel.")
+		os.Exit(1)
+	}
+	if (*redisKey != "" || *redisChannel != "") && *redisAddr == "" {
+		fmt.Fprintln(os.Stderr, "Error: --redis-key and --redis-channel require --redis.")
+		os.Exit(1)
+	}
+	if (*mqttBroker == "") != (*mqttTopic == "") {
+		fmt.Fprintln(os.Stderr, "Error: --mqtt and --topic must be used together.")
+		os.Exit(1)
+	}
+	if *mqttQoS < 0 || *mqttQoS > 2 {
+		fmt.Fprintln(os.Stderr, "Error: --mqtt-qos must be 0, 1 or 2.")
+		os.Exit(1)
+	}
+	if (pflag.CommandLine.Changed("mqtt-qos") || *mqttUsername != "" || *mqttPassword != "") && *mqttBroker == "" {
+		fmt.Fprintln(os.Stderr, "Error: --mqtt-qos, --mqtt-username and --mqtt-password require --mqtt.")
+		os.Exit(1)
+	}
+	if pflag.CommandLine.Changed("listen-path") && *listenAddr == "" {
+		fmt.Fprintln(os.Stderr, "Error: --listen-path requires --listen.")
+		os.Exit(1)
+	}
+	if !strings.HasPrefix(*listenPath, "/") {
+		fmt.Fprintln(os.Stderr, "Error: --listen-path must start with '/'.")
+		os.Exit(1)
+	}
+	if (*listenAddr != "" || strings.HasPrefix(*source, "listen://")) && *triggerFile != "" {
+		fmt.Fprintln(os.Stderr, "Error: --listen checks each request as it arrives, and cannot be used with --trigger-file.")
+		os.Exit(1)
+	}
+	if *minDaysLeft > 0 && *tlsCert == "" {
+		fmt.Fprintln(os.Stderr, "Error: --min-days-left requires --tls-cert.")
+		os.Exit(1)
+	}
+	var stdinPatterns []string
+	if *patternsIn {
+		var err error
+		stdinPatterns, err = readPatterns(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading patterns from stdin: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *jsonSchema != "" && *xpathExpr != "" {
+		fmt.Fprintln(os.Stderr, "Error: --json-schema and --xpath cannot be used together.")
+		os.Exit(1)
+	}
+	if *equalsEnv != "" && (*pattern != "" || *patternsIn || *xpathExpr != "" || *fuzzy || *minCount > 0 || *minDistinct > 0) {
+		fmt.Fprintln(os.Stderr, "Error: --equals-env cannot be used with --pattern (-p), --patterns-stdin, --xpath, --fuzzy, --min-count or --min-distinct-lines.")
+		os.Exit(1)
+	}
+	if *jsonLogField != "" && (*pattern != "" || *patternsIn || *xpathExpr != "" || *jsonSchema != "" || *equalsEnv != "" || *fuzzy || *minCount > 0 || *minDistinct > 0) {
+		fmt.Fprintln(os.Stderr, "Error: --json-log-field cannot be used with --pattern (-p), --patterns-stdin, --xpath, --json-schema, --equals-env, --fuzzy, --min-count or --min-distinct-lines.")
 		os.Exit(1)
 	}
-	if *command == "" && *file == "" {
-		fmt.Fprintln(os.Stderr, "Error: either --command (-c) or --file (-f) must be specified.")
+	if *stableOutput != 0 && (*stableOutput < 2 || *skipUnchanged) {
+		fmt.Fprintln(os.Stderr, "Error: --stable-output must be at least 2 and cannot be used with --skip-unchanged.")
 		os.Exit(1)
 	}
-	if *pattern == "" {
+	if *jsonLogText != "" && *jsonLogField == "" {
+		fmt.Fprintln(os.Stderr, "Error: --json-log-contains requires --json-log-field.")
+		os.Exit(1)
+	}
+	if *pattern == "" && len(stdinPatterns) == 0 && *xpathExpr == "" && *jsonSchema == "" && *equalsEnv == "" && *jsonLogField == "" && *waitsFile == "" && *watchDir == "" && *pid == 0 && *waitUnlock == "" && *listenAddr == "" && *stableOutput == 0 && !presenceSource(*source, "dir", "pid", "lock", "listen") {
 		fmt.Fprintln(os.Stderr, "Error: --pattern (-p) is required.")
 		os.Exit(1)
 	}
+	if (*pattern != "" || *patternsIn) && *xpathExpr != "" {
+		fmt.Fprintln(os.Stderr, "Error: --pattern (-p) and --xpath cannot be used together.")
+		os.Exit(1)
+	}
+	if *xpathEquals != "" && *xpathExpr == "" {
+		fmt.Fprintln(os.Stderr, "Error: --xpath-equals requires --xpath.")
+		os.Exit(1)
+	}
+	if *backoffMode != "standard" && *backoffMode != "anchored" {
+		fmt.Fprintln(os.Stderr, "Error: --backoff-mode must be standard or anchored.")
+		os.Exit(1)
+	}
 	if *backoff < 1 {
 		fmt.Fprintln(os.Stderr, "Error: --backoff must be >= 1.")
 		os.Exit(1)
@@ -89,30 +439,522 @@ func main() {
 		fmt.Fprintln(os.Stderr, "Error: --jitter must be between 0 and 1.")
 		os.Exit(1)
 	}
+	if *maxDelay < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --max-delay must not be negative.")
+		os.Exit(1)
+	}
+	if *maxEmpty < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --max-empty must not be negative.")
+		os.Exit(1)
+	}
+	if *passPrefix != "" && !*passthrough {
+		fmt.Fprintln(os.Stderr, "Error: --passthrough-prefix requires --passthrough.")
+		os.Exit(1)
+	}
+	if *maxWaitTotal < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --max-wait-total must not be negative.")
+		os.Exit(1)
+	}
+	if *timeoutGrace < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --timeout-grace must not be negative.")
+		os.Exit(1)
+	}
+	if *finalCheck && *timeout <= 0 {
+		fmt.Fprintln(os.Stderr, "Error: --final-check requires --timeout.")
+		os.Exit(1)
+	}
+	if *timeoutGrace > 0 && *timeout <= 0 {
+		fmt.Fprintln(os.Stderr, "Error: --timeout-grace requires --timeout.")
+		os.Exit(1)
+	}
+	if *minElapsed < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --min-elapsed must not be negative.")
+		os.Exit(1)
+	}
+	if *minElapsed > 0 && *timeout > 0 && *minElapsed >= *timeout {
+		// The wait could never end before the timeout, turning any match into a failure.
+		fmt.Fprintln(os.Stderr, "Error: --min-elapsed must be shorter than --timeout.")
+		os.Exit(1)
+	}
+
+	if *progressRe != "" && (*minInterval <= 0 || *minInterval > *interval) {
+		fmt.Fprintln(os.Stderr, "Error: --progress-regex requires a --min-interval between 0 and --interval.")
+		os.Exit(1)
+	}
+
+	for _, code := range *abortExit {
+		if code < 1 || code > 255 {
+			fmt.Fprintf(os.Stderr, "Error: --abort-exit codes must be between 1 and 255, got %d.\n", code)
+			os.Exit(1)
+		}
+	}
+	if len(*abortExit) > 0 && len(*commands) == 0 && *source == "" {
+		fmt.Fprintln(os.Stderr, "Error: --abort-exit requires --command (-c) or --source.")
+		os.Exit(1)
+	}
+	for _, t := range *abortOnErr {
+		if t != "none" && !slices.Contains(poller.ErrorTypes, t) {
+			fmt.Fprintf(os.Stderr, "Error: unknown --abort-on-error-type %q.\n", t)
+			os.Exit(1)
+		}
+	}
+
+	if *decode != "" && *decode != "base64" && *decode != "base64url" {
+		fmt.Fprintln(os.Stderr, "Error: --decode must be base64 or base64url.")
+		os.Exit(1)
+	}
+	var sinceFilter transform.Func
+	if *since != "" {
+		sinceTime, err := time.Parse(time.RFC3339, *since)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --since must be an RFC 3339 time: %v\n", err)
+			os.Exit(1)
+		}
+		expr := *timestampRegex
+		if expr == "" {
+			expr = transform.DefaultTimestampRegex
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --timestamp-regex: %v\n", err)
+			os.Exit(1)
+		}
+		sinceFilter = transform.Since(sinceTime, re, *dropUntimed)
+	} else if *timestampRegex != "" || *dropUntimed {
+		fmt.Fprintln(os.Stderr, "Error: --timestamp-regex and --drop-untimed require --since.")
+		os.Exit(1)
+	}
+	var substitutions []transform.Func
+	for _, expr := range *normalize {
+		fn, err := transform.Substitute(expr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --normalize: %v\n", err)
+			os.Exit(1)
+		}
+		substitutions = append(substitutions, fn)
+	}
+	var lineFilter transform.Func
+	if *lineRange != "" {
+		fn, err := transform.LineRange(*lineRange)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --line-range: %v\n", err)
+			os.Exit(1)
+		}
+		lineFilter = fn
+	}
+	if len(*between) > 0 && (len(*between) != 2 || (*between)[0] == "" || (*between)[1] == "") {
+		fmt.Fprintln(os.Stderr, "Error: --between expects a start and an end marker, e.g. 'BEGIN REPORT,END REPORT'.")
+		os.Exit(1)
+	}
 
 	// The command to execute on success is all args after '--'
 	successCommandArgs := pflag.Args()
 
+	if *thenPattern != "" && !*thenWait {
+		fmt.Fprintln(os.Stderr, "Error: --then-pattern requires --then-wait.")
+		os.Exit(1)
+	}
+	if *thenWait {
+		if *thenPattern == "" || len(successCommandArgs) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: --then-wait requires --then-pattern and a success command to watch.")
+			os.Exit(1)
+		}
+		if *noExec || *teeFile != "" || *repeatSuccess > 1 || *lockFile != "" || *confirmInteractive {
+			fmt.Fprintln(os.Stderr, "Error: --then-wait cannot be combined with --no-exec, --tee, --repeat-success, --lock-file or --confirm-interactive.")
+			os.Exit(1)
+		}
+	}
+	if *templateCmd {
+		if len(successCommandArgs) == 0 || *thenWait || *waitsFile != "" {
+			fmt.Fprintln(os.Stderr, "Error: --template-command requires a success command, and cannot be used with --then-wait or --waits.")
+			os.Exit(1)
+		}
+		if _, err := executor.ParseTemplate(strings.Join(successCommandArgs, " ")); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --template-command: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Only the matching settings tell whether a pattern matches any output.
+	matchOpts := []poller.Option{poller.WithPatterns(stdinPatterns...), poller.WithRegexFlags(regexFlags())}
+	if *fuzzy {
+		matchOpts = append(matchOpts, poller.WithMatcher(matcher.NewFuzzyMatcher(*pattern, *maxDistance, *ignoreCase)))
+	}
+	for _, p := range poller.New(nil, *pattern, false, *regex, *ignoreCase, matchOpts...).TrivialPatterns() {
+		if *strictPattern {
+			fmt.Fprintf(os.Stderr, "Error: pattern %q matches any output.\n", p)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: pattern %q matches any output. Use --strict-pattern to make this an error.\n", p)
+	}
+
+	if *explainRun {
+		explain(stdinPatterns, strings.Join(successCommandArgs, " "))
+	}
+	if *validateOnly {
+		os.Exit(validate(stdinPatterns, strings.Join(successCommandArgs, " ")))
+	}
+
+	prof, profErr := profile.Start(*cpuProfile, *memProfile)
+	if profErr != nil {
+		fmt.Fprintf(os.Stderr, "Error starting profiling: %v\n", profErr)
+		exit(1)
+	}
+	// Every exit from here on goes through exit, which writes the profiles.
+	onExit(func() {
+		if err := prof.Stop(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: writing memory profile: %v\n", err)
+		}
+	})
+
+	if *pidFile != "" {
+		f, err := pidfile.Write(*pidFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing pid file: %v\n", err)
+			exit(1)
+		}
+		onExit(func() { f.Remove() })
+	}
+
+	// --- Environment ---
+	// Commands inherit the environment, so this applies to all of them.
+	var env []string
+	if *envFile != "" {
+		loaded, err := envfile.Load(*envFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --env-file: %v\n", err)
+			exit(1)
+		}
+		env = loaded
+	}
+	for _, kv := range *envVars {
+		if key, _, ok := strings.Cut(kv, "="); !ok || key == "" {
+			fmt.Fprintf(os.Stderr, "Error: --env expects KEY=VALUE, got %q.\n", kv)
+			exit(1)
+		}
+		env = append(env, kv)
+	}
+	for _, kv := range env {
+		key, value, _ := strings.Cut(kv, "=")
+		os.Setenv(key, value)
+	}
+
+	if *waitsFile != "" {
+		exit(runWaits(strings.Join(successCommandArgs, " ")))
+	}
+
 	// --- Watcher Selection ---
 	var w watcher.Watcher
 	var err error
+	// With --listen, the server, shut down as soon as the wait is over.
+	var listener *watcher.ListenWatcher
 
-	if *command != "" {
-		w = watcher.NewCommandWatcher(*command)
-	} else {
-		w, err = watcher.NewFileWatcher(*file)
+	switch {
+	case len(*commands) > 0 && *ptyMode:
+		w, err = watcher.NewPTYWatcher((*commands)[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --pty: %v\n", err)
+			exit(1)
+		}
+	case len(*commands) == 1:
+		opts := commandOptions()
+		if *commandInput != "" {
+			opts = append(opts, watcher.WithStdinFile(*commandInput))
+		}
+		w = watcher.NewCommandWatcher((*commands)[0], opts...)
+	case len(*commands) > 1:
+		w = watcher.NewMultiCommandWatcher(*commands, *maxParallel, commandOptions()...)
+	case *tlsCert != "":
+		w = watcher.NewTLSCertWatcher(*tlsCert, *minDaysLeft)
+	case *waitUnlock != "":
+		w = watcher.NewFileLockWatcher(*waitUnlock)
+	case *redisAddr != "":
+		if *redisChannel != "" {
+			w, err = watcher.NewRedisChannelWatcher(*redisAddr, *redisChannel)
+		} else {
+			w, err = watcher.NewRedisWatcher(*redisAddr, *redisKey)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --redis: %v\n", err)
+			exit(1)
+		}
+	case *mqttBroker != "":
+		w, err = watcher.NewMQTTWatcher(*mqttBroker, *mqttTopic, mqttOptions()...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --mqtt: %v\n", err)
+			exit(1)
+		}
+	case *listenAddr != "":
+		listener, err = watcher.NewListenWatcher(*listenAddr, *listenPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --listen: %v\n", err)
+			exit(1)
+		}
+		w = listener
+	case *fifo != "":
+		w, err = watcher.NewFIFOWatcher(*fifo)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening named pipe: %v\n", err)
+			exit(1)
+		}
+	case *watchDir != "":
+		w, err = watcher.NewDirWatcher(*watchDir, *glob)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error watching directory: %v\n", err)
+			exit(1)
+		}
+	case *source != "":
+		w, err = watcher.FromSpec(*source)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening source: %v\n", err)
+			exit(1)
+		}
+		listener, _ = w.(*watcher.ListenWatcher)
+	case *pid != 0:
+		w, err = watcher.NewProcessWatcher(*pid, *cpuBelow, *memBelow<<20)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error watching process: %v\n", err)
+			exit(1)
+		}
+	case *unit != "":
+		w, err = watcher.NewJournalWatcher(*unit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading the journal: %v\n", err)
+			exit(1)
+		}
+	default:
+		var fileOpts []watcher.FileOption
+		// A JSON entry split across two checks would not parse, and be skipped.
+		if *completeLines || *jsonLogField != "" {
+			fileOpts = append(fileOpts, watcher.WithCompleteLines())
+		}
+		w, err = watcher.NewFileWatcher(*file, fileOpts...)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error opening file: %v\n", err)
-			os.Exit(1)
+			exit(1)
+		}
+	}
+	if c, ok := w.(io.Closer); ok {
+		// File-based watchers hold an open handle, so we must ensure it's closed.
+		// Command watchers kill a check still running, e.g. when interrupted.
+		defer c.Close()
+		onExit(func() { c.Close() })
+	}
+
+	// --- Matcher Selection ---
+	var pollerOpts []poller.Option
+	// The options shared by the second stage of --then-wait.
+	var thenOpts []poller.Option
+
+	if pflag.CommandLine.Changed("abort-on-error-type") {
+		abortTypes := slices.DeleteFunc(slices.Clone(*abortOnErr), func(t string) bool { return t == "none" })
+		pollerOpts = append(pollerOpts, poller.WithAbortOnErrors(abortTypes...))
+		thenOpts = append(thenOpts, poller.WithAbortOnErrors(abortTypes...))
+	}
+	if *shuffleSources {
+		pollerOpts = append(pollerOpts, poller.WithShuffledSources())
+	}
+	if len(*abortExit) > 0 {
+		pollerOpts = append(pollerOpts, poller.WithAbortOnExitCodes(*abortExit...))
+		thenOpts = append(thenOpts, poller.WithAbortOnExitCodes(*abortExit...))
+	}
+	var transforms []transform.Func
+	if *decode != "" {
+		transforms = append(transforms, transform.Base64(*decode == "base64url"))
+	}
+	if *transformCmd != "" {
+		transforms = append(transforms, transform.Command(*transformCmd))
+	}
+	if sinceFilter != nil {
+		transforms = append(transforms, sinceFilter)
+	}
+	transforms = append(transforms, substitutions...)
+	if lineFilter != nil {
+		transforms = append(transforms, lineFilter)
+	}
+	if len(*between) > 0 {
+		transforms = append(transforms, transform.Between((*between)[0], (*between)[1]))
+	}
+	if *diffOnly {
+		transforms = append(transforms, transform.NewLines())
+	}
+	if len(transforms) > 0 {
+		pollerOpts = append(pollerOpts, poller.WithTransforms(transforms...))
+	}
+	if len(stdinPatterns) > 0 {
+		pollerOpts = append(pollerOpts, poller.WithPatterns(stdinPatterns...))
+	}
+	if *matchTimeout > 0 {
+		pollerOpts = append(pollerOpts, poller.WithMatchTimeout(*matchTimeout))
+	}
+	if *skipUnchanged {
+		pollerOpts = append(pollerOpts, poller.WithSkipUnchanged())
+	}
+	if *stableOutput > 0 {
+		pollerOpts = append(pollerOpts, poller.WithStableOutput(*stableOutput))
+	}
+	if *normNewlines {
+		pollerOpts = append(pollerOpts, poller.WithNormalizedNewlines())
+	}
+	if *matchHistory {
+		pollerOpts = append(pollerOpts, poller.WithMatchHistory(*historySize), poller.WithMaxHistoryBytes(*maxAccumulate))
+	}
+	if *minCount > 0 {
+		pollerOpts = append(pollerOpts, poller.WithMinCount(*minCount))
+	}
+	if *minDistinct > 0 {
+		pollerOpts = append(pollerOpts, poller.WithMinDistinctLines(*minDistinct))
+	}
+	if *matchAll {
+		pollerOpts = append(pollerOpts, poller.WithMatchAll())
+	}
+	if *fuzzy {
+		pollerOpts = append(pollerOpts, poller.WithMatcher(matcher.NewFuzzyMatcher(*pattern, *maxDistance, *ignoreCase)))
+	}
+	if *xpathExpr != "" {
+		m, err := matcher.NewXPathMatcher(*xpathExpr, *xpathEquals)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --xpath selector: %v\n", err)
+			exit(1)
+		}
+		pollerOpts = append(pollerOpts, poller.WithMatcher(m))
+	}
+	if *equalsEnv != "" {
+		// Looked up after --env and --env-file have been applied.
+		expected, ok := os.LookupEnv(*equalsEnv)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: --equals-env: environment variable %s is not set.\n", *equalsEnv)
+			exit(1)
+		}
+		pollerOpts = append(pollerOpts, poller.WithMatcher(matcher.NewEqualsMatcher(expected, *ignoreCase)))
+	}
+	if *jsonLogField != "" {
+		pollerOpts = append(pollerOpts, poller.WithMatcher(matcher.NewJSONLogMatcher(*jsonLogField, *jsonLogText, *ignoreCase)))
+	}
+	if *jsonSchema != "" {
+		m, err := matcher.NewJSONSchemaMatcher(*jsonSchema)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --json-schema: %v\n", err)
+			exit(1)
 		}
-		if fw, ok := w.(*watcher.FileWatcher); ok {
-			// Since FileWatcher holds an open file handle, we must ensure it's closed.
-			defer fw.Close()
+		if *pattern == "" && len(stdinPatterns) == 0 && *equalsEnv == "" {
+			pollerOpts = append(pollerOpts, poller.WithMatcher(m))
+		} else {
+			pollerOpts = append(pollerOpts, poller.WithPrecondition(m))
 		}
 	}
+	if (*watchDir != "" || *pid != 0 || *waitUnlock != "" || presenceSource(*source, "dir", "pid", "lock")) && *pattern == "" && len(stdinPatterns) == 0 && *xpathExpr == "" && *jsonSchema == "" && *equalsEnv == "" && *jsonLogField == "" {
+		// Any new file, usage within the thresholds, or the free lock will do.
+		pollerOpts = append(pollerOpts, poller.WithMatcher(matcher.NonEmptyMatcher{}))
+	}
+
+	if *progressRe != "" {
+		re, err := regexp.Compile(*progressRe)
+		if err != nil || re.NumSubexp() < 1 {
+			fmt.Fprintln(os.Stderr, "Error: --progress-regex must be a valid regex with a capture group.")
+			exit(1)
+		}
+		pollerOpts = append(pollerOpts, poller.WithAdaptiveInterval(re, *minInterval))
+	}
+	if listener != nil {
+		pollerOpts = append(pollerOpts, poller.WithTrigger(listener.C()))
+		if *pattern == "" && len(stdinPatterns) == 0 && *xpathExpr == "" && *jsonSchema == "" && *equalsEnv == "" && *jsonLogField == "" {
+			// Any request will do, even without a body.
+			pollerOpts = append(pollerOpts, poller.WithMatcher(receivedMatcher{listener}))
+		}
+	}
+	if *triggerFile != "" {
+		trigger, err := watcher.NewTrigger(*triggerFile)
+		if err != nil {
+			// The interval still drives the checks, so this is not fatal.
+			fmt.Fprintf(os.Stderr, "Warning: cannot watch trigger file, falling back to the interval: %v\n", err)
+		} else {
+			defer trigger.Close()
+			pollerOpts = append(pollerOpts, poller.WithTrigger(trigger.C()))
+		}
+	}
+	if flags := regexFlags(); flags != "" {
+		pollerOpts = append(pollerOpts, poller.WithRegexFlags(flags))
+	}
+	if *passthrough {
+		pollerOpts = append(pollerOpts, poller.WithPassthrough(os.Stdout, *passPrefix))
+	}
+	if *annotate {
+		pollerOpts = append(pollerOpts, poller.WithAnnotate())
+	}
+	if *dedupLog {
+		pollerOpts = append(pollerOpts, poller.WithDedupLog())
+	}
+	if *maxEmpty > 0 {
+		pollerOpts = append(pollerOpts, poller.WithMaxEmpty(*maxEmpty))
+	}
+	if *backoffMode == "anchored" {
+		pollerOpts = append(pollerOpts, poller.WithAnchoredBackoff())
+		thenOpts = append(thenOpts, poller.WithAnchoredBackoff())
+	}
+	if *maxDelay > 0 {
+		pollerOpts = append(pollerOpts, poller.WithMaxDelay(*maxDelay))
+		thenOpts = append(thenOpts, poller.WithMaxDelay(*maxDelay))
+	}
+	if *maxWaitTotal > 0 {
+		pollerOpts = append(pollerOpts, poller.WithMaxWaitTotal(*maxWaitTotal))
+	}
+	if *finalCheck {
+		pollerOpts = append(pollerOpts, poller.WithFinalCheck())
+	}
+	if *timeoutGrace > 0 {
+		pollerOpts = append(pollerOpts, poller.WithTimeoutGrace(*timeoutGrace))
+	}
+	if *patternTimeout > 0 {
+		pollerOpts = append(pollerOpts, poller.WithPatternTimeout(*patternTimeout))
+	}
+	if *settle > 0 {
+		pollerOpts = append(pollerOpts, poller.WithSettle(*settle))
+	}
+	if *minElapsed > 0 {
+		pollerOpts = append(pollerOpts, poller.WithMinElapsed(*minElapsed))
+	}
+	if *probeCommand != "" {
+		pollerOpts = append(pollerOpts, poller.WithProbe(func() error {
+			_, err := executor.Capture(*probeCommand, nil)
+			return err
+		}))
+	}
+	if *heartbeatFile != "" {
+		pollerOpts = append(pollerOpts, poller.WithHeartbeat(*heartbeatFile))
+	}
+
+	// --- Success and Fail Commands ---
+	successRunner := &executor.Runner{SuccessCodes: *successCodes, Repeat: *repeatSuccess}
+	failRunner := &executor.Runner{SuccessCodes: *failCodes}
+	if *teeFile != "" {
+		f, err := os.Create(*teeFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating tee file: %v\n", err)
+			exit(1)
+		}
+		onExit(func() { f.Close() })
+		successRunner.Stdout = io.MultiWriter(os.Stdout, f)
+		successRunner.Stderr = io.MultiWriter(os.Stderr, f)
+	}
 
 	// --- Run the Poller ---
-	poller := poller.New(w, *pattern, *verbose, *regex, *ignoreCase)
+	poller := poller.New(w, *pattern, *verbose, *regex, *ignoreCase, pollerOpts...)
+
+	// stage is the poller of the current stage, the second one with --then-wait.
+	stage := poller
+	if *junitFile != "" {
+		// Written however watchfor exits, including when interrupted.
+		start := time.Now()
+		onExit(func() { writeJUnit(*junitFile, stage, time.Since(start)) })
+	}
+
+	if *setupCommand != "" {
+		if err := (&executor.Runner{}).Execute(*setupCommand); err != nil {
+			fmt.Fprintf(os.Stderr, "Error executing setup command: %v\n", err)
+			exit(1)
+		}
+	}
 
 	// Create a context for the timeout
 	ctx, cancel := context.WithCancel(context.Background())
@@ -121,21 +963,343 @@ func main() {
 	}
 	defer cancel()
 
+	// statusEnv lets the commands run after a stage know how the wait went.
+	statusEnv := func(success bool) []string {
+		env := stage.Status().Env()
+		if listener != nil && success {
+			env = append(env, "WATCHFOR_REQUEST_BODY="+string(listener.LastBody()))
+		}
+		return env
+	}
+
 	success := poller.Run(ctx, *interval, *maxRetries, *backoff, *jitter)
+	if listener != nil {
+		listener.Close()
+	}
+	if success && *onMatch != "" {
+		// Run as soon as the pattern matches, before any --then-wait stage.
+		if err := (&executor.Runner{Env: statusEnv(success)}).Execute(*onMatch); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: --on-match command failed: %v\n", err)
+		}
+	}
+	if success && *thenWait {
+		stage, success = waitThen(ctx, strings.Join(successCommandArgs, " "), thenOpts)
+	}
+
+	announceCompletion(success)
+
+	outcomeEnv := statusEnv(success)
+	hookRunner := &executor.Runner{Env: outcomeEnv}
+	successRunner.Env = outcomeEnv
+	failRunner.Env = outcomeEnv
+
+	// resultCode is the exit code for the outcome of the wait, once the success
+	// or fail commands have run.
+	resultCode := func() int {
+		code := 1
+		if success != *exitInvert {
+			code = 0
+		}
+		return exitCodes.Code(stage.StopReason(), code)
+	}
 
 	if success {
-		fmt.Println("\n✅ Success: Executing success command.")
+		if *noExec || *thenWait {
+			printBanner("success", "Success.")
+			exit(resultCode())
+		}
 		successCmdStr := strings.Join(successCommandArgs, " ")
-		if err := executor.Execute(successCmdStr); err != nil {
+		if *templateCmd {
+			match, _ := stage.LastMatch()
+			rendered, err := executor.Render(successCmdStr, match)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: --template-command: %v\n", err)
+				exit(1)
+			}
+			successCmdStr = rendered
+		}
+		if *confirmInteractive && successCmdStr != "" && confirm.IsTerminal(os.Stdin) {
+			confirmSuccess(successCmdStr)
+		}
+		if *lockFile != "" {
+			lock := acquireLock(*lockFile, *lockTimeout)
+			onExit(func() { lock.Unlock() })
+		}
+		printBanner("success", "Success: Executing success command.")
+		if err := successRunner.Execute(successCmdStr); err != nil {
 			fmt.Fprintf(os.Stderr, "Error executing success command: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
+		exit(resultCode())
 	} else {
-		fmt.Println("\n❌ Failure: Executing fail command.")
-		if err := executor.Execute(*failCommand); err != nil {
-			fmt.Fprintf(os.Stderr, "Error executing fail command: %v\n", err)
-			os.Exit(1)
+		if *dumpFile != "" {
+			if err := os.WriteFile(*dumpFile, stage.LastOutput(), 0644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing failure dump: %v\n", err)
+			}
+		}
+		if *noExec {
+			printBanner("fail", "Failure.")
+			exit(resultCode())
+		}
+		printBanner("fail", "Failure: Executing fail command.")
+		if err := failRunner.ExecuteAll(*failCommands); err != nil {
+			fmt.Fprintf(os.Stderr, "Error executing fail commands:\n%v\n", err)
+			if *failEscalate != "" {
+				printBanner("escalate", "Escalating: Executing escalation command.")
+				if err := hookRunner.Execute(*failEscalate); err != nil {
+					fmt.Fprintf(os.Stderr, "Error executing escalation command: %v\n", err)
+				}
+			}
+			exit(1)
+		}
+		exit(resultCode()) // Exit with a non-zero code on failure
+	}
+}
+
+// waitThen runs the second stage of --then-wait: it polls the output of the
+// success command for --then-pattern, with the same schedule, until what is left
+// of the timeout runs out. It returns the stage's poller and whether it matched.
+func waitThen(ctx context.Context, command string, opts []poller.Option) (*poller.Poller, bool) {
+	fmt.Printf("Waiting for the success command's output to contain %q.\n", *thenPattern)
+	w := watcher.NewCommandWatcher(command)
+	defer w.Close()
+	onExit(func() { w.Close() })
+
+	if *regexDotAll || *regexMultiline {
+		opts = append(opts, poller.WithRegexFlags(regexFlags()))
+	}
+	p := poller.New(w, *thenPattern, *verbose, *regex, *ignoreCase, opts...)
+	return p, p.Run(ctx, *interval, *maxRetries, *backoff, *jitter)
+}
+
+// writeJUnit writes the outcome of the wait run by p to path as a JUnit report.
+// The test case passes if the wait succeeded, taking --exit-invert into account.
+func writeJUnit(path string, p *poller.Poller, elapsed time.Duration) {
+	s := p.Status()
+	tc := junit.TestCase{Name: waitName(), ClassName: "watchfor", Duration: elapsed}
+	switch {
+	case s.Reason == "":
+		tc.Failure = fmt.Sprintf("the wait did not complete (attempts: %d)", s.Attempt)
+		tc.FailureType = "incomplete"
+	case (s.Reason == poller.ReasonMatched) == *exitInvert:
+		tc.Failure = fmt.Sprintf("stopped by %s (attempts: %d)", s.Reason, s.Attempt)
+		tc.FailureType = string(s.Reason)
+		tc.Details = string(p.LastOutput())
+	}
+	if err := junit.WriteFile(path, "watchfor", tc); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing JUnit report: %v\n", err)
+	}
+}
+
+// waitName describes the condition waited for, to name the test case of
+// --junit-file.
+func waitName() string {
+	switch {
+	case *pattern != "":
+		return fmt.Sprintf("wait for %q", *pattern)
+	case *equalsEnv != "":
+		return fmt.Sprintf("wait for output equal to $%s", *equalsEnv)
+	case *jsonLogField != "":
+		return fmt.Sprintf("wait for %s containing %q", *jsonLogField, *jsonLogText)
+	case *xpathExpr != "":
+		return fmt.Sprintf("wait for xpath %q", *xpathExpr)
+	case *jsonSchema != "":
+		return fmt.Sprintf("wait for JSON valid against %s", *jsonSchema)
+	default:
+		return "wait"
+	}
+}
+
+// bannerSymbols prefix the result banners, by kind of banner.
+var bannerSymbols = map[string]string{
+	"success":  "✅",
+	"fail":     "❌",
+	"escalate": "🚨",
+}
+
+// setSymbols applies --no-emoji, then the overrides from --symbols.
+func setSymbols(ascii bool, overrides map[string]string) error {
+	if ascii {
+		bannerSymbols = map[string]string{
+			"success":  "[OK]",
+			"fail":     "[FAIL]",
+			"escalate": "[ESCALATE]",
+		}
+	}
+	for kind, symbol := range overrides {
+		if _, ok := bannerSymbols[kind]; !ok {
+			return fmt.Errorf("unknown banner %q, expected success, fail or escalate", kind)
+		}
+		bannerSymbols[kind] = symbol
+	}
+	return nil
+}
+
+// printBanner prints a result banner, preceded by a blank line.
+func printBanner(kind, text string) {
+	if symbol := bannerSymbols[kind]; symbol != "" {
+		text = symbol + " " + text
+	}
+	fmt.Println("\n" + text)
+}
+
+// announceCompletion rings the bell and shows a desktop notification, if requested
+// and a human is likely watching.
+func announceCompletion(success bool) {
+	if !confirm.IsTerminal(os.Stdout) {
+		return
+	}
+	if *bell {
+		fmt.Print("\a")
+	}
+	if *notifyDesktop {
+		message := "Pattern found."
+		if !success {
+			message = "Gave up waiting for the pattern."
+		}
+		if err := notify.Desktop("watchfor", message); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: desktop notification failed: %v\n", err)
+		}
+	}
+}
+
+// confirmSuccess asks whether to run the success command, exiting if the user declines.
+func confirmSuccess(command string) {
+	ok, err := confirm.Ask(os.Stdin, os.Stdout, fmt.Sprintf("\nPattern found. Run %q?", command), *confirmTimeout)
+	if errors.Is(err, confirm.ErrTimeout) {
+		fmt.Printf("No answer after %s.\n", *confirmTimeout)
+		ok = *confirmTimeoutAct == "proceed"
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading confirmation: %v\n", err)
+	}
+	if !ok {
+		fmt.Println("Aborted: the success command was not confirmed.")
+		exit(1)
+	}
+}
+
+// acquireLock waits for the lock file, exiting with an error if it cannot be acquired in time.
+func acquireLock(path string, timeout time.Duration) *filelock.Lock {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if *verbose {
+		fmt.Printf("Waiting for lock %s...\n", path)
+	}
+	lock, err := filelock.Acquire(ctx, path, 100*time.Millisecond)
+	if errors.Is(err, filelock.ErrLocked) {
+		fmt.Fprintf(os.Stderr, "Error: could not acquire lock %s within %s.\n", path, timeout)
+		exit(1)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Error acquiring lock %s: %v\n", path, err)
+		exit(1)
+	}
+	return lock
+}
+
+// configFiles are the config files applied, from the highest precedence.
+var configFiles []string
+
+// applyConfigFiles sets the flags not given on the command line from --config,
+// then from the global config file, if there is one.
+func applyConfigFiles() error {
+	var paths []string
+	if *configFile != "" {
+		paths = append(paths, *configFile)
+	}
+	if global, err := config.GlobalPath(); err == nil {
+		if _, err := os.Stat(global); err == nil {
+			paths = append(paths, global)
+		}
+	}
+	for _, path := range paths {
+		settings, err := config.Load(path)
+		if err == nil {
+			err = config.Apply(pflag.CommandLine, settings)
+		}
+		if err != nil {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+		configFiles = append(configFiles, path)
+	}
+	return nil
+}
+
+// commandOptions returns the command watcher options set by --stdout-only.
+func commandOptions() []watcher.CommandOption {
+	if !*stdoutOnly {
+		return nil
+	}
+	if *verbose {
+		return []watcher.CommandOption{watcher.WithStderr(os.Stderr)}
+	}
+	return []watcher.CommandOption{watcher.WithStderr(io.Discard)}
+}
+
+// mqttOptions returns the MQTT watcher options set by the --mqtt-* flags.
+func mqttOptions() []watcher.MQTTOption {
+	opts := []watcher.MQTTOption{watcher.WithMQTTQoS(byte(*mqttQoS))}
+	if *mqttUsername != "" || *mqttPassword != "" {
+		opts = append(opts, watcher.WithMQTTCredentials(*mqttUsername, *mqttPassword))
+	}
+	return opts
+}
+
+// presenceSource reports whether the --source spec uses one of the schemes,
+// whose sources need no pattern: any output, or request, means ready.
+func presenceSource(source string, schemes ...string) bool {
+	scheme, _, ok := strings.Cut(source, "://")
+	return ok && slices.Contains(schemes, scheme)
+}
+
+// receivedMatcher matches as soon as a --listen request arrives, whatever its
+// body, when there is no pattern.
+type receivedMatcher struct {
+	listener *watcher.ListenWatcher
+}
+
+func (m receivedMatcher) Match([]byte) (bool, error) {
+	return m.listener.Received(), nil
+}
+
+// regexFlags returns the flags set by --regex-dotall and --regex-multiline.
+func regexFlags() string {
+	var flags string
+	if *regexDotAll {
+		flags += "s"
+	}
+	if *regexMultiline {
+		flags += "m"
+	}
+	return flags
+}
+
+// durationFlag defines a duration flag that accepts both Go-style and ISO8601 values.
+func durationFlag(name string, value time.Duration, usage string) *time.Duration {
+	p := new(time.Duration)
+	pflag.Var(duration.NewValue(value, p), name, usage)
+	return p
+}
+
+// readScript reads a whole script, without its trailing newlines.
+func readScript(r io.Reader) (string, error) {
+	script, err := io.ReadAll(r)
+	return strings.TrimRight(string(script), "\r\n"), err
+}
+
+// readPatterns reads one pattern per line, skipping blank lines.
+func readPatterns(r io.Reader) ([]string, error) {
+	var patterns []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			patterns = append(patterns, line)
 		}
-		os.Exit(1) // Exit with a non-zero code on failure
 	}
+	return patterns, scanner.Err()
 }
@@ -0,0 +1,218 @@
+package main_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// binary is the watchfor executable built for the tests.
+var binary string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "watchfor-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	binary = filepath.Join(dir, "watchfor")
+	if out, err := exec.Command("go", "build", "-o", binary, ".").CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "building watchfor: %v\n%s", err, out)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// run runs watchfor in dir with the given arguments, and returns its combined
+// output and exit code.
+func run(t *testing.T, dir string, args ...string) (string, int) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on sh")
+	}
+	cmd := exec.Command(binary, args...)
+	cmd.Dir = dir
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatalf("Running watchfor failed: %v", err)
+	}
+	return out.String(), cmd.ProcessState.ExitCode()
+}
+
+// readFile returns the content of a file written by a command, or "" if there
+// is none.
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	return string(data)
+}
+
+func TestOnMatch(t *testing.T) {
+	dir := t.TempDir()
+	out, code := run(t, dir, "-c", "echo ready", "-p", "ready", "--interval", "10ms",
+		"--on-match", "echo match $WATCHFOR_REASON >> log", "--", "echo success >> log")
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, got %d:\n%s", code, out)
+	}
+	if log := readFile(t, filepath.Join(dir, "log")); log != "match matched\nsuccess\n" {
+		t.Errorf("Expected --on-match to run before the success command, got %q", log)
+	}
+
+	out, code = run(t, dir, "-c", "echo booting", "-p", "ready", "--interval", "10ms", "--max-retries", "2",
+		"--on-match", "echo match > nomatch")
+	if code != 1 {
+		t.Fatalf("Expected exit code 1, got %d:\n%s", code, out)
+	}
+	if log := readFile(t, filepath.Join(dir, "nomatch")); log != "" {
+		t.Errorf("Expected --on-match not to run without a match, got %q", log)
+	}
+}
+
+func TestExitInvert(t *testing.T) {
+	dir := t.TempDir()
+	out, code := run(t, dir, "-c", "echo ready", "-p", "ready", "--interval", "10ms", "--exit-invert",
+		"--", "echo success > log")
+	if code != 1 {
+		t.Fatalf("Expected exit code 1 on a match, got %d:\n%s", code, out)
+	}
+	if log := readFile(t, filepath.Join(dir, "log")); log != "success\n" {
+		t.Errorf("Expected the success command to run anyway, got %q", log)
+	}
+
+	out, code = run(t, dir, "-c", "echo booting", "-p", "ready", "--interval", "10ms", "--max-retries", "2",
+		"--exit-invert", "--on-fail", "echo fail > log")
+	if code != 0 {
+		t.Fatalf("Expected exit code 0 without a match, got %d:\n%s", code, out)
+	}
+	if log := readFile(t, filepath.Join(dir, "log")); log != "fail\n" {
+		t.Errorf("Expected the fail command to run anyway, got %q", log)
+	}
+}
+
+func TestNoExec(t *testing.T) {
+	dir := t.TempDir()
+	out, code := run(t, dir, "-c", "echo ready", "-p", "ready", "--interval", "10ms", "--no-exec",
+		"--", "echo success > log")
+	if code != 0 {
+		t.Fatalf("Expected exit code 0 on a match, got %d:\n%s", code, out)
+	}
+	out, code = run(t, dir, "-c", "echo booting", "-p", "ready", "--interval", "10ms", "--max-retries", "2",
+		"--no-exec", "--on-fail", "echo fail > log")
+	if code != 1 {
+		t.Fatalf("Expected exit code 1 without a match, got %d:\n%s", code, out)
+	}
+	if log := readFile(t, filepath.Join(dir, "log")); log != "" {
+		t.Errorf("Expected no command to run, got %q", log)
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{"No Emoji", []string{"--no-emoji"}, "[OK] Success."},
+		{"Override", []string{"--symbols", "success=YAY"}, "YAY Success."},
+		{"Removed", []string{"--symbols", "success="}, "\nSuccess."},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			args := append([]string{"-c", "echo ready", "-p", "ready", "--interval", "10ms", "--no-exec"}, tc.args...)
+			out, code := run(t, t.TempDir(), args...)
+			if code != 0 {
+				t.Fatalf("Expected exit code 0, got %d:\n%s", code, out)
+			}
+			if !strings.Contains(out, tc.expected) {
+				t.Errorf("Expected the banner %q, got:\n%s", tc.expected, out)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	out, code := run(t, dir, "--validate", "-c", "echo ready > checked", "-p", "ready")
+	if code != 0 || !strings.Contains(out, "All checks passed.") {
+		t.Fatalf("Expected the checks to pass, got exit code %d:\n%s", code, out)
+	}
+	if log := readFile(t, filepath.Join(dir, "checked")); log != "" {
+		t.Errorf("Expected --validate not to run the command, got %q", log)
+	}
+
+	out, code = run(t, dir, "--validate", "-f", "missing.log", "-p", "ready")
+	if code != 1 || !strings.Contains(out, `FAIL  file "missing.log"`) {
+		t.Errorf("Expected the missing file to fail the checks, got exit code %d:\n%s", code, out)
+	}
+}
+
+func TestThenWait(t *testing.T) {
+	testCases := []struct {
+		name        string
+		thenPattern string
+		expected    int
+	}{
+		{"Second Stage Matches", "deployed", 0},
+		{"Second Stage Fails", "rolled back", 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, code := run(t, t.TempDir(), "-c", "echo ready", "-p", "ready", "--interval", "10ms", "--max-retries", "2",
+				"--then-wait", "--then-pattern", tc.thenPattern, "--", "echo deployed")
+			if code != tc.expected {
+				t.Errorf("Expected exit code %d, got %d:\n%s", tc.expected, code, out)
+			}
+		})
+	}
+}
+
+func TestSetup(t *testing.T) {
+	dir := t.TempDir()
+	out, code := run(t, dir, "-c", "cat status", "-p", "ready", "--interval", "10ms", "--max-retries", "1",
+		"--setup", "echo ready > status")
+	if code != 0 {
+		t.Fatalf("Expected --setup to run before the first check, got exit code %d:\n%s", code, out)
+	}
+
+	out, code = run(t, dir, "-c", "echo ready > checked", "-p", "ready", "--interval", "10ms",
+		"--setup", "exit 3")
+	if code != 1 {
+		t.Fatalf("Expected exit code 1 when --setup fails, got %d:\n%s", code, out)
+	}
+	if log := readFile(t, filepath.Join(dir, "checked")); log != "" {
+		t.Errorf("Expected no check after --setup fails, got %q", log)
+	}
+}
+
+func TestProfilesWrittenOnEarlyExit(t *testing.T) {
+	dir := t.TempDir()
+	// A pid file that cannot be written stops watchfor after profiling starts.
+	out, code := run(t, dir, "-c", "echo ready", "-p", "ready", "--cpuprofile", "cpu.prof", "--memprofile", "mem.prof",
+		"--pidfile", filepath.Join("missing", "watchfor.pid"))
+	if code != 1 {
+		t.Fatalf("Expected exit code 1, got %d:\n%s", code, out)
+	}
+	for _, name := range []string{"cpu.prof", "mem.prof"} {
+		if readFile(t, filepath.Join(dir, name)) == "" {
+			t.Errorf("Expected %s to hold a profile", name)
+		}
+	}
+}
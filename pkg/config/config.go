@@ -0,0 +1,122 @@
+// Package config reads config files that give default values for flags, such
+// as the interval or backoff a team wants every wait to use.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// reserved are the flags that only make sense on the command line.
+var reserved = []string{"config", "help", "version"}
+
+// Setting is a flag value given by a config file. Repeatable flags may be
+// given several values.
+type Setting struct {
+	Flag   string
+	Values []string
+}
+
+// GlobalPath returns the path of the global config file, watchfor/config.yaml
+// in the user's config directory: $XDG_CONFIG_HOME, or ~/.config, on Linux.
+func GlobalPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "watchfor", "config.yaml"), nil
+}
+
+// Load reads a config file: a YAML mapping of flag names, without the leading
+// dashes, to values, or to lists of values for repeatable flags, e.g.
+//
+//	interval: 2s
+//	backoff: 1.5
+//	no-emoji: true
+//	on-fail: [./notify.sh, ./cleanup.sh]
+//
+// Settings are returned in file order. An empty file has none.
+func Load(path string) ([]Setting, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: expected a mapping of flag names to values", root.Line)
+	}
+
+	var settings []Setting
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		name := key.Value
+		if slices.Contains(reserved, name) {
+			return nil, fmt.Errorf("line %d: --%s cannot be set in a config file", key.Line, name)
+		}
+		if slices.ContainsFunc(settings, func(s Setting) bool { return s.Flag == name }) {
+			return nil, fmt.Errorf("line %d: %q given twice", key.Line, name)
+		}
+		values, err := scalars(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", value.Line, name, err)
+		}
+		settings = append(settings, Setting{Flag: name, Values: values})
+	}
+	return settings, nil
+}
+
+// scalars returns the value of a scalar node, or the values of a list of them.
+func scalars(node *yaml.Node) ([]string, error) {
+	switch {
+	case node.Kind == yaml.ScalarNode && node.Tag != "!!null":
+		return []string{node.Value}, nil
+	case node.Kind == yaml.SequenceNode:
+		values := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode || item.Tag == "!!null" {
+				return nil, errors.New("expected a list of values")
+			}
+			values = append(values, item.Value)
+		}
+		return values, nil
+	}
+	return nil, errors.New("expected a value or a list of values")
+}
+
+// Apply sets the flags of fs from settings, except those already set, on the
+// command line or by a file applied before. Applying files from the highest
+// precedence to the lowest thus lets each override the ones after it. Values
+// are parsed like the flags' own.
+func Apply(fs *pflag.FlagSet, settings []Setting) error {
+	for _, s := range settings {
+		if fs.Lookup(s.Flag) == nil {
+			return fmt.Errorf("unknown flag %q", s.Flag)
+		}
+		if fs.Changed(s.Flag) {
+			continue
+		}
+		for _, value := range s.Values {
+			if err := fs.Set(s.Flag, value); err != nil {
+				return fmt.Errorf("invalid %s %q: %w", s.Flag, value, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/gregory-chatelier/watchfor/pkg/config"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return path
+}
+
+// watchforFlags returns a FlagSet with some of watchfor's real flags, so that
+// the tests use the names documented for config files.
+func watchforFlags() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("watchfor", pflag.ContinueOnError)
+	fs.Duration("interval", time.Second, "")
+	fs.Float64("backoff", 1, "")
+	fs.Duration("max-delay", 0, "")
+	fs.Float64("jitter", 0, "")
+	fs.Int("max-retries", 10, "")
+	fs.Bool("no-emoji", false, "")
+	fs.StringArray("on-fail", nil, "")
+	return fs
+}
+
+func TestLoad(t *testing.T) {
+	settings, err := config.Load(writeConfig(t, `
+# Shared defaults.
+interval: 2s
+backoff: 1.5
+no-emoji: true
+on-fail: [./notify.sh, "./cleanup.sh --all"]
+`))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	expected := []config.Setting{
+		{Flag: "interval", Values: []string{"2s"}},
+		{Flag: "backoff", Values: []string{"1.5"}},
+		{Flag: "no-emoji", Values: []string{"true"}},
+		{Flag: "on-fail", Values: []string{"./notify.sh", "./cleanup.sh --all"}},
+	}
+	if !slices.EqualFunc(settings, expected, func(a, b config.Setting) bool {
+		return a.Flag == b.Flag && slices.Equal(a.Values, b.Values)
+	}) {
+		t.Errorf("Expected %v, got %v", expected, settings)
+	}
+
+	if settings, err := config.Load(writeConfig(t, "# Nothing yet.\n")); err != nil || len(settings) != 0 {
+		t.Errorf("Expected no settings for an empty file, got %v, %v", settings, err)
+	}
+
+	for content, want := range map[string]string{
+		"- interval\n":                 "expected a mapping",
+		"interval: 1s\ninterval: 2s\n": `line 2: "interval" given twice`,
+		"interval:\n":                  "expected a value",
+		"env: {A: 1}\n":                "expected a value",
+		"env: [[A=1]]\n":               "expected a list of values",
+		"config: other.yaml\n":         "cannot be set in a config file",
+		"interval: [1s\n":              "yaml",
+	} {
+		_, err := config.Load(writeConfig(t, content))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: expected an error containing %q, got %v", content, want, err)
+		}
+	}
+}
+
+// TestApply_Precedence checks the chain: builtin defaults < global config <
+// --config file < command line.
+func TestApply_Precedence(t *testing.T) {
+	fs := watchforFlags()
+	if err := fs.Parse([]string{"--interval", "5s"}); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	explicit, err := config.Load(writeConfig(t, "interval: 3s\nbackoff: 2\non-fail: [./a.sh]\n"))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	global, err := config.Load(writeConfig(t, "interval: 4s\nbackoff: 3\njitter: 0.2\nno-emoji: true\non-fail: [./b.sh, ./c.sh]\n"))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	for _, settings := range [][]config.Setting{explicit, global} {
+		if err := config.Apply(fs, settings); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+	}
+	interval, _ := fs.GetDuration("interval")
+	backoff, _ := fs.GetFloat64("backoff")
+	jitter, _ := fs.GetFloat64("jitter")
+	retries, _ := fs.GetInt("max-retries")
+	noEmoji, _ := fs.GetBool("no-emoji")
+	fails, _ := fs.GetStringArray("on-fail")
+
+	if interval != 5*time.Second {
+		t.Errorf("Expected the command line interval, got %v", interval)
+	}
+	if backoff != 2 {
+		t.Errorf("Expected the --config backoff, got %v", backoff)
+	}
+	if jitter != 0.2 || !noEmoji {
+		t.Errorf("Expected the global jitter and no-emoji, got %v, %v", jitter, noEmoji)
+	}
+	if retries != 10 {
+		t.Errorf("Expected the builtin max-retries, got %v", retries)
+	}
+	if !slices.Equal(fails, []string{"./a.sh"}) {
+		t.Errorf("Expected the --config fail commands only, got %q", fails)
+	}
+}
+
+func TestApply_Errors(t *testing.T) {
+	fs := watchforFlags()
+
+	err := config.Apply(fs, []config.Setting{{Flag: "intervall", Values: []string{"2s"}}})
+	if err == nil || !strings.Contains(err.Error(), `unknown flag "intervall"`) {
+		t.Errorf("Expected an unknown flag error, got %v", err)
+	}
+	err = config.Apply(fs, []config.Setting{{Flag: "interval", Values: []string{"soon"}}})
+	if err == nil || !strings.Contains(err.Error(), `invalid interval "soon"`) {
+		t.Errorf("Expected an invalid value error, got %v", err)
+	}
+}
+
+// TestApply_ReadmeExample applies the config file example of the README, so
+// that it only uses flags that exist.
+func TestApply_ReadmeExample(t *testing.T) {
+	readme, err := os.ReadFile("../../README.md")
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	_, section, _ := strings.Cut(string(readme), "### Config Files")
+	_, example, found := strings.Cut(section, "```yaml\n")
+	example, _, _ = strings.Cut(example, "```")
+	if !found {
+		t.Fatal("Expected a YAML example in the Config Files section")
+	}
+
+	settings, err := config.Load(writeConfig(t, example))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	fs := watchforFlags()
+	if err := config.Apply(fs, settings); err != nil {
+		t.Errorf("Apply failed: %v", err)
+	}
+	if fails, _ := fs.GetStringArray("on-fail"); len(fails) != 2 {
+		t.Errorf("Expected the example's two on-fail commands, got %q", fails)
+	}
+}
+
+func TestGlobalPath(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("XDG_CONFIG_HOME is only used on Linux")
+	}
+	t.Setenv("XDG_CONFIG_HOME", "/etc/xdg-test")
+	path, err := config.GlobalPath()
+	if err != nil || path != "/etc/xdg-test/watchfor/config.yaml" {
+		t.Errorf("Expected the path under XDG_CONFIG_HOME, got %q, %v", path, err)
+	}
+}
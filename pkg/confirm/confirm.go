@@ -0,0 +1,61 @@
+package confirm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// ErrTimeout is returned by Ask when no answer is given in time.
+var ErrTimeout = errors.New("no answer before the timeout")
+
+// Ask writes a yes/no question to out and reads a line from in. Only "y" or "yes",
+// in any case, confirm; an empty answer or end of input declines. With a positive
+// timeout, ErrTimeout is returned if no answer arrives in time. The read is then
+// abandoned, so in should not be used again.
+func Ask(in io.Reader, out io.Writer, question string, timeout time.Duration) (bool, error) {
+	fmt.Fprintf(out, "%s [y/N] ", question)
+
+	answers := make(chan string, 1)
+	errs := make(chan error, 1)
+	go func() {
+		line, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+			errs <- err
+			return
+		}
+		answers <- line
+	}()
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		deadline = time.After(timeout)
+	}
+
+	select {
+	case answer := <-answers:
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes", nil
+	case err := <-errs:
+		fmt.Fprintln(out)
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		return false, err
+	case <-deadline:
+		fmt.Fprintln(out)
+		return false, ErrTimeout
+	}
+}
+
+// IsTerminal reports whether f is attached to a terminal rather than a pipe, a
+// file or a device such as /dev/null.
+func IsTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
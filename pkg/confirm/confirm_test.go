@@ -0,0 +1,85 @@
+package confirm_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gregory-chatelier/watchfor/pkg/confirm"
+)
+
+func TestAsk(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected bool
+	}{
+		{"Yes", "y\n", true},
+		{"Full Yes", "YES\n", true},
+		{"Yes Without Newline", "yes", true},
+		{"No", "n\n", false},
+		{"Empty Answer", "\n", false},
+		{"Anything Else", "sure\n", false},
+		{"End Of Input", "", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			ok, err := confirm.Ask(strings.NewReader(tc.input), &out, "Run it?", time.Second)
+			if err != nil {
+				t.Fatalf("Ask failed: %v", err)
+			}
+			if ok != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, ok)
+			}
+			if !strings.HasPrefix(out.String(), "Run it? [y/N] ") {
+				t.Errorf("Expected the question to be printed, got '%s'", out.String())
+			}
+		})
+	}
+}
+
+func TestAsk_Timeout(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	start := time.Now()
+	ok, err := confirm.Ask(r, io.Discard, "Run it?", 20*time.Millisecond)
+	if !errors.Is(err, confirm.ErrTimeout) {
+		t.Errorf("Expected ErrTimeout, got %v", err)
+	}
+	if ok {
+		t.Error("Expected a timeout not to confirm")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected Ask to return at the timeout, took %s", elapsed)
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if confirm.IsTerminal(f) {
+		t.Error("Expected a regular file not to be a terminal")
+	}
+
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+
+	if confirm.IsTerminal(devNull) {
+		t.Error("Expected the null device not to be a terminal")
+	}
+}
@@ -0,0 +1,83 @@
+package duration
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isoPattern matches the week, day and time components of an ISO8601 duration.
+// Years and months are rejected, as their length depends on the calendar.
+var isoPattern = regexp.MustCompile(`^P(?:([\d.,]+)W)?(?:([\d.,]+)D)?(?:T(?:([\d.,]+)H)?(?:([\d.,]+)M)?(?:([\d.,]+)S)?)?$`)
+
+// isoUnits are the durations of the components captured by isoPattern, in order.
+var isoUnits = []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+
+// Parse parses a Go-style duration (e.g. `5s`, `1m30s`) or an ISO8601
+// duration (e.g. `PT5S`, `P1DT2H`).
+func Parse(s string) (time.Duration, error) {
+	if !strings.HasPrefix(strings.ToUpper(s), "P") {
+		return time.ParseDuration(s)
+	}
+	return parseISO(strings.ToUpper(s))
+}
+
+func parseISO(s string) (time.Duration, error) {
+	m := isoPattern.FindStringSubmatch(s)
+	if m == nil || s == "P" || strings.HasSuffix(s, "T") {
+		// Before the T designator, M means months.
+		if strings.ContainsAny(strings.SplitN(s, "T", 2)[0], "YM") {
+			return 0, fmt.Errorf("invalid ISO8601 duration %q: years and months are not supported", s)
+		}
+		return 0, fmt.Errorf("invalid ISO8601 duration %q", s)
+	}
+
+	var total float64
+	for i, value := range m[1:] {
+		if value == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ISO8601 duration %q: %w", s, err)
+		}
+		total += n * float64(isoUnits[i])
+	}
+
+	if total > math.MaxInt64 {
+		return 0, fmt.Errorf("invalid ISO8601 duration %q: out of range", s)
+	}
+	return time.Duration(total), nil
+}
+
+// Value is a pflag.Value for durations accepting both Go-style and ISO8601 formats.
+type Value time.Duration
+
+// NewValue sets p to the default value and returns a Value that updates it.
+func NewValue(value time.Duration, p *time.Duration) *Value {
+	*p = value
+	return (*Value)(p)
+}
+
+// Set parses and stores the duration.
+func (v *Value) Set(s string) error {
+	d, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*v = Value(d)
+	return nil
+}
+
+// String returns the duration in Go format.
+func (v *Value) String() string {
+	return time.Duration(*v).String()
+}
+
+// Type returns the type name shown in the usage message.
+func (v *Value) Type() string {
+	return "duration"
+}
@@ -0,0 +1,67 @@
+package duration_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gregory-chatelier/watchfor/pkg/duration"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected time.Duration
+	}{
+		{"5s", 5 * time.Second},
+		{"1m30s", 90 * time.Second},
+		{"250ms", 250 * time.Millisecond},
+		{"PT5S", 5 * time.Second},
+		{"PT5M", 5 * time.Minute},
+		{"PT1H30M", 90 * time.Minute},
+		{"P1DT2H", 26 * time.Hour},
+		{"P1W", 7 * 24 * time.Hour},
+		{"PT0.5S", 500 * time.Millisecond},
+		{"PT1,5S", 1500 * time.Millisecond},
+		{"pt10s", 10 * time.Second},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			d, err := duration.Parse(tc.input)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if d != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, d)
+			}
+		})
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, input := range []string{"", "5", "abc", "P", "PT", "P1Y", "P2M", "PT5X", "PT1.2.3S", "5S"} {
+		t.Run(input, func(t *testing.T) {
+			if _, err := duration.Parse(input); err == nil {
+				t.Errorf("Expected an error for %q, got nil", input)
+			}
+		})
+	}
+}
+
+func TestValue(t *testing.T) {
+	var d time.Duration
+	v := duration.NewValue(time.Second, &d)
+
+	if d != time.Second || v.String() != "1s" {
+		t.Fatalf("Expected default 1s, got %s", v.String())
+	}
+	if err := v.Set("PT2M"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if d != 2*time.Minute {
+		t.Errorf("Expected 2m, got %s", d)
+	}
+	if err := v.Set("soon"); err == nil {
+		t.Error("Expected an error for an invalid value, got nil")
+	}
+}
@@ -0,0 +1,79 @@
+package envfile_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gregory-chatelier/watchfor/pkg/envfile"
+)
+
+func TestParse(t *testing.T) {
+	input := `# Database settings
+DB_HOST=localhost
+DB_PORT = 5432 # the default port
+
+export API_URL=https://api.example.com/v1?a=b
+GREETING="hello \"world\"\nbye"
+LITERAL='$HOME \n stays'
+EMPTY=
+QUOTED_HASH="a # b" # comment
+`
+	env, err := envfile.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	expected := []string{
+		"DB_HOST=localhost",
+		"DB_PORT=5432",
+		"API_URL=https://api.example.com/v1?a=b",
+		"GREETING=hello \"world\"\nbye",
+		`LITERAL=$HOME \n stays`,
+		"EMPTY=",
+		"QUOTED_HASH=a # b",
+	}
+	if !slices.Equal(env, expected) {
+		t.Errorf("Expected %q, got %q", expected, env)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"Missing Equals", "A=1\nJUST_A_KEY\n", "line 2: expected KEY=VALUE"},
+		{"Invalid Name", "\n\n1BAD=x\n", "line 3: invalid variable name"},
+		{"Unterminated Quote", `A="open`, "line 1: unterminated \" quote"},
+		{"Trailing Garbage", `A='x' y`, "line 1: unexpected"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := envfile.Parse(strings.NewReader(tc.input))
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("Expected an error containing '%s', got: %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte("A=1\nB\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := envfile.Load(path)
+	if err == nil || !strings.Contains(err.Error(), path+": line 2") {
+		t.Errorf("Expected the error to name the file and line, got: %v", err)
+	}
+
+	if _, err := envfile.Load(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Expected an error for a missing file, got nil")
+	}
+}
@@ -1,31 +1,132 @@
 package executor
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"runtime"
+	"slices"
 )
 
+// Runner executes commands with configurable output streams.
+// The zero value streams to the process's stdout and stderr.
+type Runner struct {
+	// Stdout receives the command's standard output. Defaults to os.Stdout.
+	Stdout io.Writer
+	// Stderr receives the command's standard error. Defaults to os.Stderr.
+	Stderr io.Writer
+	// SuccessCodes are the exit codes that count as success. Defaults to 0 only.
+	SuccessCodes []int
+	// Env holds extra `KEY=VALUE` variables added to the command's environment.
+	Env []string
+	// Repeat is how many times Execute runs the command, in sequence. Every run
+	// happens even if an earlier one fails. Defaults to once.
+	Repeat int
+}
+
 // Execute runs a command and streams its output to stdout and stderr.
 func Execute(command string) error {
+	return (&Runner{}).Execute(command)
+}
+
+// Execute runs a command and streams its output to the runner's writers.
+// With Repeat set, it returns the failed runs joined together.
+func (r *Runner) Execute(command string) error {
 	if command == "" {
 		return nil // Nothing to do
 	}
+	if r.Repeat <= 1 {
+		fmt.Printf("\n--- Executing: %s ---\n", command)
+		return r.run(command)
+	}
 
-	fmt.Printf("\n--- Executing: %s ---\n", command)
+	var errs []error
+	for i := 1; i <= r.Repeat; i++ {
+		fmt.Printf("\n--- Executing (%d/%d): %s ---\n", i, r.Repeat, command)
+		if err := r.run(command); err != nil {
+			errs = append(errs, fmt.Errorf("run %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
 
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		// Use powershell -Command on Windows
-		cmd = exec.Command("powershell", "-Command", command)
-	} else {
-		// Use sh -c on Unix-like systems
-		cmd = exec.Command("sh", "-c", command)
+func (r *Runner) run(command string) error {
+	cmd := shellCommand(command)
+	if len(r.Env) > 0 {
+		cmd.Env = append(os.Environ(), r.Env...)
+	}
+	cmd.Stdout = r.Stdout
+	if cmd.Stdout == nil {
+		cmd.Stdout = os.Stdout
 	}
+	cmd.Stderr = r.Stderr
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+
+	return r.checkExitCode(cmd.Run())
+}
 
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// ExecuteAll runs the commands in sequence, carrying on after a failure so every
+// command gets a chance to run. It returns the failures joined together, or nil if
+// all of them succeeded.
+func (r *Runner) ExecuteAll(commands []string) error {
+	var errs []error
+	for _, command := range commands {
+		if err := r.Execute(command); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", command, err))
+		}
+	}
+	return errors.Join(errs...)
+}
 
-	return cmd.Run()
+// checkExitCode maps the command's result onto the allowed exit codes.
+func (r *Runner) checkExitCode(err error) error {
+	if len(r.SuccessCodes) == 0 {
+		return err
+	}
+
+	code := 0
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		return err // The command could not be run at all.
+	}
+
+	if slices.Contains(r.SuccessCodes, code) {
+		return nil
+	}
+	if err == nil {
+		return fmt.Errorf("exit status %d is not an allowed exit code %v", code, r.SuccessCodes)
+	}
+	return err
+}
+
+// Capture runs a command with the given input on its stdin and returns its standard output.
+// If the command fails, its standard error is included in the returned error.
+func Capture(command string, stdin []byte) ([]byte, error) {
+	cmd := shellCommand(command)
+	cmd.Stdin = bytes.NewReader(stdin)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil && stderr.Len() > 0 {
+		err = fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return output, err
+}
+
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		// Use powershell -Command on Windows
+		return exec.Command("powershell", "-Command", command)
+	}
+	// Use sh -c on Unix-like systems
+	return exec.Command("sh", "-c", command)
 }
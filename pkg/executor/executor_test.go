@@ -1,7 +1,12 @@
 package executor_test
 
 import (
+	"bytes"
+	"io"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/gregory-chatelier/watchfor/pkg/executor"
@@ -49,3 +54,155 @@ func TestExecute_EmptyCommand(t *testing.T) {
 		t.Errorf("Expected nil error for empty command, got: %v", err)
 	}
 }
+
+// TestCapture_Stdin tests that the input is passed on stdin and stdout is returned.
+func TestCapture_Stdin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on tr")
+	}
+
+	output, err := executor.Capture("tr a-z A-Z", []byte("ready\n"))
+	if err != nil {
+		t.Fatalf("Expected command to succeed, but got error: %v", err)
+	}
+	if string(output) != "READY\n" {
+		t.Errorf("Expected 'READY\\n', got '%s'", string(output))
+	}
+}
+
+// TestCapture_Failure tests that stderr is included in the error.
+func TestCapture_Failure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on sh syntax")
+	}
+
+	_, err := executor.Capture("echo broken >&2; exit 2", nil)
+	if err == nil {
+		t.Fatal("Expected command to fail, but got nil error")
+	}
+	if !strings.Contains(err.Error(), "broken") {
+		t.Errorf("Expected error to contain stderr, got: %v", err)
+	}
+}
+
+// TestRunner_Execute_Writers tests that output goes to the configured writers.
+func TestRunner_Execute_Writers(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on sh syntax")
+	}
+
+	var stdout, stderr bytes.Buffer
+	r := &executor.Runner{Stdout: &stdout, Stderr: &stderr}
+
+	if err := r.Execute("echo out; echo err >&2"); err != nil {
+		t.Fatalf("Expected command to succeed, but got error: %v", err)
+	}
+	if stdout.String() != "out\n" {
+		t.Errorf("Expected stdout 'out\\n', got '%s'", stdout.String())
+	}
+	if stderr.String() != "err\n" {
+		t.Errorf("Expected stderr 'err\\n', got '%s'", stderr.String())
+	}
+}
+
+// TestRunner_Execute_SuccessCodes tests the exit code allowlist.
+func TestRunner_Execute_SuccessCodes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on sh syntax")
+	}
+
+	testCases := []struct {
+		name         string
+		command      string
+		successCodes []int
+		expectErr    bool
+	}{
+		{"Default Zero Succeeds", "exit 0", nil, false},
+		{"Default Non-Zero Fails", "exit 1", nil, true},
+		{"Allowed Non-Zero Succeeds", "exit 1", []int{0, 1}, false},
+		{"Code Outside Allowlist Fails", "exit 2", []int{0, 1}, true},
+		{"Zero Outside Allowlist Fails", "exit 0", []int{1}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &executor.Runner{SuccessCodes: tc.successCodes}
+			err := r.Execute(tc.command)
+			if (err != nil) != tc.expectErr {
+				t.Errorf("Expected error=%v, got: %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+// TestRunner_ExecuteAll tests that every command runs despite earlier failures.
+func TestRunner_ExecuteAll(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on sh syntax")
+	}
+
+	var stdout bytes.Buffer
+	r := &executor.Runner{Stdout: &stdout}
+	err := r.ExecuteAll([]string{"echo one", "exit 3", "echo two", "exit 4"})
+
+	if stdout.String() != "one\ntwo\n" {
+		t.Errorf("Expected every command to run, got '%s'", stdout.String())
+	}
+	if err == nil {
+		t.Fatal("Expected the failures to be reported, got nil")
+	}
+	for _, want := range []string{"exit 3: exit status 3", "exit 4: exit status 4"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected the error to contain '%s', got: %v", want, err)
+		}
+	}
+
+	if err := r.ExecuteAll([]string{"true", "true"}); err != nil {
+		t.Errorf("Expected no error when all commands succeed, got: %v", err)
+	}
+}
+
+// TestRunner_Execute_Repeat tests that the command runs exactly Repeat times.
+func TestRunner_Execute_Repeat(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on sh syntax")
+	}
+
+	counter := filepath.Join(t.TempDir(), "runs")
+	r := &executor.Runner{Repeat: 3, Stdout: io.Discard}
+	if err := r.Execute("echo run >> " + counter); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	runs, _ := os.ReadFile(counter)
+	if strings.Count(string(runs), "run") != 3 {
+		t.Errorf("Expected 3 runs, got %q", string(runs))
+	}
+
+	// Only the second run fails, and the third still happens.
+	os.Remove(counter)
+	err := r.Execute("echo run >> " + counter + "; [ $(wc -l < " + counter + ") -ne 2 ]")
+	runs, _ = os.ReadFile(counter)
+	if strings.Count(string(runs), "run") != 3 {
+		t.Errorf("Expected 3 runs despite a failure, got %q", string(runs))
+	}
+	if err == nil || !strings.Contains(err.Error(), "run 2:") || strings.Contains(err.Error(), "run 3:") {
+		t.Errorf("Expected only run 2 to be reported as failed, got: %v", err)
+	}
+}
+
+// TestRunner_Execute_Env tests that extra variables reach the command.
+func TestRunner_Execute_Env(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on sh syntax")
+	}
+
+	t.Setenv("INHERITED", "yes")
+	var stdout bytes.Buffer
+	r := &executor.Runner{Stdout: &stdout, Env: []string{"WATCHFOR_ATTEMPT=3"}}
+	if err := r.Execute(`echo "$WATCHFOR_ATTEMPT $INHERITED"`); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if stdout.String() != "3 yes\n" {
+		t.Errorf("Expected '3 yes\\n', got '%s'", stdout.String())
+	}
+}
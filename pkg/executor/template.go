@@ -0,0 +1,41 @@
+package executor
+
+import (
+	"runtime"
+	"strings"
+	"text/template"
+)
+
+// ParseTemplate parses a command written as a text/template, e.g.
+// "./deploy {{quote .Group.id}}". Referencing a missing map key, such as an
+// unknown group, is an error when the template is rendered.
+func ParseTemplate(command string) (*template.Template, error) {
+	return template.New("command").
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"quote": Quote}).
+		Parse(command)
+}
+
+// Render parses command as a template, see ParseTemplate, and executes it with
+// data. Values are inserted as they are: pass them through quote to use them
+// as single shell arguments.
+func Render(command string, data any) (string, error) {
+	tmpl, err := ParseTemplate(command)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Quote returns s quoted as a single argument for the shell commands are run
+// through: sh, or PowerShell on Windows.
+func Quote(s string) string {
+	if runtime.GOOS == "windows" {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
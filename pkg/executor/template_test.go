@@ -0,0 +1,58 @@
+package executor_test
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gregory-chatelier/watchfor/pkg/executor"
+	"github.com/gregory-chatelier/watchfor/pkg/poller"
+)
+
+func TestRender(t *testing.T) {
+	match := poller.Match{
+		Output: "build 42 deployed to eu-west-1\n",
+		Line:   "build 42 deployed to eu-west-1",
+		Text:   "build 42 deployed",
+		Group:  map[string]string{"id": "42", "1": "42", "region": "eu-west-1", "2": "eu-west-1"},
+	}
+	testCases := []struct {
+		command  string
+		expected string
+	}{
+		{"./deploy {{.Group.id}} --region {{.Group.region}}", "./deploy 42 --region eu-west-1"},
+		{`./deploy {{index .Group "1"}}`, "./deploy 42"},
+		{"notify {{quote .Line}}", "notify 'build 42 deployed to eu-west-1'"},
+		{"echo {{.Text}}", "echo build 42 deployed"},
+		{"./run-tests.sh", "./run-tests.sh"},
+	}
+
+	for _, tc := range testCases {
+		got, err := executor.Render(tc.command, match)
+		if err != nil || got != tc.expected {
+			t.Errorf("Render(%q) = %q, %v; expected %q", tc.command, got, err, tc.expected)
+		}
+	}
+
+	for command, want := range map[string]string{
+		"./deploy {{.Group.missing}}": `map has no entry for key "missing"`,
+		"./deploy {{.Group.id":        "unclosed action",
+		"./deploy {{.Groups}}":        "can't evaluate field Groups",
+	} {
+		if _, err := executor.Render(command, match); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Render(%q): expected an error containing %q, got %v", command, want, err)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Uses sh")
+	}
+	for _, value := range []string{"plain", "it's $HOME; rm -rf /", "a\nb", `"quoted" \n`, ""} {
+		output, err := executor.Capture("printf %s "+executor.Quote(value), nil)
+		if err != nil || string(output) != value {
+			t.Errorf("Quote(%q) came through the shell as %q, %v", value, output, err)
+		}
+	}
+}
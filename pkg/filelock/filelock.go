@@ -0,0 +1,77 @@
+package filelock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+// ErrLocked is returned when the lock is held by another process.
+var ErrLocked = errors.New("file is locked by another process")
+
+// Lock is an exclusive advisory lock on a file.
+type Lock struct {
+	f *os.File
+}
+
+// TryLock acquires an exclusive lock on path without blocking, creating the
+// file if needed. It returns ErrLocked if the lock is already held.
+func TryLock(path string) (*Lock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := tryLock(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Lock{f: f}, nil
+}
+
+// Probe reports whether the lock on path is free, by taking it and releasing
+// it at once. Unlike TryLock, it does not create the file: a missing file is
+// an error wrapping os.ErrNotExist.
+func Probe(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	if err := tryLock(f); errors.Is(err, ErrLocked) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, unlock(f)
+}
+
+// Acquire retries TryLock every retryInterval until it succeeds or ctx is done.
+func Acquire(ctx context.Context, path string, retryInterval time.Duration) (*Lock, error) {
+	for {
+		lock, err := TryLock(path)
+		if !errors.Is(err, ErrLocked) {
+			return lock, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ErrLocked
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// Unlock releases the lock. Closing the file releases it as well, so the lock
+// is never left behind when the process dies.
+func (l *Lock) Unlock() error {
+	if l.f == nil {
+		return nil
+	}
+	err := unlock(l.f)
+	if closeErr := l.f.Close(); err == nil {
+		err = closeErr
+	}
+	l.f = nil // Prevent double unlock
+	return err
+}
@@ -0,0 +1,91 @@
+package filelock_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gregory-chatelier/watchfor/pkg/filelock"
+)
+
+func TestTryLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watchfor.lock")
+
+	lock, err := filelock.TryLock(path)
+	if err != nil {
+		t.Fatalf("TryLock failed: %v", err)
+	}
+
+	// A second lock on the same file must fail while the first is held.
+	if _, err := filelock.TryLock(path); !errors.Is(err, filelock.ErrLocked) {
+		t.Fatalf("Expected ErrLocked while the lock is held, got: %v", err)
+	}
+
+	if err := lock.Unlock(); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+
+	lock, err = filelock.TryLock(path)
+	if err != nil {
+		t.Fatalf("Expected TryLock to succeed after Unlock, got: %v", err)
+	}
+	lock.Unlock()
+}
+
+func TestProbe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "build.lock")
+	if _, err := filelock.Probe(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected os.ErrNotExist for a missing file, got: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("Expected Probe not to create the file")
+	}
+
+	held, err := filelock.TryLock(path)
+	if err != nil {
+		t.Fatalf("TryLock failed: %v", err)
+	}
+	if free, err := filelock.Probe(path); err != nil || free {
+		t.Errorf("Expected the lock to be held, got %v, %v", free, err)
+	}
+	held.Unlock()
+	if free, err := filelock.Probe(path); err != nil || !free {
+		t.Errorf("Expected the lock to be free, got %v, %v", free, err)
+	}
+	// Probing released the lock again.
+	lock, err := filelock.TryLock(path)
+	if err != nil {
+		t.Fatalf("Expected TryLock to succeed after Probe, got: %v", err)
+	}
+	lock.Unlock()
+}
+
+func TestAcquire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watchfor.lock")
+
+	held, err := filelock.TryLock(path)
+	if err != nil {
+		t.Fatalf("TryLock failed: %v", err)
+	}
+
+	// 1. Times out while the lock is held.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := filelock.Acquire(ctx, path, time.Millisecond); !errors.Is(err, filelock.ErrLocked) {
+		t.Fatalf("Expected ErrLocked after the timeout, got: %v", err)
+	}
+
+	// 2. Succeeds once the lock is released.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		held.Unlock()
+	}()
+	lock, err := filelock.Acquire(context.Background(), path, time.Millisecond)
+	if err != nil {
+		t.Fatalf("Expected Acquire to succeed after release, got: %v", err)
+	}
+	lock.Unlock()
+}
@@ -0,0 +1,95 @@
+// Package junit writes JUnit XML reports, which CI systems show in their test
+// dashboards.
+package junit
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// TestCase is the outcome of a single test.
+type TestCase struct {
+	Name      string
+	ClassName string
+	Duration  time.Duration
+	// Failure is why the test failed, or "" if it passed.
+	Failure string
+	// FailureType classifies the failure, e.g. by its cause.
+	FailureType string
+	// Details is recorded with the failure, e.g. the output that was checked.
+	Details string
+}
+
+type testSuites struct {
+	XMLName xml.Name    `xml:"testsuites"`
+	Suites  []testSuite `xml:"testsuite"`
+}
+
+type testSuite struct {
+	Name      string     `xml:"name,attr"`
+	Tests     int        `xml:"tests,attr"`
+	Failures  int        `xml:"failures,attr"`
+	Time      string     `xml:"time,attr"`
+	Timestamp string     `xml:"timestamp,attr"`
+	Cases     []testCase `xml:"testcase"`
+}
+
+type testCase struct {
+	Name      string   `xml:"name,attr"`
+	ClassName string   `xml:"classname,attr"`
+	Time      string   `xml:"time,attr"`
+	Failure   *failure `xml:"failure"`
+}
+
+type failure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Details string `xml:",chardata"`
+}
+
+// Write writes a report with one suite, named suite, made of cases.
+func Write(w io.Writer, suite string, cases ...TestCase) error {
+	s := testSuite{Name: suite, Tests: len(cases), Timestamp: time.Now().UTC().Format("2006-01-02T15:04:05")}
+	var total time.Duration
+	for _, c := range cases {
+		tc := testCase{Name: c.Name, ClassName: c.ClassName, Time: seconds(c.Duration)}
+		if c.Failure != "" {
+			s.Failures++
+			tc.Failure = &failure{Message: c.Failure, Type: c.FailureType, Details: c.Details}
+		}
+		total += c.Duration
+		s.Cases = append(s.Cases, tc)
+	}
+	s.Time = seconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(testSuites{Suites: []testSuite{s}}); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// WriteFile writes the report to the file at path, replacing it.
+func WriteFile(path, suite string, cases ...TestCase) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := Write(f, suite, cases...); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,101 @@
+package junit_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gregory-chatelier/watchfor/pkg/junit"
+)
+
+// report mirrors the JUnit XML structure that CI systems read.
+type report struct {
+	XMLName xml.Name `xml:"testsuites"`
+	Suites  []struct {
+		Name     string `xml:"name,attr"`
+		Tests    int    `xml:"tests,attr"`
+		Failures int    `xml:"failures,attr"`
+		Time     string `xml:"time,attr"`
+		Cases    []struct {
+			Name      string `xml:"name,attr"`
+			ClassName string `xml:"classname,attr"`
+			Time      string `xml:"time,attr"`
+			Failure   *struct {
+				Message string `xml:"message,attr"`
+				Type    string `xml:"type,attr"`
+				Details string `xml:",chardata"`
+			} `xml:"failure"`
+		} `xml:"testcase"`
+	} `xml:"testsuite"`
+}
+
+func parse(t *testing.T, data []byte) report {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte(xml.Header)) {
+		t.Errorf("Expected an XML declaration, got:\n%s", data)
+	}
+	var r report
+	if err := xml.Unmarshal(data, &r); err != nil {
+		t.Fatalf("Invalid XML: %v\n%s", err, data)
+	}
+	if len(r.Suites) != 1 {
+		t.Fatalf("Expected one test suite, got %d", len(r.Suites))
+	}
+	return r
+}
+
+func TestWrite_Passed(t *testing.T) {
+	var buf bytes.Buffer
+	err := junit.Write(&buf, "watchfor", junit.TestCase{Name: `wait for "READY"`, ClassName: "watchfor", Duration: 1500 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	suite := parse(t, buf.Bytes()).Suites[0]
+	if suite.Name != "watchfor" || suite.Tests != 1 || suite.Failures != 0 || suite.Time != "1.500" {
+		t.Errorf("Unexpected suite attributes: %+v", suite)
+	}
+	c := suite.Cases[0]
+	if c.Name != `wait for "READY"` || c.ClassName != "watchfor" || c.Time != "1.500" || c.Failure != nil {
+		t.Errorf("Unexpected test case: %+v", c)
+	}
+}
+
+func TestWriteFile_Failed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.xml")
+	err := junit.WriteFile(path, "watchfor", junit.TestCase{
+		Name:        `wait for "READY"`,
+		ClassName:   "watchfor",
+		Duration:    30 * time.Second,
+		Failure:     "timeout after 12 attempts",
+		FailureType: "timeout",
+		Details:     "\x1b[31mstarting <db> & cache\x1b[0m\n",
+	})
+	if err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	suite := parse(t, data).Suites[0]
+	if suite.Tests != 1 || suite.Failures != 1 {
+		t.Errorf("Expected 1 test and 1 failure, got %d and %d", suite.Tests, suite.Failures)
+	}
+	f := suite.Cases[0].Failure
+	if f == nil {
+		t.Fatal("Expected a failure element")
+	}
+	if f.Message != "timeout after 12 attempts" || f.Type != "timeout" {
+		t.Errorf("Unexpected failure attributes: %+v", f)
+	}
+	// Markup is escaped, and control characters, invalid in XML, replaced.
+	if !strings.Contains(f.Details, "starting <db> & cache") || strings.Contains(f.Details, "\x1b") {
+		t.Errorf("Unexpected failure details: %q", f.Details)
+	}
+}
@@ -0,0 +1,29 @@
+package matcher
+
+import (
+	"bytes"
+	"strings"
+)
+
+// EqualsMatcher matches an output that is exactly the expected value, e.g. the
+// commit hash a deployment should report. Surrounding whitespace is ignored
+// on both sides.
+type EqualsMatcher struct {
+	expected   []byte
+	ignoreCase bool
+}
+
+// NewEqualsMatcher creates a matcher for outputs equal to expected, compared
+// case-insensitively with ignoreCase.
+func NewEqualsMatcher(expected string, ignoreCase bool) *EqualsMatcher {
+	return &EqualsMatcher{expected: []byte(strings.TrimSpace(expected)), ignoreCase: ignoreCase}
+}
+
+// Match reports whether the trimmed output equals the expected value.
+func (m *EqualsMatcher) Match(output []byte) (bool, error) {
+	output = bytes.TrimSpace(output)
+	if m.ignoreCase {
+		return bytes.EqualFold(output, m.expected), nil
+	}
+	return bytes.Equal(output, m.expected), nil
+}
@@ -0,0 +1,32 @@
+package matcher_test
+
+import (
+	"testing"
+
+	"github.com/gregory-chatelier/watchfor/pkg/matcher"
+)
+
+func TestEqualsMatcher_Match(t *testing.T) {
+	testCases := []struct {
+		expected   string
+		ignoreCase bool
+		output     string
+		match      bool
+	}{
+		{"4f2a9c1", false, "4f2a9c1\n", true},
+		{" 4f2a9c1\n", false, "  4f2a9c1", true},
+		{"4f2a9c1", false, "4F2A9C1", false},
+		{"4f2a9c1", true, "4F2A9C1\n", true},
+		{"4f2a9c1", false, "4f2a9c1 deployed", false},
+		{"4f2a9c1", false, "", false},
+		{"", false, "\n", true},
+	}
+
+	for _, tc := range testCases {
+		m := matcher.NewEqualsMatcher(tc.expected, tc.ignoreCase)
+		matched, err := m.Match([]byte(tc.output))
+		if err != nil || matched != tc.match {
+			t.Errorf("NewEqualsMatcher(%q, %v).Match(%q) = %v, %v; expected %v", tc.expected, tc.ignoreCase, tc.output, matched, err, tc.match)
+		}
+	}
+}
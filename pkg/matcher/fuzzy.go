@@ -0,0 +1,81 @@
+package matcher
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxFuzzyInput caps how much output a FuzzyMatcher scans. Longer outputs are cut
+// to their last MaxFuzzyInput bytes, where the most recent text is.
+const MaxFuzzyInput = 1 << 20
+
+// FuzzyMatcher matches when the output contains a substring within a maximum
+// Levenshtein distance of the pattern, for noisy sources such as OCR.
+//
+// The search takes O(k·n) time on typical text, for a distance k and an output of
+// n characters, and O(m·n) at worst for a pattern of m characters. It uses O(m) memory.
+type FuzzyMatcher struct {
+	pattern     []rune
+	maxDistance int
+	ignoreCase  bool
+}
+
+// NewFuzzyMatcher creates a matcher for pattern, allowing up to maxDistance
+// inserted, deleted or substituted characters.
+func NewFuzzyMatcher(pattern string, maxDistance int, ignoreCase bool) *FuzzyMatcher {
+	fm := &FuzzyMatcher{pattern: []rune(pattern), maxDistance: maxDistance, ignoreCase: ignoreCase}
+	if ignoreCase {
+		for i, r := range fm.pattern {
+			fm.pattern[i] = unicode.ToLower(r)
+		}
+	}
+	return fm
+}
+
+// Match reports whether some substring of the output is within the maximum
+// distance of the pattern.
+func (fm *FuzzyMatcher) Match(output []byte) (bool, error) {
+	m, k := len(fm.pattern), fm.maxDistance
+	if m <= k {
+		return true, nil // Deleting the whole pattern is within the distance.
+	}
+	if len(output) > MaxFuzzyInput {
+		output = output[len(output)-MaxFuzzyInput:]
+	}
+
+	// Sellers' algorithm: dist[i] is the smallest distance between the first i
+	// characters of the pattern and a substring ending at the current character.
+	// Only rows up to last can be within k, which skips most of the work (Ukkonen).
+	dist := make([]int, m+1)
+	for i := range dist {
+		dist[i] = i
+	}
+	last := k
+	for len(output) > 0 {
+		c, size := utf8.DecodeRune(output)
+		output = output[size:]
+		if fm.ignoreCase {
+			c = unicode.ToLower(c)
+		}
+
+		diag := 0 // dist[i-1] of the previous character; a match may start anywhere.
+		for i := 1; i <= min(last+1, m); i++ {
+			cost := 1
+			if fm.pattern[i-1] == c {
+				cost = 0
+			}
+			next := min(diag+cost, dist[i]+1, dist[i-1]+1)
+			diag, dist[i] = dist[i], next
+		}
+		if last < m {
+			last++
+		}
+		for last > 0 && dist[last] > k {
+			last--
+		}
+		if last == m {
+			return true, nil
+		}
+	}
+	return false, nil
+}
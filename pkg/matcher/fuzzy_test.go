@@ -0,0 +1,83 @@
+package matcher_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/gregory-chatelier/watchfor/pkg/matcher"
+)
+
+func TestFuzzyMatcher_Match(t *testing.T) {
+	testCases := []struct {
+		name        string
+		pattern     string
+		maxDistance int
+		ignoreCase  bool
+		output      string
+		expected    bool
+	}{
+		{"Exact", "Server ready", 0, false, "INFO Server ready on :8080", true},
+		{"Exact Required", "Server ready", 0, false, "INFO Server reaby on :8080", false},
+		{"Substitution", "Server ready", 1, false, "INFO Server reaby on :8080", true},
+		{"Deletion", "Server ready", 1, false, "INFO Servr ready", true},
+		{"Insertion", "Server ready", 1, false, "INFO Serveer ready", true},
+		{"Two Edits", "Server ready", 2, false, "INFO 5erver reaby", true},
+		{"Too Many Edits", "Server ready", 1, false, "INFO 5erver reaby", false},
+		{"At Start", "ready", 1, false, "rady now", true},
+		{"At End", "ready", 1, false, "now reedy", true},
+		{"Unrelated", "ready", 2, false, "starting up", false},
+		{"Case Differs", "Ready", 0, false, "ready", false},
+		{"Ignore Case", "Ready", 0, true, "READY", true},
+		{"Unicode", "prêt", 1, false, "statut: pret", true},
+		{"Distance Covers Pattern", "ok", 2, false, "", true},
+		{"Empty Output", "ready", 1, false, "", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fm := matcher.NewFuzzyMatcher(tc.pattern, tc.maxDistance, tc.ignoreCase)
+			matched, err := fm.Match([]byte(tc.output))
+			if err != nil {
+				t.Fatalf("Match failed: %v", err)
+			}
+			if matched != tc.expected {
+				t.Errorf("Expected matched=%v, got %v", tc.expected, matched)
+			}
+		})
+	}
+}
+
+func TestFuzzyMatcher_Match_Distances(t *testing.T) {
+	// Two transpositions and a deletion: "deployment compleet, 3 rplicas avialable" is 5 edits away.
+	output := []byte("status: deployment compleet, 3 rplicas avialable")
+	pattern := "deployment complete, 3 replicas available"
+	for k := 0; k <= 6; k++ {
+		t.Run(fmt.Sprintf("k=%d", k), func(t *testing.T) {
+			matched, _ := matcher.NewFuzzyMatcher(pattern, k, false).Match(output)
+			if expected := k >= 5; matched != expected {
+				t.Errorf("Expected matched=%v, got %v", expected, matched)
+			}
+		})
+	}
+}
+
+func TestFuzzyMatcher_Match_CapsInput(t *testing.T) {
+	fm := matcher.NewFuzzyMatcher("READY", 0, false)
+	output := append([]byte("READY"), bytes.Repeat([]byte("x"), matcher.MaxFuzzyInput)...)
+	if matched, _ := fm.Match(output); matched {
+		t.Error("Expected the start of an oversized output to be ignored")
+	}
+	if matched, _ := fm.Match(append(output, "READY"...)); !matched {
+		t.Error("Expected the end of an oversized output to be scanned")
+	}
+}
+
+func BenchmarkFuzzyMatcher_Match(b *testing.B) {
+	output := bytes.Repeat([]byte("2024-05-01T10:00:00Z INFO worker-42 processed batch 1234 in 56ms\n"), 1000)
+	fm := matcher.NewFuzzyMatcher("deployment complete", 2, false)
+	b.SetBytes(int64(len(output)))
+	for b.Loop() {
+		fm.Match(output)
+	}
+}
@@ -0,0 +1,77 @@
+package matcher
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// JSONLogMatcher matches JSON-lines logs on a field of their entries, e.g. an
+// entry whose "msg" contains "ready". Lines that are not JSON objects, such as
+// a banner printed before logging starts, are skipped.
+type JSONLogMatcher struct {
+	path       []string
+	contains   string
+	ignoreCase bool
+}
+
+// NewJSONLogMatcher creates a matcher for entries whose field contains the
+// given text, compared case-insensitively with ignoreCase. The field may name
+// a nested one with dots, e.g. "http.status". With no text, any entry that has
+// the field matches. Values that are not strings are compared in their JSON
+// form, e.g. 503 or true.
+func NewJSONLogMatcher(field, contains string, ignoreCase bool) *JSONLogMatcher {
+	if ignoreCase {
+		contains = strings.ToLower(contains)
+	}
+	return &JSONLogMatcher{path: strings.Split(field, "."), contains: contains, ignoreCase: ignoreCase}
+}
+
+// Match reports whether any line of the output is a JSON object whose field
+// contains the text.
+func (m *JSONLogMatcher) Match(output []byte) (bool, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(nil, len(output)+1)
+	for scanner.Scan() {
+		value, ok := m.field(scanner.Bytes())
+		if !ok {
+			continue
+		}
+		if m.ignoreCase {
+			value = strings.ToLower(value)
+		}
+		if strings.Contains(value, m.contains) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// field returns the value of the field in a line, if it is a JSON object
+// that has it.
+func (m *JSONLogMatcher) field(line []byte) (string, bool) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || line[0] != '{' {
+		return "", false
+	}
+	var entry map[string]json.RawMessage
+	if json.Unmarshal(line, &entry) != nil {
+		return "", false
+	}
+	var raw json.RawMessage
+	for i, key := range m.path {
+		var ok bool
+		if raw, ok = entry[key]; !ok {
+			return "", false
+		}
+		if i < len(m.path)-1 && json.Unmarshal(raw, &entry) != nil {
+			return "", false
+		}
+	}
+	var s string
+	if raw[0] == '"' && json.Unmarshal(raw, &s) == nil {
+		return s, true
+	}
+	return string(raw), true
+}
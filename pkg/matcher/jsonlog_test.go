@@ -0,0 +1,52 @@
+package matcher_test
+
+import (
+	"testing"
+
+	"github.com/gregory-chatelier/watchfor/pkg/matcher"
+)
+
+func TestJSONLogMatcher_Match(t *testing.T) {
+	logs := `Starting app v1.4.2 (pid 4711)
+{"level":"info","msg":"connecting to db"}
+not json {"msg":"ready"}
+{"level":"info","msg":"listening","http":{"port":8080,"tls":false}}
+{"level":"error","msg":"cache unavailable, retrying"
+{"level":"warn","msg":null,"code":503}
+`
+	testCases := []struct {
+		field, contains string
+		ignoreCase      bool
+		match           bool
+	}{
+		{"msg", "listening", false, true},
+		{"msg", "ready", false, false},
+		{"msg", "LISTENING", false, false},
+		{"msg", "LISTENING", true, true},
+		{"level", "error", false, false},
+		{"http.port", "8080", false, true},
+		{"http.tls", "false", false, true},
+		{"http.port.number", "", false, false},
+		{"code", "503", false, true},
+		{"msg", "null", false, true},
+		{"level", "", false, true},
+		{"trace_id", "", false, false},
+	}
+
+	for _, tc := range testCases {
+		m := matcher.NewJSONLogMatcher(tc.field, tc.contains, tc.ignoreCase)
+		matched, err := m.Match([]byte(logs))
+		if err != nil || matched != tc.match {
+			t.Errorf("NewJSONLogMatcher(%q, %q, %v).Match() = %v, %v; expected %v", tc.field, tc.contains, tc.ignoreCase, matched, err, tc.match)
+		}
+	}
+}
+
+func TestJSONLogMatcher_PlainOutput(t *testing.T) {
+	m := matcher.NewJSONLogMatcher("msg", "ready", false)
+	for _, output := range []string{"", "\n\n", "ready\n", `["msg","ready"]`, `"ready"`} {
+		if matched, err := m.Match([]byte(output)); err != nil || matched {
+			t.Errorf("Match(%q) = %v, %v; expected no match", output, matched, err)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package matcher
+
+import (
+	"bytes"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// JSONSchemaMatcher parses the output as JSON and validates it against a schema.
+type JSONSchemaMatcher struct {
+	schema *jsonschema.Schema
+}
+
+// NewJSONSchemaMatcher compiles the JSON Schema in the file at path. References
+// to other files are resolved relative to it.
+func NewJSONSchemaMatcher(path string) (*JSONSchemaMatcher, error) {
+	schema, err := jsonschema.NewCompiler().Compile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONSchemaMatcher{schema: schema}, nil
+}
+
+// Match reports whether the output is a JSON document valid against the schema.
+// Malformed JSON and invalid documents are non-matches, since the service may
+// not be ready yet.
+func (jm *JSONSchemaMatcher) Match(output []byte) (bool, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(output))
+	if err != nil {
+		return false, nil
+	}
+	return jm.schema.Validate(doc) == nil, nil
+}
@@ -0,0 +1,58 @@
+package matcher_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gregory-chatelier/watchfor/pkg/matcher"
+)
+
+func TestJSONSchemaMatcher_Match(t *testing.T) {
+	jm, err := matcher.NewJSONSchemaMatcher("testdata/health.schema.json")
+	if err != nil {
+		t.Fatalf("NewJSONSchemaMatcher failed: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		output   string
+		expected bool
+	}{
+		{"Valid", `{"status":"ok","version":"1.4.2","checks":[{"name":"db","healthy":true}]}`, true},
+		{"Valid With Extra Fields", `{"status":"degraded","version":"1.4.2","checks":[{"name":"db","healthy":false}],"uptime":3}`, true},
+		{"Missing Field", `{"status":"ok","checks":[{"name":"db","healthy":true}]}`, false},
+		{"Wrong Enum Value", `{"status":"starting","version":"1.4.2","checks":[{"name":"db","healthy":true}]}`, false},
+		{"Wrong Nested Type", `{"status":"ok","version":"1.4.2","checks":[{"name":"db","healthy":"yes"}]}`, false},
+		{"Empty Array", `{"status":"ok","version":"1.4.2","checks":[]}`, false},
+		{"Truncated JSON", `{"status":"ok","version":"1.4`, false},
+		{"Not JSON", `503 Service Unavailable`, false},
+		{"Empty", ``, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			matched, err := jm.Match([]byte(tc.output))
+			if err != nil {
+				t.Fatalf("Match returned an error: %v", err)
+			}
+			if matched != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, matched)
+			}
+		})
+	}
+}
+
+func TestNewJSONSchemaMatcher_InvalidSchema(t *testing.T) {
+	if _, err := matcher.NewJSONSchemaMatcher("testdata/missing.schema.json"); err == nil {
+		t.Error("Expected an error for a missing schema")
+	}
+
+	path := filepath.Join(t.TempDir(), "invalid.schema.json")
+	if err := os.WriteFile(path, []byte(`{"type": 42}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := matcher.NewJSONSchemaMatcher(path); err == nil {
+		t.Error("Expected an error for an invalid schema")
+	}
+}
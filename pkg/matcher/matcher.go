@@ -0,0 +1,10 @@
+package matcher
+
+// Matcher decides whether a watcher's output satisfies the wait condition.
+// It is an alternative to the poller's built-in pattern matching.
+type Matcher interface {
+	// Match reports whether the output matches. A returned error is treated
+	// as fatal by the poller, so implementations should report malformed
+	// input as a non-match instead.
+	Match(output []byte) (bool, error)
+}
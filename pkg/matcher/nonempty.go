@@ -0,0 +1,12 @@
+package matcher
+
+import "bytes"
+
+// NonEmptyMatcher matches any output that is not blank, e.g. to succeed as soon
+// as a watcher reports anything new.
+type NonEmptyMatcher struct{}
+
+// Match reports whether the output contains anything besides whitespace.
+func (NonEmptyMatcher) Match(output []byte) (bool, error) {
+	return len(bytes.TrimSpace(output)) > 0, nil
+}
@@ -0,0 +1,25 @@
+package matcher_test
+
+import (
+	"testing"
+
+	"github.com/gregory-chatelier/watchfor/pkg/matcher"
+)
+
+func TestNonEmptyMatcher_Match(t *testing.T) {
+	testCases := []struct {
+		output   string
+		expected bool
+	}{
+		{"", false},
+		{" \n\t", false},
+		{"app.tar.gz\n", true},
+	}
+
+	for _, tc := range testCases {
+		matched, err := matcher.NonEmptyMatcher{}.Match([]byte(tc.output))
+		if err != nil || matched != tc.expected {
+			t.Errorf("Match(%q) = %v, %v; expected %v", tc.output, matched, err, tc.expected)
+		}
+	}
+}
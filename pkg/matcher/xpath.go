@@ -0,0 +1,41 @@
+package matcher
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/antchfx/xpath"
+)
+
+// XPathMatcher parses the output as XML and evaluates an XPath selector against it.
+type XPathMatcher struct {
+	expr   *xpath.Expr
+	equals string
+}
+
+// NewXPathMatcher compiles the selector. If equals is empty, any matching node
+// is enough; otherwise the node's trimmed text must equal it.
+func NewXPathMatcher(selector, equals string) (*XPathMatcher, error) {
+	expr, err := xpath.Compile(selector)
+	if err != nil {
+		return nil, err
+	}
+	return &XPathMatcher{expr: expr, equals: equals}, nil
+}
+
+// Match reports whether a node selected by the expression satisfies the condition.
+// Malformed XML is a non-match, since the next attempt may return a complete document.
+func (xm *XPathMatcher) Match(output []byte) (bool, error) {
+	doc, err := xmlquery.Parse(bytes.NewReader(output))
+	if err != nil {
+		return false, nil
+	}
+
+	for _, node := range xmlquery.QuerySelectorAll(doc, xm.expr) {
+		if xm.equals == "" || strings.TrimSpace(node.InnerText()) == xm.equals {
+			return true, nil
+		}
+	}
+	return false, nil
+}
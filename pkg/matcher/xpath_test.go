@@ -0,0 +1,53 @@
+package matcher_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gregory-chatelier/watchfor/pkg/matcher"
+)
+
+func TestXPathMatcher_Match(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/status.xml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		selector string
+		equals   string
+		output   []byte
+		expected bool
+	}{
+		{"Node Exists", "//component[@name='db']", "", fixture, true},
+		{"Node Missing", "//component[@name='queue']", "", fixture, false},
+		{"Text Equals", "//component[@name='db']/state", "ready", fixture, true},
+		{"Text Differs", "/service/status", "running", fixture, false},
+		{"Any Node Equals", "//state", "warming", fixture, true},
+		{"Malformed XML", "/service/status", "starting", []byte("<service><status>starting"), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := matcher.NewXPathMatcher(tc.selector, tc.equals)
+			if err != nil {
+				t.Fatalf("NewXPathMatcher failed: %v", err)
+			}
+
+			matched, err := m.Match(tc.output)
+			if err != nil {
+				t.Fatalf("Match returned an error: %v", err)
+			}
+			if matched != tc.expected {
+				t.Errorf("Expected matched=%v, got %v", tc.expected, matched)
+			}
+		})
+	}
+}
+
+func TestNewXPathMatcher_InvalidSelector(t *testing.T) {
+	if _, err := matcher.NewXPathMatcher("//[", ""); err == nil {
+		t.Error("Expected an error for an invalid selector, got nil")
+	}
+}
@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Desktop shows a desktop notification using the platform's notifier.
+func Desktop(title, message string) error {
+	cmd, err := Command(runtime.GOOS, title, message)
+	if err != nil {
+		return err
+	}
+	return cmd.Run()
+}
+
+// Command returns the command showing a desktop notification on the given
+// platform: notify-send on Linux and BSDs, osascript on macOS and a PowerShell
+// toast on Windows.
+func Command(goos, title, message string) (*exec.Cmd, error) {
+	switch goos {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptQuote(message), appleScriptQuote(title))
+		return exec.Command("osascript", "-e", script), nil
+	case "windows":
+		script := `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$t = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$x = $t.GetElementsByTagName('text')
+$x.Item(0).AppendChild($t.CreateTextNode(` + powerShellQuote(title) + `)) > $null
+$x.Item(1).AppendChild($t.CreateTextNode(` + powerShellQuote(message) + `)) > $null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('watchfor').Show([Windows.UI.Notifications.ToastNotification]::new($t))`
+		return exec.Command("powershell", "-NoProfile", "-Command", script), nil
+	case "linux", "freebsd", "openbsd", "netbsd":
+		return exec.Command("notify-send", title, message), nil
+	default:
+		return nil, fmt.Errorf("desktop notifications are not supported on %s", goos)
+	}
+}
+
+func appleScriptQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func powerShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
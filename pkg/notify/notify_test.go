@@ -0,0 +1,42 @@
+package notify_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gregory-chatelier/watchfor/pkg/notify"
+)
+
+func TestCommand(t *testing.T) {
+	testCases := []struct {
+		goos     string
+		name     string
+		contains []string
+	}{
+		{"linux", "notify-send", []string{"watchfor", `it's "done"`}},
+		{"darwin", "osascript", []string{`display notification "it's \"done\"" with title "watchfor"`}},
+		{"windows", "powershell", []string{`CreateTextNode('watchfor')`, `CreateTextNode('it''s "done"')`}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.goos, func(t *testing.T) {
+			cmd, err := notify.Command(tc.goos, "watchfor", `it's "done"`)
+			if err != nil {
+				t.Fatalf("Command failed: %v", err)
+			}
+			if !strings.HasSuffix(cmd.Path, tc.name) && cmd.Args[0] != tc.name {
+				t.Errorf("Expected %s, got %s", tc.name, cmd.Path)
+			}
+			for _, want := range tc.contains {
+				if !slices.ContainsFunc(cmd.Args, func(arg string) bool { return strings.Contains(arg, want) }) {
+					t.Errorf("Expected an argument containing %s, got %q", want, cmd.Args)
+				}
+			}
+		})
+	}
+
+	if _, err := notify.Command("plan9", "watchfor", "done"); err == nil {
+		t.Error("Expected an error for an unsupported platform, got nil")
+	}
+}
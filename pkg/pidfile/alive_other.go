@@ -0,0 +1,15 @@
+//go:build !unix
+
+package pidfile
+
+import "os"
+
+// alive reports whether a process with the given PID exists.
+func alive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
@@ -0,0 +1,54 @@
+package pidfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// ErrRunning is returned when the file holds the PID of a process that is still
+// running.
+var ErrRunning = errors.New("process is still running")
+
+// PIDFile is a file holding the PID of the current process.
+type PIDFile struct {
+	path string
+	pid  int
+}
+
+// Write writes the PID of the current process to path. A file left behind by a
+// process that is no longer running, or holding anything but a PID, is
+// replaced; one held by a running process makes Write fail with ErrRunning.
+func Write(path string) (*PIDFile, error) {
+	pid := os.Getpid()
+	if old, err := Read(path); err == nil && old != pid && alive(old) {
+		return nil, fmt.Errorf("%s: %w (pid %d)", path, ErrRunning, old)
+	}
+	if err := os.WriteFile(path, []byte(strconv.Itoa(pid)+"\n"), 0644); err != nil {
+		return nil, err
+	}
+	return &PIDFile{path: path, pid: pid}, nil
+}
+
+// Read returns the PID held by the file at path.
+func Read(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(string(bytes.TrimSpace(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("%s: not a pid file", path)
+	}
+	return pid, nil
+}
+
+// Remove deletes the file, unless another process has since replaced it.
+func (f *PIDFile) Remove() error {
+	if pid, err := Read(f.path); err != nil || pid != f.pid {
+		return nil
+	}
+	return os.Remove(f.path)
+}
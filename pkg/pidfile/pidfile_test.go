@@ -0,0 +1,105 @@
+package pidfile_test
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/gregory-chatelier/watchfor/pkg/pidfile"
+)
+
+func TestWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watchfor.pid")
+
+	f, err := pidfile.Write(path)
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	pid, err := pidfile.Read(path)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if pid != os.Getpid() {
+		t.Errorf("Expected pid %d, got %d", os.Getpid(), pid)
+	}
+
+	if err := f.Remove(); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the file to be removed, got %v", err)
+	}
+}
+
+func TestWrite_ReplacesStaleFile(t *testing.T) {
+	// A process that has exited leaves a PID nothing runs under.
+	cmd := exec.Command("go", "version")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("Cannot run a process: %v", err)
+	}
+	testCases := []struct {
+		name    string
+		content string
+	}{
+		{"Exited Process", strconv.Itoa(cmd.Process.Pid)},
+		{"Garbage", "not a pid"},
+		{"Empty", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "watchfor.pid")
+			if err := os.WriteFile(path, []byte(tc.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := pidfile.Write(path); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+			if pid, _ := pidfile.Read(path); pid != os.Getpid() {
+				t.Errorf("Expected pid %d, got %d", os.Getpid(), pid)
+			}
+		})
+	}
+}
+
+func TestWrite_RunningProcess(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("Cannot start sleep: %v", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	path := filepath.Join(t.TempDir(), "watchfor.pid")
+	if err := os.WriteFile(path, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pidfile.Write(path); !errors.Is(err, pidfile.ErrRunning) {
+		t.Fatalf("Expected ErrRunning, got %v", err)
+	}
+	if pid, _ := pidfile.Read(path); pid != cmd.Process.Pid {
+		t.Errorf("Expected the file to be left alone, got pid %d", pid)
+	}
+}
+
+func TestRemove_LeavesReplacedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watchfor.pid")
+	f, err := pidfile.Write(path)
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Remove(); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected the replaced file to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+// Package policy parses retry policies that set several retry flags at once,
+// such as "interval=2s,backoff=2,max=30s,jitter=0.3,retries=20".
+package policy
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// Keys maps the keys of a policy to the flags they set.
+var Keys = map[string]string{
+	"interval": "interval",
+	"backoff":  "backoff",
+	"max":      "max-delay",
+	"jitter":   "jitter",
+	"retries":  "max-retries",
+	"timeout":  "timeout",
+}
+
+// Setting is a flag value given by a policy.
+type Setting struct {
+	Key   string
+	Flag  string
+	Value string
+}
+
+// Parse splits a comma-separated list of key=value pairs into settings, in
+// order. Unknown, repeated and empty keys are errors; values are checked when
+// applied.
+func Parse(policy string) ([]Setting, error) {
+	var settings []Setting
+	for _, pair := range strings.Split(policy, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", pair)
+		}
+		flag, known := Keys[key]
+		if !known {
+			return nil, fmt.Errorf("unknown key %q, expected one of %s", key, strings.Join(sortedKeys(), ", "))
+		}
+		if slices.ContainsFunc(settings, func(s Setting) bool { return s.Key == key }) {
+			return nil, fmt.Errorf("key %q given twice", key)
+		}
+		settings = append(settings, Setting{Key: key, Flag: flag, Value: value})
+	}
+	return settings, nil
+}
+
+// Apply parses policy and sets the corresponding flags of fs, except those
+// already set on the command line, which take precedence. Values are parsed
+// like the flags' own.
+func Apply(fs *pflag.FlagSet, policy string) error {
+	settings, err := Parse(policy)
+	if err != nil {
+		return err
+	}
+	for _, s := range settings {
+		if fs.Changed(s.Flag) {
+			continue
+		}
+		if err := fs.Set(s.Flag, s.Value); err != nil {
+			return fmt.Errorf("invalid %s %q: %w", s.Key, s.Value, err)
+		}
+	}
+	return nil
+}
+
+func sortedKeys() []string {
+	keys := make([]string, 0, len(Keys))
+	for key := range Keys {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
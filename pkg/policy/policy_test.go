@@ -0,0 +1,83 @@
+package policy_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/gregory-chatelier/watchfor/pkg/policy"
+)
+
+func TestParse(t *testing.T) {
+	settings, err := policy.Parse("interval=2s, backoff=2,max=30s,jitter=0.3,retries=20,")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	expected := []policy.Setting{
+		{Key: "interval", Flag: "interval", Value: "2s"},
+		{Key: "backoff", Flag: "backoff", Value: "2"},
+		{Key: "max", Flag: "max-delay", Value: "30s"},
+		{Key: "jitter", Flag: "jitter", Value: "0.3"},
+		{Key: "retries", Flag: "max-retries", Value: "20"},
+	}
+	if !slices.Equal(settings, expected) {
+		t.Errorf("Expected %v, got %v", expected, settings)
+	}
+
+	for policyString, want := range map[string]string{
+		"interval=2s,delay=1s":    `unknown key "delay"`,
+		"interval":                "expected key=value",
+		"interval=":               "expected key=value",
+		"retries=3,retries=4":     `key "retries" given twice`,
+		"interval=1s,=2":          `unknown key ""`,
+		"timeout=5m,retries=many": "",
+	} {
+		_, err := policy.Parse(policyString)
+		if want == "" {
+			// Values are only checked by Apply.
+			if err != nil {
+				t.Errorf("Parse(%q): unexpected error %v", policyString, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Parse(%q): expected an error containing %q, got %v", policyString, want, err)
+		}
+	}
+}
+
+// flags returns a flag set with the flags a policy sets, parsed from args.
+func flags(t *testing.T, args ...string) (*pflag.FlagSet, *time.Duration, *float64, *int) {
+	t.Helper()
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	interval := fs.Duration("interval", time.Second, "")
+	backoff := fs.Float64("backoff", 1, "")
+	retries := fs.Int("max-retries", 10, "")
+	fs.Duration("max-delay", 0, "")
+	fs.Float64("jitter", 0, "")
+	fs.Duration("timeout", 0, "")
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	return fs, interval, backoff, retries
+}
+
+func TestApply(t *testing.T) {
+	// Explicit flags take precedence over the policy, whatever their order.
+	fs, interval, backoff, retries := flags(t, "--backoff", "3")
+	if err := policy.Apply(fs, "interval=2s,backoff=2,retries=20"); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if *interval != 2*time.Second || *backoff != 3 || *retries != 20 {
+		t.Errorf("Expected interval 2s, backoff 3 and retries 20, got %s, %g and %d", *interval, *backoff, *retries)
+	}
+
+	fs, _, _, _ = flags(t)
+	err := policy.Apply(fs, "retries=many")
+	if err == nil || !strings.Contains(err.Error(), `invalid retries "many"`) {
+		t.Errorf("Expected an invalid value error, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package poller
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+
+	"github.com/gregory-chatelier/watchfor/pkg/watcher"
+)
+
+// Error types recognized by the error policy.
+const (
+	ErrorTypeDNS        = "dns"        // Host name could not be resolved.
+	ErrorTypeTimeout    = "timeout"    // Network operation timed out.
+	ErrorTypeNetwork    = "network"    // Other network errors, e.g. connection refused.
+	ErrorTypeExit       = "exit"       // Command exited with a non-zero code.
+	ErrorTypeNotFound   = "not-found"  // File or directory does not exist.
+	ErrorTypePermission = "permission" // Access denied.
+	ErrorTypeExited     = "exited"     // Watched process is gone.
+	ErrorTypeOther      = "other"      // Anything else.
+)
+
+// ErrorTypes lists all error types, e.g. for validating user input.
+var ErrorTypes = []string{
+	ErrorTypeDNS, ErrorTypeTimeout, ErrorTypeNetwork, ErrorTypeExit,
+	ErrorTypeNotFound, ErrorTypePermission, ErrorTypeExited, ErrorTypeOther,
+}
+
+// defaultAbortTypes are errors that retrying will not fix. Non-zero exits,
+// timeouts and network blips are retried, as the source may still come up.
+var defaultAbortTypes = []string{ErrorTypeDNS, ErrorTypePermission, ErrorTypeExited}
+
+// DefaultAbortTypes returns the error types that end a run unless
+// WithAbortOnErrors says otherwise.
+func DefaultAbortTypes() []string {
+	return slices.Clone(defaultAbortTypes)
+}
+
+// errorPolicy decides whether a watcher error ends the run or is retried.
+type errorPolicy struct {
+	abort map[string]bool
+}
+
+func newErrorPolicy(abortTypes []string) errorPolicy {
+	policy := errorPolicy{abort: make(map[string]bool)}
+	for _, t := range abortTypes {
+		policy.abort[t] = true
+	}
+	return policy
+}
+
+// shouldAbort returns the error's type and whether it is fatal.
+func (ep errorPolicy) shouldAbort(err error) (string, bool) {
+	errType := classifyError(err)
+	return errType, ep.abort[errType]
+}
+
+// exitCode returns the exit code of the command behind err, if it ran and
+// exited with a non-zero code.
+func exitCode(err error) (int, bool) {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), true
+	}
+	return 0, false
+}
+
+func classifyError(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var exitErr *exec.ExitError
+
+	switch {
+	case errors.Is(err, watcher.ErrProcessExited):
+		return ErrorTypeExited
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		return ErrorTypeDNS
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorTypeTimeout
+	case errors.As(err, &netErr):
+		return ErrorTypeNetwork
+	case errors.As(err, &exitErr):
+		return ErrorTypeExit
+	case errors.Is(err, os.ErrNotExist):
+		return ErrorTypeNotFound
+	case errors.Is(err, os.ErrPermission):
+		return ErrorTypePermission
+	default:
+		return ErrorTypeOther
+	}
+}
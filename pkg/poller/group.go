@@ -0,0 +1,98 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// errResultKnown cancels the waits still running once RunAll knows the result.
+var errResultKnown = errors.New("the combined result is known")
+
+// Wait is a named poller, one of the waits run together by RunAll.
+type Wait struct {
+	Name   string
+	Poller *Poller
+}
+
+// WaitResult is the outcome of a wait run by RunAll.
+type WaitResult struct {
+	Name string
+	// Success reports whether the wait matched.
+	Success bool
+	// Reason is why the wait stopped, or "" if it was stopped early, or never
+	// started, because the combined result was already known.
+	Reason  Reason
+	Elapsed time.Duration
+}
+
+// RunAll runs the waits concurrently, each with the given schedule, at most
+// parallel of them at a time, or all of them if parallel is 0. The combined
+// wait succeeds once all of the waits have matched or, with anyOf, once one of
+// them has. The remaining waits are stopped as soon as the combined result is
+// known, e.g. when one fails without anyOf. ctx bounds all of them together.
+// RunAll returns the combined result and the result of each wait, in order.
+func RunAll(ctx context.Context, waits []Wait, parallel int, anyOf bool, interval time.Duration, maxRetries int, backoff float64, jitter float64) (bool, []WaitResult) {
+	groupCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(errResultKnown)
+	if parallel <= 0 || parallel > len(waits) {
+		parallel = len(waits)
+	}
+	slots := make(chan struct{}, parallel)
+
+	results := make([]WaitResult, len(waits))
+	var (
+		mu                sync.Mutex
+		decided, success  bool
+		matched, failures int
+	)
+	var wg sync.WaitGroup
+	for i, w := range waits {
+		results[i].Name = w.Name
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-groupCtx.Done():
+				return
+			}
+			if groupCtx.Err() != nil {
+				return
+			}
+
+			start := time.Now()
+			ok := w.Poller.Run(groupCtx, interval, maxRetries, backoff, jitter)
+
+			mu.Lock()
+			defer mu.Unlock()
+			// A wait stopped because the result was known has no result of
+			// its own, unless the shared deadline stopped it too.
+			if decided && !ok && ctx.Err() == nil {
+				return
+			}
+			results[i] = WaitResult{Name: w.Name, Success: ok, Reason: w.Poller.StopReason(), Elapsed: time.Since(start)}
+			if decided {
+				return
+			}
+			if ok {
+				matched++
+			} else {
+				failures++
+			}
+			switch {
+			case ok && (anyOf || matched == len(waits)):
+				decided, success = true, true
+			case !ok && (!anyOf || failures == len(waits)):
+				decided = true
+			}
+			if decided {
+				cancel(errResultKnown)
+			}
+		}()
+	}
+	wg.Wait()
+	return success, results
+}
@@ -0,0 +1,52 @@
+package poller
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// history keeps the most recent distinct outputs, so a marker that appears in
+// one attempt can still be matched after the next attempt overwrites it.
+type history struct {
+	entries [][]byte
+	size    int
+	// maxBytes caps the length of the combined history, or 0 for no cap.
+	maxBytes int
+	length   int
+}
+
+// add records an output, unless it is empty or identical to the previous one.
+// The oldest entries are evicted once more than size entries are held, or the
+// combined history would be longer than maxBytes. An output longer than maxBytes
+// on its own is cut down to its end, without splitting a UTF-8 sequence.
+func (h *history) add(output []byte) {
+	if len(output) == 0 {
+		return
+	}
+	if n := len(h.entries); n > 0 && bytes.Equal(h.entries[n-1], output) {
+		return
+	}
+	if h.maxBytes > 0 && len(output) > h.maxBytes {
+		output = output[len(output)-h.maxBytes:]
+		for i := 0; i < utf8.UTFMax-1 && len(output) > 0 && !utf8.RuneStart(output[0]); i++ {
+			output = output[1:]
+		}
+	}
+	h.entries = append(h.entries, bytes.Clone(output))
+	h.length += len(output)
+	for len(h.entries) > h.size || (h.maxBytes > 0 && h.combinedLen() > h.maxBytes) {
+		h.length -= len(h.entries[0])
+		h.entries[0] = nil
+		h.entries = h.entries[1:]
+	}
+}
+
+// combinedLen is the length of combined(), including the separators.
+func (h *history) combinedLen() int {
+	return h.length + len(h.entries) - 1
+}
+
+// combined returns the retained outputs, oldest first, separated by newlines.
+func (h *history) combined() []byte {
+	return bytes.Join(h.entries, []byte("\n"))
+}
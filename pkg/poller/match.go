@@ -0,0 +1,79 @@
+package poller
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+)
+
+// Match describes the output that matched, e.g. to fill in a templated
+// success command.
+type Match struct {
+	// Output is the whole output that matched, after preprocessing.
+	Output string
+	// Line is the line in which the match starts, without its newline.
+	Line string
+	// Text is the text the pattern matched.
+	Text string
+	// Group holds the capture groups of a regex pattern, by name for named
+	// groups and by number, "1", "2" and so on, for all of them. A group that
+	// did not take part in the match is empty.
+	Group map[string]string
+}
+
+// LastMatch returns what the last run matched, located with the first of the
+// patterns found in the output. It is false if the run did not match. With a
+// custom matcher, only Output is known.
+func (p *Poller) LastMatch() (Match, bool) {
+	if p.reason != ReasonMatched {
+		return Match{}, false
+	}
+	output := p.matchInput
+	m := Match{Output: string(output), Group: map[string]string{}}
+	if p.matcher != nil {
+		return m, true
+	}
+	for _, pattern := range p.patterns {
+		expr := pattern
+		if p.regex {
+			expr = p.regexPrefix() + pattern
+		} else {
+			expr = regexp.QuoteMeta(pattern)
+			if p.ignoreCase {
+				expr = "(?i)" + expr
+			}
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			continue
+		}
+		loc := re.FindSubmatchIndex(output)
+		if loc == nil {
+			continue
+		}
+		m.Text = string(output[loc[0]:loc[1]])
+		start := bytes.LastIndexByte(output[:loc[0]], '\n') + 1
+		end := bytes.IndexByte(output[loc[0]:], '\n')
+		if end < 0 {
+			end = len(output)
+		} else {
+			end += loc[0]
+		}
+		m.Line = string(bytes.TrimSuffix(output[start:end], []byte("\r")))
+		for i, name := range re.SubexpNames() {
+			if i == 0 {
+				continue
+			}
+			var value string // Empty for a group that did not take part.
+			if loc[2*i] >= 0 {
+				value = string(output[loc[2*i]:loc[2*i+1]])
+			}
+			m.Group[strconv.Itoa(i)] = value
+			if name != "" {
+				m.Group[name] = value
+			}
+		}
+		break
+	}
+	return m, true
+}
@@ -3,118 +3,1255 @@ package poller
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"hash/maphash"
+	"io"
+	"maps"
 	"math"
 	"math/rand"
+	"os"
 	"regexp"
+	"slices"
+	"strconv"
 	"time"
 
+	"github.com/gregory-chatelier/watchfor/pkg/matcher"
+	"github.com/gregory-chatelier/watchfor/pkg/transform"
 	"github.com/gregory-chatelier/watchfor/pkg/watcher"
 )
 
 // Poller manages the polling loop, checking for a pattern from a watcher.
 type Poller struct {
 	w          watcher.Watcher
-	pattern    string
+	patterns   []string
+	matchAll   bool
+	state      matchState
 	verbose    bool
 	regex      bool
 	ignoreCase bool
+	regexFlags string
+	matcher    matcher.Matcher
+	require    matcher.Matcher
+	trigger    <-chan struct{}
+	transforms []transform.Func
+	out        io.Writer
+	onAttempt  func(Attempt)
+	errPolicy  errorPolicy
+	abortExit  []int
+	shuffle    bool
+	// checked is the output of the most recent check, and lastOutput the one
+	// kept for LastOutput.
+	checked     []byte
+	lastOutput  []byte
+	matchInput  []byte
+	rng         *rand.Rand
+	heartbeat   string
+	history     *history
+	maxHistory  int
+	newlines    bool
+	probe       func() error
+	matchLimit  time.Duration
+	settle      time.Duration
+	minElapsed  time.Duration
+	minDistinct int
+	minCount    int
+	countRe     *regexp.Regexp
+	countErr    error
+
+	// patternWindow bounds the time to match from firstOutput, the time of the
+	// first non-empty output.
+	patternWindow time.Duration
+	firstOutput   time.Time
+	// waitBudget bounds the total time slept between checks, and waited is
+	// the time slept so far.
+	waitBudget time.Duration
+	waited     time.Duration
+	// anchored grows each delay from the previous one, prevDelay.
+	anchored  bool
+	prevDelay float64
+	// delayCap is the longest single wait, maxDelay by default.
+	delayCap time.Duration
+
+	reason     Reason
+	finalCheck bool
+
+	// timeoutGrace is how long a check in progress at the deadline may go on.
+	timeoutGrace time.Duration
+
+	passthrough io.Writer
+	passPrefix  string
+	annotate    bool
+	dedupLog    bool
+
+	// maxEmpty is how many successful checks in a row may return nothing, and
+	// empty how many did so far.
+	maxEmpty int
+	empty    int
+
+	// With skipUnchanged, lastSum is the hash of the last output that was matched,
+	// and lastTransformed the result of its preprocessing.
+	skipUnchanged   bool
+	hashSeed        maphash.Seed
+	lastSum         *uint64
+	lastTransformed []byte
+
+	// stableOutput is how many checks in a row must return the same output,
+	// lastStable, and stableRun how many did so far.
+	stableOutput int
+	stableRun    int
+	lastStable   []byte
+
+	progressRe  *regexp.Regexp
+	minInterval time.Duration
+
+	// Progress of the current run, see Status.
+	start      time.Time
+	deadline   time.Time
+	attempts   int
+	maxRetries int
+}
+
+// Option configures optional Poller behavior.
+type Option func(*Poller)
+
+// WithMatcher replaces the pattern matching with a custom matcher.
+func WithMatcher(m matcher.Matcher) Option {
+	return func(p *Poller) {
+		p.matcher = m
+	}
+}
+
+// WithPrecondition requires outputs to satisfy m before they are matched, e.g.
+// a schema that a service's response must follow. Other outputs are non-matches.
+func WithPrecondition(m matcher.Matcher) Option {
+	return func(p *Poller) {
+		p.require = m
+	}
+}
+
+// WithTrigger wakes the poller for an immediate check whenever the channel
+// receives, in addition to the regular interval.
+func WithTrigger(c <-chan struct{}) Option {
+	return func(p *Poller) {
+		p.trigger = c
+	}
+}
+
+// WithPatterns adds patterns to search for. By default any one of them is enough.
+func WithPatterns(patterns ...string) Option {
+	return func(p *Poller) {
+		p.patterns = append(p.patterns, patterns...)
+	}
+}
+
+// WithRegexFlags sets flags for regex patterns, in addition to i when matching is
+// case-insensitive: s lets . match a newline, m makes ^ and $ match at line
+// boundaries. They have no effect on plain patterns.
+func WithRegexFlags(flags string) Option {
+	return func(p *Poller) {
+		p.regexFlags = flags
+	}
+}
+
+// WithMinDistinctLines matches line by line, and succeeds once n distinct lines
+// have matched, possibly across attempts. Repeated lines, e.g. from a retry that
+// logs the same message again, are only counted once. Surrounding whitespace is ignored.
+func WithMinDistinctLines(n int) Option {
+	return func(p *Poller) {
+		p.minDistinct = n
+	}
+}
+
+// WithMinCount succeeds once the pattern has occurred n times, counting the
+// occurrences in every output since the run started. It suits sources that only
+// return new content, such as a file: the output of a command is counted again on
+// every check. An occurrence split across two outputs is not counted. MatchOffset
+// then reports where the nth occurrence starts.
+func WithMinCount(n int) Option {
+	return func(p *Poller) {
+		p.minCount = n
+	}
+}
+
+// WithStableOutput makes Run succeed only once n checks in a row have returned
+// the same output, after preprocessing, e.g. for a replica count to converge.
+// Checks that fail break the run. Without patterns or a matcher, the stable
+// output is enough; otherwise the last one must also match.
+func WithStableOutput(n int) Option {
+	return func(p *Poller) {
+		p.stableOutput = n
+	}
+}
+
+// MatchOffset returns the position of the occurrence that reached the count of
+// WithMinCount, in bytes from the start of the first output of the run, after
+// preprocessing. It is -1 until then, and without WithMinCount.
+func (p *Poller) MatchOffset() int64 {
+	if p.minCount == 0 || p.state.count < p.minCount {
+		return -1
+	}
+	return p.state.offset
+}
+
+// WithMatchAll requires every pattern to be seen, not necessarily in the same attempt.
+func WithMatchAll() Option {
+	return func(p *Poller) {
+		p.matchAll = true
+	}
+}
+
+// WithAdaptiveInterval shortens the wait as the watched source reports progress.
+// The first capture group of re must extract a percentage (0-100) from the output;
+// the wait then shrinks linearly from the interval at 0% to minInterval at 100%.
+// When the value cannot be extracted, the regular backoff applies.
+func WithAdaptiveInterval(re *regexp.Regexp, minInterval time.Duration) Option {
+	return func(p *Poller) {
+		p.progressRe = re
+		p.minInterval = minInterval
+	}
+}
+
+// WithTransforms rewrites each output with the given functions, in order, before matching.
+func WithTransforms(fns ...transform.Func) Option {
+	return func(p *Poller) {
+		p.transforms = append(p.transforms, fns...)
+	}
+}
+
+// WithNormalizedNewlines converts CRLF and CR line endings to LF before the
+// transforms and matching, so line-based patterns behave the same on every platform.
+// Verbose logs still show the raw output.
+func WithNormalizedNewlines() Option {
+	return func(p *Poller) {
+		p.newlines = true
+	}
+}
+
+// WithProbe runs probe before each check. When it returns an error, the check is
+// skipped and the attempt counts as a non-match, e.g. to avoid hitting an expensive
+// target while a cheap precondition does not hold.
+func WithProbe(probe func() error) Option {
+	return func(p *Poller) {
+		p.probe = probe
+	}
+}
+
+// WithMatchTimeout bounds the time spent matching a single output. A match that
+// takes longer counts as a non-match, with a warning. The abandoned evaluation
+// keeps running in the background until it completes.
+func WithMatchTimeout(d time.Duration) Option {
+	return func(p *Poller) {
+		p.matchLimit = d
+	}
+}
+
+// WithAnchoredBackoff computes each delay as the previous one, jitter included,
+// times the backoff factor, instead of interval * backoff^attempt. Jitter then
+// accumulates, so delays grow smoothly and never shrink from one attempt to the
+// next. Without jitter, both give the same delays.
+func WithAnchoredBackoff() Option {
+	return func(p *Poller) {
+		p.anchored = true
+	}
+}
+
+// WithMaxDelay caps each wait between checks at d, once backoff and jitter
+// have been applied, so that a growing backoff levels off. Waits are never
+// longer than an hour, whatever d.
+func WithMaxDelay(d time.Duration) Option {
+	return func(p *Poller) {
+		if d > 0 && d < maxDelay {
+			p.delayCap = d
+		}
+	}
+}
+
+// WithMaxWaitTotal bounds the total time spent waiting between checks to d,
+// however long the checks themselves take. Unlike the context deadline, slow
+// checks do not use up the budget. The last wait is shortened so that a final
+// check is made as the budget runs out; Run then fails with ReasonWaitBudget.
+func WithMaxWaitTotal(d time.Duration) Option {
+	return func(p *Poller) {
+		p.waitBudget = d
+	}
+}
+
+// WithPatternTimeout requires the pattern to match within d of the first check
+// that returns any output, e.g. a service that started logging but must become
+// ready soon after. Unlike the context deadline, the window only starts once the
+// source shows signs of life. When it expires, Run fails with ReasonPatternWindowExpired.
+func WithPatternTimeout(d time.Duration) Option {
+	return func(p *Poller) {
+		p.patternWindow = d
+	}
+}
+
+// WithPassthrough copies the raw output of every check to w as soon as the
+// check returns, with prefix before each line, so the source can be followed
+// live. A missing final newline is added.
+func WithPassthrough(w io.Writer, prefix string) Option {
+	return func(p *Poller) {
+		p.passthrough = w
+		p.passPrefix = prefix
+	}
+}
+
+// WithAnnotate prefixes each line of the outputs logged in verbose mode, and
+// of the passthrough output, with the attempt number and the time, as in
+// "[attempt=3 t=14:05:09] ". The output that is matched is not affected.
+func WithAnnotate() Option {
+	return func(p *Poller) {
+		p.annotate = true
+	}
+}
+
+// WithDedupLog collapses runs of identical consecutive lines in the outputs
+// logged in verbose mode, and in the passthrough output, into a single line
+// followed by the count, as in "retrying (x42)". Runs are collapsed within each
+// output. The output that is matched is not affected.
+func WithDedupLog() Option {
+	return func(p *Poller) {
+		p.dedupLog = true
+	}
+}
+
+// WithMaxEmpty fails the run with ReasonSourceSilent when more than n successful
+// checks in a row return no output, e.g. because the producer of a log died.
+// Checks that fail neither count as empty nor reset the count.
+func WithMaxEmpty(n int) Option {
+	return func(p *Poller) {
+		p.maxEmpty = n
+	}
+}
+
+// WithTimeoutGrace lets a check still in progress when the context's deadline
+// expires go on for up to d longer, and counts it if it matches. Without it, a
+// check that honors the context is cancelled at the deadline. No new check is
+// started after the deadline.
+func WithTimeoutGrace(d time.Duration) Option {
+	return func(p *Poller) {
+		p.timeoutGrace = d
+	}
+}
+
+// WithFinalCheck makes one more check when the context is done during a wait,
+// before giving up, so a pattern that shows up right at the deadline is not
+// missed. The check gets the polling interval, and at least a second, to complete.
+// Settling is skipped after a match on the final check. Only a done context
+// leads to it: reaching maxRetries makes no extra check, as the last attempt
+// already was one.
+func WithFinalCheck() Option {
+	return func(p *Poller) {
+		p.finalCheck = true
+	}
+}
+
+// WithSkipUnchanged skips preprocessing and matching when a check returns the
+// same output as the last one that was matched, reusing its result instead. This
+// saves work when the source is cheap to check but the output costly to match.
+// Preprocessing is assumed to be deterministic: the same output always gives the
+// same result. Match history is not affected, as it ignores repeated outputs anyway.
+func WithSkipUnchanged() Option {
+	return func(p *Poller) {
+		p.skipUnchanged = true
+		p.hashSeed = maphash.MakeSeed()
+	}
+}
+
+// WithSettle waits d after a match before Run returns, giving a just-ready system
+// time to settle before acting on it. If ctx is done meanwhile, Run fails with
+// ReasonTimeoutAfterMatch, as the pattern did match.
+func WithSettle(d time.Duration) Option {
+	return func(p *Poller) {
+		p.settle = d
+	}
+}
+
+// WithMinElapsed makes Run take at least d from its start when it succeeds,
+// waiting after a match that came sooner, e.g. to respect a rate limit. Unlike
+// WithSettle, the wait is counted from the start, settle time included. If ctx
+// is done meanwhile, Run fails with ReasonTimeoutAfterMatch.
+func WithMinElapsed(d time.Duration) Option {
+	return func(p *Poller) {
+		p.minElapsed = d
+	}
+}
+
+// WithOutput sends the poller's log messages to w instead of stdout.
+func WithOutput(w io.Writer) Option {
+	return func(p *Poller) {
+		p.out = w
+	}
+}
+
+// WithAbortOnErrors replaces the error types (see ErrorTypes) that end the run
+// immediately instead of being retried. By default, DNS and permission errors abort.
+func WithAbortOnErrors(errorTypes ...string) Option {
+	return func(p *Poller) {
+		p.errPolicy = newErrorPolicy(errorTypes)
+	}
+}
+
+// WithAbortOnExitCodes ends the run immediately when the watched command exits
+// with one of codes, e.g. 127 for a command that is not installed, instead of
+// retrying it like other non-zero exits.
+func WithAbortOnExitCodes(codes ...int) Option {
+	return func(p *Poller) {
+		p.abortExit = codes
+	}
+}
+
+// WithShuffledSources varies the order in which a watcher combining several
+// sources (see watcher.Shuffler) checks them, before every check, so that the
+// first one does not always go first. It uses the generator of the jitter.
+func WithShuffledSources() Option {
+	return func(p *Poller) {
+		p.shuffle = true
+	}
+}
+
+// WithRandSource uses src for the jitter computation and WithShuffledSources, e.g. to
+// make delays reproducible.
+// Each Poller owns its generator, so concurrent pollers never contend on a shared lock,
+// but src itself must not be shared with other goroutines.
+func WithRandSource(src rand.Source) Option {
+	return func(p *Poller) {
+		p.rng = rand.New(src)
+	}
+}
+
+// WithHeartbeat touches the file at path after every check, creating it if needed,
+// so an external watchdog can tell from its mtime that the poller is not stuck.
+// Failing to touch it is logged but does not stop the run.
+func WithHeartbeat(path string) Option {
+	return func(p *Poller) {
+		p.heartbeat = path
+	}
+}
+
+// WithMatchHistory matches against the combined history of outputs rather than the
+// latest one, so a marker that appears in a single attempt is still found after it
+// disappears. Consecutive identical outputs are stored once, and only the size most
+// recent distinct outputs are kept, oldest first, joined by newlines.
+func WithMatchHistory(size int) Option {
+	return func(p *Poller) {
+		p.history = &history{size: max(size, 1)}
+	}
+}
+
+// WithMaxHistoryBytes caps the combined history kept by WithMatchHistory, evicting
+// the oldest outputs first. A pattern that spanned an evicted output can no longer match.
+func WithMaxHistoryBytes(n int) Option {
+	return func(p *Poller) {
+		p.maxHistory = n
+	}
 }
 
 // New creates a new Poller.
-func New(w watcher.Watcher, pattern string, verbose bool, regex bool, ignoreCase bool) *Poller {
-	return &Poller{
+func New(w watcher.Watcher, pattern string, verbose bool, regex bool, ignoreCase bool, opts ...Option) *Poller {
+	p := &Poller{
 		w:          w,
-		pattern:    pattern,
+		state:      newMatchState(),
+		out:        os.Stdout,
+		errPolicy:  newErrorPolicy(defaultAbortTypes),
+		rng:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		delayCap:   maxDelay,
 		verbose:    verbose,
 		regex:      regex,
 		ignoreCase: ignoreCase,
 	}
+	if pattern != "" {
+		p.patterns = []string{pattern}
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.history != nil {
+		p.history.maxBytes = p.maxHistory
+	}
+	if p.minCount > 0 {
+		p.countRe, p.countErr = p.compileCount()
+	}
+	return p
+}
+
+// Attempt is a progress update sent by RunChan.
+type Attempt struct {
+	// Number is the 1-based attempt number.
+	Number int
+	// Output is the (transformed) output that was matched.
+	Output []byte
+	// Err is the error returned by the watcher, if any.
+	Err error
+	// Matched reports whether this attempt's output matched.
+	Matched bool
+	// Done marks the final element, sent after the last attempt.
+	Done bool
+	// Success is the overall result. It is only set on the final element.
+	Success bool
+}
+
+// RunChan runs the polling loop in a goroutine and streams an Attempt after each check.
+// The last element has Done set and carries the overall result, then the channel is closed.
+//
+// The channel has a buffer of one: the loop blocks until the consumer has taken the
+// previous update, so a slow consumer slows polling down rather than losing updates.
+// Once ctx is cancelled, updates the consumer is not ready for are dropped so the
+// goroutine can exit; the final element and the close are always delivered.
+// Log messages are still written to the poller's output (see WithOutput).
+func (p *Poller) RunChan(ctx context.Context, interval time.Duration, maxRetries int, backoff float64, jitter float64) <-chan Attempt {
+	ch := make(chan Attempt, 1)
+	p.onAttempt = func(a Attempt) {
+		select {
+		case ch <- a:
+		case <-ctx.Done():
+		}
+	}
+
+	go func() {
+		defer close(ch)
+		success := p.Run(ctx, interval, maxRetries, backoff, jitter)
+		p.onAttempt = nil
+
+		final := Attempt{Done: true, Success: success}
+		select {
+		case ch <- final:
+		case <-ctx.Done():
+			// Drop a stale update the consumer hasn't taken, so the final one fits.
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- final
+		}
+	}()
+	return ch
 }
 
 // Run starts the polling loop and returns true if the pattern is found.
 func (p *Poller) Run(ctx context.Context, interval time.Duration, maxRetries int, backoff float64, jitter float64) bool {
+	p.start, p.attempts, p.maxRetries = time.Now(), 0, maxRetries
+	p.deadline, _ = ctx.Deadline()
+	p.firstOutput, p.reason, p.lastSum, p.empty = time.Time{}, "", nil, 0
+	p.waited, p.prevDelay = 0, 0
+	p.stableRun, p.lastStable = 0, nil
+	p.lastOutput = nil
+	p.state.count, p.state.consumed, p.state.offset = 0, 0, -1
+
 	attempt := 0
 	for {
-		output, err := p.w.Check()
-		if err != nil {
-			if p.verbose {
-				fmt.Printf("Attempt %d: Error checking watcher: %v\n", attempt+1, err)
-				// Print the output even on error, as the pattern might be in the combined output
-				if len(output) > 0 {
-					fmt.Printf("Attempt %d: Output:\n%s\n", attempt+1, string(output))
-				}
+		p.attempts = attempt + 1
+		var output []byte
+		var checkErr error
+		matched := false
+		if p.probe == nil || p.runProbe(attempt) {
+			var err error
+			checkCtx, cancel := p.graceContext(ctx)
+			output, checkErr, matched, err = p.check(checkCtx, attempt)
+			cancel()
+			if err != nil {
+				fmt.Fprintf(p.out, "Error matching pattern: %v\n", err)
+				p.reason = ReasonMatchError
+				return false // Consider this a fatal error
 			}
-		} else if p.verbose {
-			fmt.Printf("Attempt %d: Command successful. Checking output...\n", attempt+1)
-			if len(output) > 0 {
-				fmt.Printf("Attempt %d: Output:\n%s\n", attempt+1, string(output))
+			if p.firstOutput.IsZero() && len(p.checked) > 0 {
+				p.firstOutput = time.Now()
+			}
+			if checkErr == nil {
+				p.countEmpty(p.checked)
 			}
 		}
 
-		matched, err := p.match(output)
-		if err != nil {
-			fmt.Printf("Error matching pattern: %v\n", err)
-			return false // Consider this a fatal error
+		if p.onAttempt != nil {
+			p.onAttempt(Attempt{Number: attempt + 1, Output: output, Err: checkErr, Matched: matched})
 		}
 
 		if matched {
-			fmt.Println("Pattern found!")
-			return true // Success
+			fmt.Fprintln(p.out, "Pattern found!")
+			p.reason = ReasonMatched
+			if p.timeoutGrace > 0 && ctx.Err() != nil {
+				// Found during the grace period: there is no time left to settle.
+				return true
+			}
+			return p.waitSettle(ctx)
+		}
+
+		if checkErr != nil {
+			if code, ok := exitCode(checkErr); ok && slices.Contains(p.abortExit, code) {
+				fmt.Fprintf(p.out, "Aborting on exit code %d: %v\n", code, checkErr)
+				p.reason = ReasonAborted
+				return false // Failure
+			}
+			if errType, abort := p.errPolicy.shouldAbort(checkErr); abort {
+				fmt.Fprintf(p.out, "Aborting on non-retryable %s error: %v\n", errType, checkErr)
+				p.reason = ReasonAborted
+				return false // Failure
+			}
 		}
 
 		// Check if we should stop.
+		if p.maxEmpty > 0 && p.empty > p.maxEmpty {
+			fmt.Fprintf(p.out, "Source silent for %d consecutive checks.\n", p.empty)
+			p.reason = ReasonSourceSilent
+			return false // Failure
+		}
+		if left, ok := p.windowLeft(); ok && left <= 0 {
+			fmt.Fprintf(p.out, "Pattern not found within %s of the first output.\n", p.patternWindow)
+			p.reason = ReasonPatternWindowExpired
+			return false // Failure
+		}
+		if p.waitBudget > 0 && p.waited >= p.waitBudget {
+			fmt.Fprintf(p.out, "Wait budget of %s used up.\n", p.waitBudget)
+			p.reason = ReasonWaitBudget
+			return false // Failure
+		}
 		if maxRetries > 0 && attempt >= maxRetries-1 {
-			fmt.Println("Max retries reached.")
+			fmt.Fprintln(p.out, "Max retries reached.")
+			p.reason = ReasonMaxRetries
 			return false // Failure
 		}
 
 		attempt++
 
 		// Calculate next delay
-		delay := float64(interval) * math.Pow(backoff, float64(attempt))
+		delay := baseDelay(interval, backoff, attempt)
+		if p.anchored && p.prevDelay > 0 {
+			delay = p.prevDelay * backoff
+		}
+		if progress, ok := p.progress(output); ok {
+			delay = float64(interval) - float64(interval-p.minInterval)*progress/100
+			if p.verbose {
+				fmt.Fprintf(p.out, "Progress at %g%%.\n", progress)
+			}
+		}
 
 		// Add jitter
 		if jitter > 0 {
 			jitterAmount := delay * jitter
-			delay += rand.Float64() * jitterAmount
+			delay += p.rng.Float64() * jitterAmount
 		}
+		p.prevDelay = math.Min(delay, float64(p.delayCap))
 
-		// Cap the delay to prevent overflow and excessive waiting (e.g., 1 hour max)
-		maxDelay := float64(time.Hour)
-		if delay > maxDelay {
-			delay = maxDelay
+		nextInterval := capDelay(delay, p.delayCap)
+		if left, ok := p.windowLeft(); ok && left < nextInterval {
+			// Check one last time as the window closes.
+			nextInterval = left
+		}
+		if left := p.waitBudget - p.waited; p.waitBudget > 0 && left < nextInterval {
+			nextInterval = left
 		}
-
-		nextInterval := time.Duration(delay)
 
 		if p.verbose {
-			fmt.Printf("No pattern match. Waiting %s before next attempt.\n", nextInterval)
+			fmt.Fprintf(p.out, "No pattern match. Waiting %s before next attempt.\n", nextInterval)
 		}
 
 		// Wait before next attempt
+		waitStart := time.Now()
 		select {
 		case <-ctx.Done():
-			fmt.Println("Timeout reached.")
+			if context.Cause(ctx) == errResultKnown {
+				// Stopped by RunAll, which no longer needs this wait.
+				p.reason = ReasonAborted
+				return false
+			}
+			fmt.Fprintln(p.out, "Timeout reached.")
+			if p.finalCheck {
+				return p.runFinalCheck(ctx, attempt, interval)
+			}
+			p.reason = ReasonTimeout
 			return false // Failure due to timeout
 		case <-time.After(nextInterval):
 			// Continue to next iteration
+		case <-p.trigger:
+			if p.verbose {
+				fmt.Fprintln(p.out, "Trigger fired. Checking now.")
+			}
 		}
+		p.waited += time.Since(waitStart)
 	}
 }
 
-func (p *Poller) match(output []byte) (bool, error) {
+// check runs the watcher once and matches its preprocessed output. The returned
+// output is the one that was matched; err is a fatal matching error.
+func (p *Poller) check(ctx context.Context, attempt int) (output []byte, checkErr error, matched bool, err error) {
+	if s, ok := p.w.(watcher.Shuffler); ok && p.shuffle {
+		s.Shuffle(p.rng.Shuffle)
+	}
+	if cw, ok := p.w.(watcher.ContextWatcher); ok {
+		output, checkErr = cw.CheckContext(ctx)
+	} else {
+		output, checkErr = p.w.Check()
+	}
+	p.checked = output
+	p.recordOutput(output)
+	if p.passthrough != nil {
+		writeLines(p.passthrough, p.annotation(attempt)+p.passPrefix, p.display(output))
+	}
+	if errors.Is(checkErr, watcher.ErrTruncated) {
+		// Informational only: the output is valid and nothing needs retrying.
+		if p.verbose {
+			fmt.Fprintf(p.out, "Attempt %d: %v\n", attempt+1, checkErr)
+		}
+		checkErr = nil
+	}
+	if p.heartbeat != "" {
+		if err := touch(p.heartbeat); err != nil {
+			fmt.Fprintf(p.out, "Attempt %d: Failed to update heartbeat file: %v\n", attempt+1, err)
+		}
+	}
+	if errors.Is(checkErr, watcher.ErrNoNewData) {
+		// Nothing changed since the last check, which did not match either.
+		if p.verbose {
+			fmt.Fprintf(p.out, "Attempt %d: No new data.\n", attempt+1)
+		}
+		return nil, nil, false, nil
+	}
+	if ec, ok := p.w.(watcher.ExitCoder); ok && p.verbose {
+		fmt.Fprintf(p.out, "Attempt %d: exit=%d\n", attempt+1, ec.ExitCode())
+	}
+	if checkErr != nil {
+		if p.verbose {
+			fmt.Fprintf(p.out, "Attempt %d: Error checking watcher: %v\n", attempt+1, checkErr)
+			// Print the output even on error, as the pattern might be in the combined output
+			p.printOutput(attempt, "Output", output)
+		}
+	} else if p.verbose {
+		fmt.Fprintf(p.out, "Attempt %d: Command successful. Checking output...\n", attempt+1)
+		p.printOutput(attempt, "Output", output)
+	}
+
+	var sum uint64
+	if p.skipUnchanged {
+		sum = maphash.Bytes(p.hashSeed, output)
+		if p.lastSum != nil && *p.lastSum == sum {
+			// The output was matched before, and did not match then.
+			if p.verbose {
+				fmt.Fprintf(p.out, "Attempt %d: Output unchanged, skipping the match.\n", attempt+1)
+			}
+			return p.lastTransformed, checkErr, false, nil
+		}
+	}
+
+	transformed, err := p.transform(output)
+	if err != nil {
+		// A failing transform is retried like a non-matching output.
+		fmt.Fprintf(p.out, "Attempt %d: Transform failed: %v\n", attempt+1, err)
+		p.lastSum = nil
+		return nil, checkErr, false, nil
+	}
+	if len(p.transforms) > 0 && p.verbose {
+		p.printOutput(attempt, "Transformed output", transformed)
+	}
+
+	matchInput := transformed
+	if p.history != nil {
+		p.history.add(transformed)
+		matchInput = p.history.combined()
+	}
+	if p.matchLimit > 0 {
+		matched, err = p.matchWithTimeout(attempt, matchInput)
+	} else {
+		matched, err = p.match(matchInput, &p.state)
+	}
+	if p.stableOutput > 0 {
+		stable := p.countStable(attempt, transformed, checkErr)
+		matched = stable && (matched || len(p.patterns) == 0 && p.matcher == nil)
+	}
+	if matched {
+		p.matchInput = matchInput
+	}
+	if p.skipUnchanged {
+		p.lastSum, p.lastTransformed = &sum, transformed
+	}
+	return transformed, checkErr, matched, err
+}
+
+// runProbe reports whether the probe allows this attempt's check.
+func (p *Poller) runProbe(attempt int) bool {
+	err := p.probe()
+	if err != nil && p.verbose {
+		fmt.Fprintf(p.out, "Attempt %d: Probe failed, skipping the check: %v\n", attempt+1, err)
+	}
+	return err == nil
+}
+
+// runFinalCheck checks one last time after the timeout, in case the pattern showed
+// up just as the last wait ended. As ctx is done, the check gets its own time limit.
+func (p *Poller) runFinalCheck(ctx context.Context, attempt int, interval time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), max(interval, time.Second))
+	defer cancel()
+
+	fmt.Fprintln(p.out, "Making a final check.")
+	p.attempts = attempt + 1
+	output, checkErr, matched, err := p.check(ctx, attempt)
+	if err != nil {
+		fmt.Fprintf(p.out, "Error matching pattern: %v\n", err)
+		p.reason = ReasonMatchError
+		return false
+	}
+	if p.onAttempt != nil {
+		p.onAttempt(Attempt{Number: attempt + 1, Output: output, Err: checkErr, Matched: matched})
+	}
+	if !matched {
+		p.reason = ReasonTimeout
+		return false
+	}
+	// There is no time left to settle.
+	fmt.Fprintln(p.out, "Pattern found!")
+	p.reason = ReasonMatched
+	return true
+}
+
+// graceContext returns the context for a check: ctx, except that expiring its
+// deadline only cancels the check WithTimeoutGrace later. Cancelling ctx
+// still cancels the check at once.
+func (p *Poller) graceContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if p.timeoutGrace <= 0 || !ok {
+		return ctx, func() {}
+	}
+	graceCtx, cancel := context.WithDeadline(context.WithoutCancel(ctx), deadline.Add(p.timeoutGrace))
+	stop := context.AfterFunc(ctx, func() {
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			cancel()
+		}
+	})
+	return graceCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// printOutput logs an output in verbose mode, annotated if requested.
+func (p *Poller) printOutput(attempt int, label string, output []byte) {
+	if len(output) == 0 {
+		return
+	}
+	output = p.display(output)
+	if !p.annotate {
+		fmt.Fprintf(p.out, "Attempt %d: %s:\n%s\n", attempt+1, label, string(output))
+		return
+	}
+	fmt.Fprintf(p.out, "Attempt %d: %s:\n", attempt+1, label)
+	writeLines(p.out, p.annotation(attempt), output)
+}
+
+// annotation returns the prefix for the lines of an output when annotating, or "".
+func (p *Poller) annotation(attempt int) string {
+	if !p.annotate {
+		return ""
+	}
+	return fmt.Sprintf("[attempt=%d t=%s] ", attempt+1, time.Now().Format(time.TimeOnly))
+}
+
+// display returns output as it is shown, with repeated lines collapsed when
+// requested.
+func (p *Poller) display(output []byte) []byte {
+	if !p.dedupLog || len(output) == 0 {
+		return output
+	}
+	return collapseRepeats(output)
+}
+
+// collapseRepeats replaces each run of identical consecutive lines with one
+// line, followed by " (xN)" when the run has more than one line.
+func collapseRepeats(output []byte) []byte {
+	var buf bytes.Buffer
+	var prev []byte
+	count := 0
+	flush := func() {
+		if count == 0 {
+			return
+		}
+		buf.Write(prev)
+		if count > 1 {
+			fmt.Fprintf(&buf, " (x%d)", count)
+		}
+		buf.WriteByte('\n')
+	}
+	for line := range bytes.Lines(output) {
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		if count > 0 && bytes.Equal(line, prev) {
+			count++
+			continue
+		}
+		flush()
+		prev, count = line, 1
+	}
+	flush()
+	if output[len(output)-1] != '\n' {
+		buf.Truncate(buf.Len() - 1)
+	}
+	return buf.Bytes()
+}
+
+// writeLines writes output to w with prefix before each line, adding a missing
+// final newline.
+func writeLines(w io.Writer, prefix string, output []byte) {
+	if len(output) == 0 {
+		return
+	}
+	if prefix == "" {
+		w.Write(output)
+	} else {
+		for line := range bytes.Lines(output) {
+			fmt.Fprint(w, prefix)
+			w.Write(line)
+		}
+	}
+	if output[len(output)-1] != '\n' {
+		fmt.Fprintln(w)
+	}
+}
+
+// countEmpty counts consecutive empty outputs of successful checks.
+func (p *Poller) countEmpty(output []byte) {
+	if len(output) == 0 {
+		p.empty++
+	} else {
+		p.empty = 0
+	}
+}
+
+// countStable counts the checks in a row that returned the same output, and
+// reports whether there are enough of them.
+func (p *Poller) countStable(attempt int, output []byte, checkErr error) bool {
+	switch {
+	case checkErr != nil:
+		p.stableRun, p.lastStable = 0, nil
+		return false
+	case p.stableRun > 0 && bytes.Equal(output, p.lastStable):
+		p.stableRun++
+	default:
+		p.stableRun, p.lastStable = 1, bytes.Clone(output)
+	}
+	if p.verbose {
+		fmt.Fprintf(p.out, "Attempt %d: Same output for %d of %d checks.\n", attempt+1, p.stableRun, p.stableOutput)
+	}
+	return p.stableRun >= p.stableOutput
+}
+
+// windowLeft returns the time left to match within the pattern window, and
+// false if there is no window, or it has not started yet.
+func (p *Poller) windowLeft() (time.Duration, bool) {
+	if p.patternWindow <= 0 || p.firstOutput.IsZero() {
+		return 0, false
+	}
+	return p.patternWindow - time.Since(p.firstOutput), true
+}
+
+// waitSettle waits for the settle time after a match, then until the minimum
+// elapsed time is reached, reporting whether it completed.
+func (p *Poller) waitSettle(ctx context.Context) bool {
+	if p.settle > 0 {
+		fmt.Fprintf(p.out, "Settling for %s before continuing.\n", p.settle)
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(p.out, "Timeout reached while settling.")
+			p.reason = ReasonTimeoutAfterMatch
+			return false
+		case <-time.After(p.settle):
+		}
+	}
+	if left := p.minElapsed - time.Since(p.start); left > 0 {
+		fmt.Fprintf(p.out, "Waiting %s more, to take at least %s in total.\n", left.Round(time.Millisecond), p.minElapsed)
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(p.out, "Timeout reached before the minimum wait was over.")
+			p.reason = ReasonTimeoutAfterMatch
+			return false
+		case <-time.After(left):
+		}
+	}
+	return true // Success
+}
+
+// LastOutput returns the complete, untransformed output of the most recent check
+// that returned any. For a watcher.Incremental source, which only returns new
+// content, it is everything returned during the run, up to the last
+// maxLastOutput bytes.
+func (p *Poller) LastOutput() []byte {
+	return p.lastOutput
+}
+
+// maxLastOutput bounds the output accumulated for LastOutput.
+const maxLastOutput = 1 << 20
+
+// recordOutput keeps a check's output for LastOutput, unless it is empty.
+func (p *Poller) recordOutput(output []byte) {
+	if len(output) == 0 {
+		return
+	}
+	if inc, ok := p.w.(watcher.Incremental); !ok || !inc.Incremental() {
+		p.lastOutput = output
+		return
+	}
+	p.lastOutput = append(p.lastOutput, output...)
+	if over := len(p.lastOutput) - maxLastOutput; over > 0 {
+		p.lastOutput = p.lastOutput[over:]
+	}
+}
+
+// touch sets the file's modification time to now, creating it if it doesn't exist.
+func touch(path string) error {
+	now := time.Now()
+	err := os.Chtimes(path, now, now)
+	if os.IsNotExist(err) {
+		var f *os.File
+		f, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+		if err == nil {
+			err = f.Close()
+		}
+	}
+	return err
+}
+
+// maxDelay caps a single wait to prevent overflow and excessive waiting.
+const maxDelay = time.Hour
+
+// baseDelay returns the wait before the given attempt, before jitter and capping.
+func baseDelay(interval time.Duration, backoff float64, attempt int) float64 {
+	return float64(interval) * math.Pow(backoff, float64(attempt))
+}
+
+func capDelay(delay float64, limit time.Duration) time.Duration {
+	if delay > float64(limit) {
+		return limit
+	}
+	return time.Duration(delay)
+}
+
+// Schedule returns the first n waits Run would use between attempts, without jitter.
+func Schedule(interval time.Duration, backoff float64, n int) []time.Duration {
+	delays := make([]time.Duration, n)
+	for i := range delays {
+		delays[i] = capDelay(baseDelay(interval, backoff, i+1), maxDelay)
+	}
+	return delays
+}
+
+func (p *Poller) transform(output []byte) ([]byte, error) {
+	if p.newlines {
+		output, _ = transform.NormalizeNewlines(output)
+	}
+	for _, fn := range p.transforms {
+		var err error
+		output, err = fn(output)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return output, nil
+}
+
+// progress extracts the percentage reported in the output, clamped to 0-100.
+func (p *Poller) progress(output []byte) (float64, bool) {
+	if p.progressRe == nil {
+		return 0, false
+	}
+	m := p.progressRe.FindSubmatch(output)
+	if len(m) < 2 {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(string(m[1]), 64)
+	if err != nil {
+		return 0, false
+	}
+	return math.Max(0, math.Min(100, value)), true
+}
+
+// matchWithTimeout matches in the background and gives up after the match timeout.
+// It works on a copy of the match state, so an abandoned match cannot race with
+// the next one.
+func (p *Poller) matchWithTimeout(attempt int, output []byte) (bool, error) {
+	type result struct {
+		matched bool
+		err     error
+	}
+	done := make(chan result, 1)
+	state := p.state.clone()
+	go func() {
+		matched, err := p.match(output, &state)
+		done <- result{matched, err}
+	}()
+
+	select {
+	case r := <-done:
+		p.state = state
+		return r.matched, r.err
+	case <-time.After(p.matchLimit):
+		fmt.Fprintf(p.out, "Attempt %d: Warning: matching took longer than %s, treating it as a non-match.\n", attempt+1, p.matchLimit)
+		return false, nil
+	}
+}
+
+// matchState is what matching remembers across attempts.
+type matchState struct {
+	// seen holds the indexes of the patterns seen so far, with WithMatchAll.
+	seen map[int]bool
+	// lines holds the distinct matching lines, with WithMinDistinctLines.
+	lines map[string]bool
+	// With WithMinCount, count is the number of occurrences so far, consumed the
+	// number of bytes matched so far, and offset the position of the last counted
+	// occurrence in them.
+	count    int
+	consumed int64
+	offset   int64
+}
+
+func newMatchState() matchState {
+	return matchState{seen: make(map[int]bool), lines: make(map[string]bool), offset: -1}
+}
+
+func (s matchState) clone() matchState {
+	c := s
+	c.seen, c.lines = maps.Clone(s.seen), maps.Clone(s.lines)
+	return c
+}
+
+// match reports whether output matches, updating state.
+func (p *Poller) match(output []byte, state *matchState) (bool, error) {
+	if p.require != nil {
+		if ok, err := p.require.Match(output); !ok || err != nil {
+			return false, err
+		}
+	}
+	if p.matcher != nil {
+		return p.matcher.Match(output)
+	}
+	if p.minDistinct > 0 {
+		return p.matchDistinctLines(output, state)
+	}
+	if p.minCount > 0 {
+		return p.matchCount(output, state)
+	}
+
+	seen := state.seen
+	for i, pattern := range p.patterns {
+		if seen[i] {
+			continue
+		}
+		matched, err := p.matchPattern(pattern, output)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			if !p.matchAll {
+				return true, nil
+			}
+			seen[i] = true
+		}
+	}
+
+	return p.matchAll && len(seen) == len(p.patterns), nil
+}
+
+// matchDistinctLines records the lines matching any pattern, and reports whether
+// enough distinct ones have been seen.
+func (p *Poller) matchDistinctLines(output []byte, state *matchState) (bool, error) {
+	for _, line := range bytes.Split(output, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || state.lines[string(line)] {
+			continue
+		}
+		for _, pattern := range p.patterns {
+			matched, err := p.matchPattern(pattern, line)
+			if err != nil {
+				return false, err
+			}
+			if matched {
+				state.lines[string(line)] = true
+				break
+			}
+		}
+	}
+	return len(state.lines) >= p.minDistinct, nil
+}
+
+// compileCount compiles the pattern counted by WithMinCount.
+func (p *Poller) compileCount() (*regexp.Regexp, error) {
+	if len(p.patterns) == 0 {
+		return nil, errors.New("a minimum count needs a pattern")
+	}
+	expr := p.patterns[0]
 	if p.regex {
-		pattern := p.pattern
+		expr = p.regexPrefix() + expr
+	} else {
+		expr = regexp.QuoteMeta(expr)
 		if p.ignoreCase {
-			pattern = "(?i)" + pattern
+			expr = "(?i)" + expr
+		}
+	}
+	return regexp.Compile(expr)
+}
+
+// matchCount counts the occurrences of the pattern, and reports whether there
+// have been enough of them. It records the position of the one reaching the count.
+func (p *Poller) matchCount(output []byte, state *matchState) (bool, error) {
+	if p.countErr != nil {
+		return false, p.countErr
+	}
+	for _, loc := range p.countRe.FindAllIndex(output, p.minCount-state.count) {
+		state.count++
+		state.offset = state.consumed + int64(loc[0])
+	}
+	state.consumed += int64(len(output))
+	return state.count >= p.minCount, nil
+}
+
+// regexPrefix returns the flag group that regex patterns are compiled with.
+func (p *Poller) regexPrefix() string {
+	flags := p.regexFlags
+	if p.ignoreCase {
+		flags = "i" + flags
+	}
+	if flags == "" {
+		return ""
+	}
+	return "(?" + flags + ")"
+}
+
+// trivialProbes are outputs that hardly any intended pattern matches all of.
+var trivialProbes = []string{"x", "Z", "0", "-", " "}
+
+// TrivialPatterns returns the patterns that match any output: those matching
+// empty output, and those matching every one-character probe, such as "." as
+// a regex. Invalid regexes are left to the run to report.
+func (p *Poller) TrivialPatterns() []string {
+	var trivial []string
+	for _, pattern := range p.patterns {
+		match := func(output string) bool {
+			var matched bool
+			if p.matcher != nil {
+				matched, _ = p.matcher.Match([]byte(output))
+			} else {
+				matched, _ = p.matchPattern(pattern, []byte(output))
+			}
+			return matched
+		}
+		matchesAll := match("")
+		if !matchesAll {
+			matchesAll = true
+			for _, probe := range trivialProbes {
+				matchesAll = matchesAll && match(probe)
+			}
 		}
-		return regexp.Match(pattern, output)
+		if matchesAll {
+			trivial = append(trivial, pattern)
+		}
+	}
+	return trivial
+}
+
+func (p *Poller) matchPattern(pattern string, output []byte) (bool, error) {
+	if p.regex {
+		return regexp.Match(p.regexPrefix()+pattern, output)
 	}
 
 	if p.ignoreCase {
-		return bytes.Contains(bytes.ToLower(output), bytes.ToLower([]byte(p.pattern))), nil
+		return bytes.Contains(bytes.ToLower(output), bytes.ToLower([]byte(pattern))), nil
 	}
 
-	return bytes.Contains(output, []byte(p.pattern)), nil
+	return bytes.Contains(output, []byte(pattern)), nil
 }
@@ -1,12 +1,29 @@
 package poller_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"math/rand"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/gregory-chatelier/watchfor/pkg/matcher"
 	"github.com/gregory-chatelier/watchfor/pkg/poller"
+	"github.com/gregory-chatelier/watchfor/pkg/transform"
+	"github.com/gregory-chatelier/watchfor/pkg/watcher"
 )
 
 // MockWatcher is a mock implementation of the watcher.Watcher interface for testing.
@@ -171,3 +188,1607 @@ func TestPoller_Run_Jitter(t *testing.T) {
 		t.Errorf("Expected duration to be between %s and %s, got %s", expectedMinDuration, expectedMaxDuration, duration)
 	}
 }
+
+func TestPoller_Run_Trigger(t *testing.T) {
+	mockWatcher := &MockWatcher{
+		Output: []byte("some log output"),
+	}
+	trigger := make(chan struct{}, 1)
+	p := poller.New(mockWatcher, "SUCCESS", false, false, false, poller.WithTrigger(trigger))
+
+	// With a one hour interval, only the trigger can cause a second attempt in time.
+	trigger <- struct{}{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	p.Run(ctx, 1*time.Hour, 2, 1, 0)
+
+	if mockWatcher.Attempts != 2 {
+		t.Errorf("Expected the trigger to cause 2 attempts, got %d", mockWatcher.Attempts)
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	delays := poller.Schedule(10*time.Millisecond, 2, 3)
+	expected := []time.Duration{20 * time.Millisecond, 40 * time.Millisecond, 80 * time.Millisecond}
+
+	for i := range expected {
+		if delays[i] != expected[i] {
+			t.Errorf("Wait %d: expected %s, got %s", i+1, expected[i], delays[i])
+		}
+	}
+
+	capped := poller.Schedule(time.Hour, 2, 1)
+	if capped[0] != time.Hour {
+		t.Errorf("Expected waits to be capped at 1h, got %s", capped[0])
+	}
+}
+
+// SequenceWatcher returns a different output for each attempt, repeating the last one.
+type SequenceWatcher struct {
+	Outputs  []string
+	Attempts int
+}
+
+func (s *SequenceWatcher) Check() ([]byte, error) {
+	i := s.Attempts
+	if i >= len(s.Outputs) {
+		i = len(s.Outputs) - 1
+	}
+	s.Attempts++
+	return []byte(s.Outputs[i]), nil
+}
+
+func TestPoller_Run_MultiplePatterns(t *testing.T) {
+	testCases := []struct {
+		name             string
+		matchAll         bool
+		expected         bool
+		expectedAttempts int
+	}{
+		{"Any Pattern", false, true, 1},
+		{"All Patterns Across Attempts", true, true, 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			seqWatcher := &SequenceWatcher{Outputs: []string{"db ready", "nothing", "cache ready", "nothing"}}
+			opts := []poller.Option{poller.WithPatterns("db ready", "cache ready")}
+			if tc.matchAll {
+				opts = append(opts, poller.WithMatchAll())
+			}
+			p := poller.New(seqWatcher, "", false, false, false, opts...)
+
+			success := p.Run(context.Background(), 1*time.Millisecond, 5, 1, 0)
+
+			if success != tc.expected {
+				t.Errorf("Expected success=%v, got %v", tc.expected, success)
+			}
+			if seqWatcher.Attempts != tc.expectedAttempts {
+				t.Errorf("Expected %d attempts, got %d", tc.expectedAttempts, seqWatcher.Attempts)
+			}
+		})
+	}
+}
+
+func TestPoller_Run_MatchAllMissing(t *testing.T) {
+	seqWatcher := &SequenceWatcher{Outputs: []string{"db ready"}}
+	p := poller.New(seqWatcher, "db ready", false, false, false, poller.WithPatterns("cache ready"), poller.WithMatchAll())
+
+	if p.Run(context.Background(), 1*time.Millisecond, 3, 1, 0) {
+		t.Errorf("Expected Run to fail when one of the patterns is never seen")
+	}
+}
+
+func TestPoller_Run_AdaptiveInterval(t *testing.T) {
+	progressRe := regexp.MustCompile(`(\d+)% ready`)
+
+	testCases := []struct {
+		name             string
+		output           string
+		expectedAttempts int
+	}{
+		// At 100% the wait shrinks to the minimum, so all attempts fit in the timeout.
+		{"Complete Progress Uses Min Interval", "100% ready", 3},
+		// Without a progress value, the one hour interval applies.
+		{"Missing Progress Falls Back", "starting", 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockWatcher := &MockWatcher{Output: []byte(tc.output)}
+			p := poller.New(mockWatcher, "SUCCESS", false, false, false, poller.WithAdaptiveInterval(progressRe, time.Millisecond))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			p.Run(ctx, 1*time.Hour, 3, 1, 0)
+
+			if mockWatcher.Attempts != tc.expectedAttempts {
+				t.Errorf("Expected %d attempts, got %d", tc.expectedAttempts, mockWatcher.Attempts)
+			}
+		})
+	}
+}
+
+func TestPoller_Run_Transforms(t *testing.T) {
+	upper := func(output []byte) ([]byte, error) {
+		return bytes.ToUpper(output), nil
+	}
+	failing := func(output []byte) ([]byte, error) {
+		return nil, errors.New("simulated transform error")
+	}
+
+	testCases := []struct {
+		name       string
+		transforms []transform.Func
+		expected   bool
+	}{
+		{"Match After Transform", []transform.Func{upper}, true},
+		{"Failing Transform Is A Non-Match", []transform.Func{upper, failing}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockWatcher := &MockWatcher{Output: []byte("status: success")}
+			p := poller.New(mockWatcher, "SUCCESS", false, false, false, poller.WithTransforms(tc.transforms...))
+
+			success := p.Run(context.Background(), 1*time.Millisecond, 2, 1, 0)
+
+			if success != tc.expected {
+				t.Errorf("Expected success=%v, got %v", tc.expected, success)
+			}
+		})
+	}
+}
+
+func TestPoller_RunChan(t *testing.T) {
+	seqWatcher := &SequenceWatcher{Outputs: []string{"starting", "starting", "SUCCESS"}}
+	p := poller.New(seqWatcher, "SUCCESS", false, false, false, poller.WithOutput(io.Discard))
+
+	var attempts []poller.Attempt
+	for a := range p.RunChan(context.Background(), 1*time.Millisecond, 5, 1, 0) {
+		attempts = append(attempts, a)
+	}
+
+	if len(attempts) != 4 {
+		t.Fatalf("Expected 3 attempts and a final element, got %d elements", len(attempts))
+	}
+	for i, a := range attempts[:3] {
+		if a.Number != i+1 || a.Done {
+			t.Errorf("Unexpected update %d: %+v", i, a)
+		}
+	}
+	if !attempts[2].Matched || string(attempts[2].Output) != "SUCCESS" {
+		t.Errorf("Expected the third attempt to match, got %+v", attempts[2])
+	}
+	if final := attempts[3]; !final.Done || !final.Success {
+		t.Errorf("Expected a successful final element, got %+v", final)
+	}
+}
+
+func TestPoller_RunChan_Cancel(t *testing.T) {
+	mockWatcher := &MockWatcher{Output: []byte("some log output")}
+	p := poller.New(mockWatcher, "SUCCESS", false, false, false, poller.WithOutput(io.Discard))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := p.RunChan(ctx, 1*time.Millisecond, 0, 1, 0)
+
+	// Stop consuming without reading, then cancel: the goroutine must still finish.
+	time.Sleep(5 * time.Millisecond)
+	cancel()
+
+	timeout := time.After(time.Second)
+	var final poller.Attempt
+	for {
+		select {
+		case a, ok := <-ch:
+			if !ok {
+				if !final.Done || final.Success {
+					t.Errorf("Expected a failed final element before close, got %+v", final)
+				}
+				return
+			}
+			final = a
+		case <-timeout:
+			t.Fatal("Expected the channel to be closed after cancellation")
+		}
+	}
+}
+
+func TestPoller_Run_ErrorPolicy(t *testing.T) {
+	exitErr := exec.Command("sh", "-c", "exit 1").Run()
+
+	testCases := []struct {
+		name             string
+		err              error
+		abortOn          []string
+		expectedAttempts int
+	}{
+		{"DNS Not Found Aborts By Default", &net.DNSError{Err: "no such host", IsNotFound: true}, nil, 1},
+		{"Network Timeout Retries By Default", &net.DNSError{Err: "i/o timeout", IsTimeout: true}, nil, 3},
+		{"Exit Error Retries By Default", exitErr, nil, 3},
+		{"Exit Error Aborts When Configured", exitErr, []string{poller.ErrorTypeExit}, 1},
+		{"Process Exit Aborts By Default", fmt.Errorf("%w: pid 42", watcher.ErrProcessExited), nil, 1},
+		{"DNS Retries When Overridden", &net.DNSError{Err: "no such host", IsNotFound: true}, []string{}, 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockWatcher := &MockWatcher{Err: tc.err}
+			var opts []poller.Option
+			if tc.abortOn != nil {
+				opts = append(opts, poller.WithAbortOnErrors(tc.abortOn...))
+			}
+			p := poller.New(mockWatcher, "SUCCESS", false, false, false, opts...)
+
+			if p.Run(context.Background(), 1*time.Millisecond, 3, 1, 0) {
+				t.Fatal("Expected Run to fail")
+			}
+			if mockWatcher.Attempts != tc.expectedAttempts {
+				t.Errorf("Expected %d attempts, got %d", tc.expectedAttempts, mockWatcher.Attempts)
+			}
+		})
+	}
+}
+
+func TestPoller_Run_AbortOnExitCodes(t *testing.T) {
+	testCases := []struct {
+		name             string
+		command          string
+		codes            []int
+		expectedAttempts int
+	}{
+		{"Listed Code Aborts", "exit 127", []int{127, 2}, 1},
+		{"Other Code Retries", "exit 1", []int{127, 2}, 3},
+		{"No Codes Retries", "exit 127", nil, 3},
+		{"Killed Command Retries", "kill -9 $$", []int{127, 2}, 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cw := &countingWatcher{w: watcher.NewCommandWatcher(tc.command)}
+			var log bytes.Buffer
+			p := poller.New(cw, "SUCCESS", false, false, false,
+				poller.WithAbortOnExitCodes(tc.codes...), poller.WithOutput(&log))
+
+			if p.Run(context.Background(), 1*time.Millisecond, 3, 1, 0) {
+				t.Fatal("Expected Run to fail")
+			}
+			if cw.attempts != tc.expectedAttempts {
+				t.Errorf("Expected %d attempts, got %d", tc.expectedAttempts, cw.attempts)
+			}
+			aborted := p.StopReason() == poller.ReasonAborted
+			if aborted != (tc.expectedAttempts == 1) {
+				t.Errorf("Unexpected stop reason %q; log:\n%s", p.StopReason(), log.String())
+			}
+		})
+	}
+}
+
+// countingWatcher counts the checks of the watcher it wraps.
+type countingWatcher struct {
+	w        watcher.Watcher
+	attempts int
+}
+
+func (c *countingWatcher) Check() ([]byte, error) {
+	c.attempts++
+	return c.w.Check()
+}
+
+func TestPoller_LastMatch(t *testing.T) {
+	output := "build 41 queued\nbuild 42 deployed to eu-west-1\r\ndone\n"
+	testCases := []struct {
+		name       string
+		pattern    string
+		regex      bool
+		ignoreCase bool
+		expected   poller.Match
+	}{
+		{"Substring", "DEPLOYED", false, true, poller.Match{
+			Line: "build 42 deployed to eu-west-1", Text: "deployed", Group: map[string]string{},
+		}},
+		{"Named Groups", `build (?P<id>\d+) deployed to (?P<region>[\w-]+)( \(canary\))?`, true, false, poller.Match{
+			Line: "build 42 deployed to eu-west-1", Text: "build 42 deployed to eu-west-1",
+			Group: map[string]string{"id": "42", "1": "42", "region": "eu-west-1", "2": "eu-west-1", "3": ""},
+		}},
+		{"Last Line", `^done$`, true, false, poller.Match{Line: "done", Text: "done", Group: map[string]string{}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := poller.New(&MockWatcher{Output: []byte(output)}, tc.pattern, false, tc.regex, tc.ignoreCase,
+				poller.WithRegexFlags("m"), poller.WithOutput(io.Discard))
+			if !p.Run(context.Background(), 1*time.Millisecond, 1, 1, 0) {
+				t.Fatal("Expected Run to succeed")
+			}
+			m, ok := p.LastMatch()
+			tc.expected.Output = output
+			if !ok || m.Output != tc.expected.Output || m.Line != tc.expected.Line || m.Text != tc.expected.Text || !maps.Equal(m.Group, tc.expected.Group) {
+				t.Errorf("Expected %+v, got %+v, %v", tc.expected, m, ok)
+			}
+		})
+	}
+
+	p := poller.New(&MockWatcher{Output: []byte(output)}, "missing", false, false, false, poller.WithOutput(io.Discard))
+	p.Run(context.Background(), 1*time.Millisecond, 1, 1, 0)
+	if _, ok := p.LastMatch(); ok {
+		t.Error("Expected no match after a failed run")
+	}
+}
+
+// OrderWatcher records the order of its sources at each check.
+type OrderWatcher struct {
+	order  []string
+	Orders []string
+}
+
+func (o *OrderWatcher) Check() ([]byte, error) {
+	o.Orders = append(o.Orders, strings.Join(o.order, ""))
+	return nil, nil
+}
+
+func (o *OrderWatcher) Shuffle(shuffle func(n int, swap func(i, j int))) {
+	shuffle(len(o.order), func(i, j int) { o.order[i], o.order[j] = o.order[j], o.order[i] })
+}
+
+func TestPoller_Run_ShuffledSources(t *testing.T) {
+	run := func(seed int64, shuffle bool) []string {
+		ow := &OrderWatcher{order: strings.Split("abcdefgh", "")}
+		opts := []poller.Option{poller.WithRandSource(rand.NewSource(seed)), poller.WithOutput(io.Discard)}
+		if shuffle {
+			opts = append(opts, poller.WithShuffledSources())
+		}
+		poller.New(ow, "SUCCESS", false, false, false, opts...).Run(context.Background(), time.Millisecond, 5, 1, 0)
+		return ow.Orders
+	}
+
+	if orders := run(1, false); slices.ContainsFunc(orders, func(o string) bool { return o != "abcdefgh" }) {
+		t.Errorf("Expected the given order without shuffling, got %v", orders)
+	}
+	orders := run(1, true)
+	if len(slices.Compact(slices.Clone(orders))) < 2 {
+		t.Errorf("Expected the order to vary across attempts, got %v", orders)
+	}
+	if again := run(1, true); !slices.Equal(orders, again) {
+		t.Errorf("Expected the same seed to give the same orders, got %v and %v", orders, again)
+	}
+	if other := run(2, true); slices.Equal(orders, other) {
+		t.Errorf("Expected another seed to give other orders, got %v for both", orders)
+	}
+}
+
+func TestPoller_LastOutput(t *testing.T) {
+	seqWatcher := &SequenceWatcher{Outputs: []string{"first", "second", "last"}}
+	p := poller.New(seqWatcher, "SUCCESS", false, false, false,
+		poller.WithTransforms(func(output []byte) ([]byte, error) { return nil, nil }))
+
+	p.Run(context.Background(), 1*time.Millisecond, 3, 1, 0)
+
+	if string(p.LastOutput()) != "last" {
+		t.Errorf("Expected the untransformed last output 'last', got '%s'", string(p.LastOutput()))
+	}
+
+	// An empty output keeps the previous one.
+	seqWatcher = &SequenceWatcher{Outputs: []string{"first", "second", ""}}
+	p = poller.New(seqWatcher, "SUCCESS", false, false, false, poller.WithOutput(io.Discard))
+	p.Run(context.Background(), 1*time.Millisecond, 3, 1, 0)
+	if string(p.LastOutput()) != "second" {
+		t.Errorf("Expected the last non-empty output 'second', got '%s'", string(p.LastOutput()))
+	}
+
+	// The new content returned by an incremental watcher is accumulated.
+	tail := &TailWatcher{Chunks: []string{"line 1\n", "", "line 2\n", ""}}
+	p = poller.New(tail, "SUCCESS", false, false, false, poller.WithOutput(io.Discard))
+	p.Run(context.Background(), 1*time.Millisecond, 4, 1, 0)
+	if string(p.LastOutput()) != "line 1\nline 2\n" {
+		t.Errorf("Expected all the content read, got '%s'", string(p.LastOutput()))
+	}
+}
+
+// TailWatcher returns Chunks in turn as new content, like a growing file, with
+// watcher.ErrNoNewData for empty ones.
+type TailWatcher struct {
+	Chunks   []string
+	Attempts int
+}
+
+func (tw *TailWatcher) Incremental() bool {
+	return true
+}
+
+func (tw *TailWatcher) Check() ([]byte, error) {
+	i := min(tw.Attempts, len(tw.Chunks)-1)
+	tw.Attempts++
+	if tw.Chunks[i] == "" {
+		return nil, watcher.ErrNoNewData
+	}
+	return []byte(tw.Chunks[i]), nil
+}
+
+func TestPoller_Run_RandSource(t *testing.T) {
+	run := func(seed int64) string {
+		var log bytes.Buffer
+		mockWatcher := &MockWatcher{Output: []byte("some log output")}
+		p := poller.New(mockWatcher, "SUCCESS", true, false, false,
+			poller.WithOutput(&log), poller.WithRandSource(rand.NewSource(seed)))
+
+		p.Run(context.Background(), 1*time.Millisecond, 4, 1, 1)
+		return log.String()
+	}
+
+	// The verbose log includes each jittered delay.
+	first, second := run(42), run(42)
+	if !strings.Contains(first, "Waiting") {
+		t.Fatalf("Expected the log to report delays, got: %s", first)
+	}
+	if first != second {
+		t.Errorf("Expected identical delays with the same seed, got:\n%s\nand:\n%s", first, second)
+	}
+	if other := run(7); other == first {
+		t.Errorf("Expected different delays with a different seed")
+	}
+}
+
+func TestPoller_Run_Heartbeat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "heartbeat")
+	mockWatcher := &MockWatcher{Output: []byte("some log output")}
+	p := poller.New(mockWatcher, "SUCCESS", false, false, false, poller.WithHeartbeat(path))
+
+	p.Run(context.Background(), 1*time.Millisecond, 1, 1, 0)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected the heartbeat file to be created: %v", err)
+	}
+
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	p.Run(context.Background(), 1*time.Millisecond, 1, 1, 0)
+	if info, err = os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().After(old) {
+		t.Errorf("Expected the heartbeat mtime to be refreshed, got %v", info.ModTime())
+	}
+}
+
+func TestPoller_Run_HeartbeatError(t *testing.T) {
+	var log bytes.Buffer
+	path := filepath.Join(t.TempDir(), "missing", "heartbeat")
+	mockWatcher := &MockWatcher{Output: []byte("SUCCESS")}
+	p := poller.New(mockWatcher, "SUCCESS", false, false, false,
+		poller.WithHeartbeat(path), poller.WithOutput(&log))
+
+	if !p.Run(context.Background(), 1*time.Millisecond, 1, 1, 0) {
+		t.Errorf("Expected a heartbeat failure not to stop the run")
+	}
+	if !strings.Contains(log.String(), "Failed to update heartbeat file") {
+		t.Errorf("Expected the heartbeat failure to be logged, got: %s", log.String())
+	}
+}
+
+func TestPoller_Run_MatchHistory(t *testing.T) {
+	outputs := []string{"starting", "token=abc123", "running", "running", "done"}
+	pattern := `token=\w+\n(running\n)?done`
+
+	seqWatcher := &SequenceWatcher{Outputs: outputs}
+	p := poller.New(seqWatcher, pattern, false, true, false)
+	if p.Run(context.Background(), 1*time.Millisecond, len(outputs), 1, 0) {
+		t.Errorf("Expected the transient token to be missed without history")
+	}
+
+	seqWatcher = &SequenceWatcher{Outputs: outputs}
+	p = poller.New(seqWatcher, pattern, false, true, false, poller.WithMatchHistory(10))
+	if !p.Run(context.Background(), 1*time.Millisecond, len(outputs), 1, 0) {
+		t.Errorf("Expected the de-duplicated history to match across attempts")
+	}
+	if seqWatcher.Attempts != 5 {
+		t.Errorf("Expected 5 attempts, got %d", seqWatcher.Attempts)
+	}
+}
+
+func TestPoller_Run_MatchHistoryEviction(t *testing.T) {
+	seqWatcher := &SequenceWatcher{Outputs: []string{"a", "b", "c", "d"}}
+	p := poller.New(seqWatcher, `^b\nc\nd$`, false, true, false, poller.WithMatchHistory(3))
+	if !p.Run(context.Background(), 1*time.Millisecond, 4, 1, 0) {
+		t.Errorf("Expected the history to hold only the 3 most recent outputs")
+	}
+}
+
+func TestPoller_Run_NormalizedNewlines(t *testing.T) {
+	mockWatcher := &MockWatcher{Output: []byte("starting\r\nREADY\r\n")}
+	p := poller.New(mockWatcher, `(?m)^READY$`, false, true, false)
+	if p.Run(context.Background(), 1*time.Millisecond, 1, 1, 0) {
+		t.Fatalf("Expected the CRLF output not to match an anchored line")
+	}
+
+	var log bytes.Buffer
+	p = poller.New(mockWatcher, `(?m)^READY$`, true, true, false,
+		poller.WithNormalizedNewlines(), poller.WithOutput(&log),
+		poller.WithTransforms(transform.Between("starting\n", "\n")))
+	if !p.Run(context.Background(), 1*time.Millisecond, 1, 1, 0) {
+		t.Errorf("Expected the normalized output to match")
+	}
+	if !strings.Contains(log.String(), "READY\r\n") {
+		t.Errorf("Expected the verbose log to show the raw output, got: %s", log.String())
+	}
+}
+
+func TestPoller_Status(t *testing.T) {
+	mockWatcher := &MockWatcher{Output: []byte("some log output")}
+	p := poller.New(mockWatcher, "SUCCESS", false, false, false)
+	if s := p.Status(); s.Attempt != 0 || s.Percent != -1 {
+		t.Errorf("Expected an empty status before the run, got %+v", s)
+	}
+
+	p.Run(context.Background(), 1*time.Millisecond, 4, 1, 0)
+	s := p.Status()
+	if s.Attempt != 4 || s.MaxRetries != 4 || s.Percent != 100 {
+		t.Errorf("Expected 4 of 4 attempts at 100%%, got %+v", s)
+	}
+
+	env := strings.Join(s.Env(), " ")
+	for _, want := range []string{"WATCHFOR_ATTEMPT=4", "WATCHFOR_MAX_RETRIES=4", "WATCHFOR_ELAPSED_MS=", "WATCHFOR_REASON=max-retries", "WATCHFOR_PROGRESS_PCT=100"} {
+		if !strings.Contains(env, want) {
+			t.Errorf("Expected the environment to contain %s, got %s", want, env)
+		}
+	}
+}
+
+func TestPoller_Status_Timeout(t *testing.T) {
+	mockWatcher := &MockWatcher{Output: []byte("some log output")}
+	p := poller.New(mockWatcher, "SUCCESS", false, false, false)
+
+	// No max retries: the percentage follows the timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	p.Run(ctx, 10*time.Millisecond, 0, 1, 0)
+
+	s := p.Status()
+	if s.Reason != poller.ReasonTimeout {
+		t.Errorf("Expected the run to stop on timeout, got %q", s.Reason)
+	}
+	if s.Percent < 99 {
+		t.Errorf("Expected the timeout to be used up, got %+v", s)
+	}
+
+	p = poller.New(mockWatcher, "some log", false, false, false)
+	p.Run(context.Background(), 1*time.Millisecond, 0, 1, 0)
+	if s := p.Status(); s.Percent != -1 || strings.Contains(strings.Join(s.Env(), " "), "PCT") {
+		t.Errorf("Expected no percentage without a limit, got %+v", s)
+	}
+}
+
+func TestParseExitCodes(t *testing.T) {
+	codes, err := poller.ParseExitCodes(map[string]int{"timeout": 75, "max-retries": 76, "aborted": 0})
+	if err != nil {
+		t.Fatalf("ParseExitCodes failed: %v", err)
+	}
+	testCases := []struct {
+		reason   poller.Reason
+		expected int
+	}{
+		{poller.ReasonTimeout, 75},
+		{poller.ReasonMaxRetries, 76},
+		{poller.ReasonAborted, 0},
+		{poller.ReasonSourceSilent, 1}, // Not mapped: the default.
+	}
+	for _, tc := range testCases {
+		if code := codes.Code(tc.reason, 1); code != tc.expected {
+			t.Errorf("Expected %d for %s, got %d", tc.expected, tc.reason, code)
+		}
+	}
+
+	// The example of --exit-map's request, with "abort" for "aborted".
+	codes, err = poller.ParseExitCodes(map[string]int{"timeout": 75, "abort": 77})
+	if err != nil || codes.Code(poller.ReasonAborted, 1) != 77 || codes.Code(poller.ReasonTimeout, 1) != 75 {
+		t.Errorf("Expected abort=77 to map the aborted reason, got %v, %v", codes, err)
+	}
+
+	invalid := []map[string]int{
+		{"aborts": 77},
+		{"abort": 77, "aborted": 78},
+		{"timeout": 256},
+		{"matched": -1},
+	}
+	for _, pairs := range invalid {
+		if _, err := poller.ParseExitCodes(pairs); err == nil {
+			t.Errorf("Expected an error for %v", pairs)
+		}
+	}
+}
+
+func TestExitCodes_Run(t *testing.T) {
+	codes, _ := poller.ParseExitCodes(map[string]int{"max-retries": 76})
+	p := poller.New(&MockWatcher{Output: []byte("starting")}, "READY", false, false, false, poller.WithOutput(io.Discard))
+	p.Run(context.Background(), time.Millisecond, 2, 1, 0)
+	if code := codes.Code(p.StopReason(), 1); code != 76 {
+		t.Errorf("Expected the exit code of max-retries, got %d", code)
+	}
+}
+
+func TestPoller_Run_Precondition(t *testing.T) {
+	// Only complete objects are accepted, so the pattern in the partial one is ignored.
+	complete := matcherFunc(func(output []byte) (bool, error) {
+		return bytes.HasSuffix(bytes.TrimSpace(output), []byte("}")), nil
+	})
+	seqWatcher := &SequenceWatcher{Outputs: []string{`{"status":"ready"`, `{"status":"starting"}`, `{"status":"ready"}`}}
+	p := poller.New(seqWatcher, "ready", false, false, false,
+		poller.WithOutput(io.Discard), poller.WithPrecondition(complete))
+	if !p.Run(context.Background(), 1*time.Millisecond, 3, 1, 0) {
+		t.Fatal("Expected the pattern to be found")
+	}
+	if seqWatcher.Attempts != 3 {
+		t.Errorf("Expected a match on attempt 3, got %d attempts", seqWatcher.Attempts)
+	}
+}
+
+// matcherFunc adapts a function to the matcher.Matcher interface.
+type matcherFunc func(output []byte) (bool, error)
+
+func (f matcherFunc) Match(output []byte) (bool, error) {
+	return f(output)
+}
+
+// NumberedWatcher returns a distinct, fixed-size output on every check.
+type NumberedWatcher struct {
+	Attempts int
+}
+
+func (n *NumberedWatcher) Check() ([]byte, error) {
+	n.Attempts++
+	return []byte(fmt.Sprintf("%s line %06d", strings.Repeat(".", 1000), n.Attempts)), nil
+}
+
+func TestPoller_Run_MaxHistoryBytes(t *testing.T) {
+	numWatcher := &NumberedWatcher{}
+	var history []byte
+	p := poller.New(numWatcher, "", false, false, false,
+		poller.WithMatchHistory(1000), poller.WithMaxHistoryBytes(4096),
+		poller.WithMatcher(matcherFunc(func(output []byte) (bool, error) {
+			history = output
+			// Succeed once the most recent output is seen alongside an older one.
+			return numWatcher.Attempts == 500 && bytes.Contains(output, []byte("line 000499\n")), nil
+		})))
+
+	if !p.Run(context.Background(), 0, 500, 1, 0) {
+		t.Errorf("Expected the recent content to be retained and matched")
+	}
+	if len(history) > 4096 {
+		t.Errorf("Expected the history to be capped at 4096 bytes, got %d", len(history))
+	}
+	if bytes.Contains(history, []byte("line 000001")) {
+		t.Errorf("Expected the oldest outputs to be evicted")
+	}
+}
+
+func TestPoller_Run_MaxHistoryBytesLongOutput(t *testing.T) {
+	mockWatcher := &MockWatcher{Output: []byte("HEAD" + strings.Repeat(".", 100) + "TAIL")}
+	p := poller.New(mockWatcher, "HEAD", false, false, false,
+		poller.WithMatchHistory(10), poller.WithMaxHistoryBytes(50))
+	if p.Run(context.Background(), 1*time.Millisecond, 1, 1, 0) {
+		t.Errorf("Expected an output longer than the cap to keep only its end")
+	}
+
+	p = poller.New(mockWatcher, "TAIL", false, false, false,
+		poller.WithMatchHistory(10), poller.WithMaxHistoryBytes(50))
+	if !p.Run(context.Background(), 1*time.Millisecond, 1, 1, 0) {
+		t.Errorf("Expected the end of a long output to match")
+	}
+}
+
+func TestPoller_Run_MaxHistoryBytesKeepsRunes(t *testing.T) {
+	// Cutting 60 bytes of "é" down to 25 would start in the middle of one.
+	mockWatcher := &MockWatcher{Output: []byte(strings.Repeat("é", 30))}
+	p := poller.New(mockWatcher, "^é{12}$", false, true, false, poller.WithOutput(io.Discard),
+		poller.WithMatchHistory(10), poller.WithMaxHistoryBytes(25))
+	if !p.Run(context.Background(), 1*time.Millisecond, 1, 1, 0) {
+		t.Errorf("Expected the history to start at a complete character")
+	}
+}
+
+func TestPoller_Run_Probe(t *testing.T) {
+	// The probe allows the checks of attempts 2 and 4 only.
+	probes := 0
+	probe := func() error {
+		probes++
+		if probes%2 == 1 {
+			return errors.New("not ready")
+		}
+		return nil
+	}
+
+	seqWatcher := &SequenceWatcher{Outputs: []string{"waiting", "SUCCESS"}}
+	p := poller.New(seqWatcher, "SUCCESS", false, false, false, poller.WithProbe(probe))
+
+	if !p.Run(context.Background(), 1*time.Millisecond, 10, 1, 0) {
+		t.Fatalf("Expected Run to succeed once the probe allows a matching check")
+	}
+	if probes != 4 {
+		t.Errorf("Expected 4 probes, got %d", probes)
+	}
+	if seqWatcher.Attempts != 2 {
+		t.Errorf("Expected only the 2 allowed checks to run, got %d", seqWatcher.Attempts)
+	}
+}
+
+func TestPoller_Run_ProbeNeverPasses(t *testing.T) {
+	mockWatcher := &MockWatcher{Output: []byte("SUCCESS")}
+	p := poller.New(mockWatcher, "SUCCESS", false, false, false,
+		poller.WithProbe(func() error { return errors.New("not ready") }))
+
+	if p.Run(context.Background(), 1*time.Millisecond, 3, 1, 0) {
+		t.Errorf("Expected skipped checks to count as non-matches")
+	}
+	if mockWatcher.Attempts != 0 {
+		t.Errorf("Expected no checks to run, got %d", mockWatcher.Attempts)
+	}
+}
+
+// TruncatingWatcher reports a truncation along with its output on every check.
+type TruncatingWatcher struct {
+	Attempts int
+}
+
+func (tw *TruncatingWatcher) Check() ([]byte, error) {
+	tw.Attempts++
+	return []byte("rotated"), watcher.ErrTruncated
+}
+
+func TestPoller_Run_TruncationIsNotAnError(t *testing.T) {
+	tw := &TruncatingWatcher{}
+	var attempts []poller.Attempt
+	p := poller.New(tw, "SUCCESS", false, false, false, poller.WithAbortOnErrors(poller.ErrorTypes...))
+	for a := range p.RunChan(context.Background(), 1*time.Millisecond, 3, 1, 0) {
+		attempts = append(attempts, a)
+	}
+
+	if tw.Attempts != 3 {
+		t.Errorf("Expected a truncation not to abort the run, got %d attempts", tw.Attempts)
+	}
+	if attempts[0].Err != nil {
+		t.Errorf("Expected no error to be reported for a truncation, got %v", attempts[0].Err)
+	}
+}
+
+func TestPoller_Run_MatchTimeout(t *testing.T) {
+	huge := bytes.Repeat([]byte("a"), 20<<20)
+	mockWatcher := &MockWatcher{Output: huge}
+
+	var log bytes.Buffer
+	p := poller.New(mockWatcher, `a+b`, false, true, false,
+		poller.WithMatchTimeout(time.Microsecond), poller.WithOutput(&log))
+
+	start := time.Now()
+	if p.Run(context.Background(), 1*time.Millisecond, 2, 1, 0) {
+		t.Errorf("Expected a timed-out match to count as a non-match")
+	}
+	if !strings.Contains(log.String(), "matching took longer than 1µs") {
+		t.Errorf("Expected a warning about the match timeout, got: %s", log.String())
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected Run not to wait for the slow matches, took %s", elapsed)
+	}
+}
+
+func TestPoller_Run_MatchTimeoutAllowsFastMatches(t *testing.T) {
+	seqWatcher := &SequenceWatcher{Outputs: []string{"db ready", "cache ready"}}
+	p := poller.New(seqWatcher, "db ready", false, false, false,
+		poller.WithPatterns("cache ready"), poller.WithMatchAll(), poller.WithMatchTimeout(time.Second))
+
+	if !p.Run(context.Background(), 1*time.Millisecond, 3, 1, 0) {
+		t.Errorf("Expected the patterns seen across attempts to be remembered")
+	}
+}
+
+func TestPoller_Run_Settle(t *testing.T) {
+	var log bytes.Buffer
+	mockWatcher := &MockWatcher{Output: []byte("SUCCESS")}
+	p := poller.New(mockWatcher, "SUCCESS", false, false, false,
+		poller.WithSettle(50*time.Millisecond), poller.WithOutput(&log))
+
+	start := time.Now()
+	if !p.Run(context.Background(), 1*time.Millisecond, 1, 1, 0) {
+		t.Fatalf("Expected Run to succeed after settling")
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected Run to wait at least 50ms after the match, took %s", elapsed)
+	}
+	if !strings.Contains(log.String(), "Settling for 50ms") {
+		t.Errorf("Expected the settle wait to be logged, got: %s", log.String())
+	}
+}
+
+func TestPoller_Run_SettleTimeout(t *testing.T) {
+	mockWatcher := &MockWatcher{Output: []byte("SUCCESS")}
+	p := poller.New(mockWatcher, "SUCCESS", false, false, false,
+		poller.WithSettle(time.Minute), poller.WithOutput(io.Discard))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if p.Run(ctx, 1*time.Millisecond, 1, 1, 0) {
+		t.Errorf("Expected Run to fail when the context ends while settling")
+	}
+	if p.StopReason() != poller.ReasonTimeoutAfterMatch {
+		t.Errorf("Expected the timeout to be told apart from a missing match, got %q", p.StopReason())
+	}
+}
+
+// FailingSequenceWatcher returns Outputs in turn, failing the checks with a
+// non-empty entry in Errs.
+type FailingSequenceWatcher struct {
+	Outputs  []string
+	Errs     []string
+	Attempts int
+}
+
+func (s *FailingSequenceWatcher) Check() ([]byte, error) {
+	i := min(s.Attempts, len(s.Outputs)-1)
+	s.Attempts++
+	if i < len(s.Errs) && s.Errs[i] != "" {
+		return []byte(s.Outputs[i]), errors.New(s.Errs[i])
+	}
+	return []byte(s.Outputs[i]), nil
+}
+
+func TestPoller_Run_StableOutput(t *testing.T) {
+	flapping := []string{"replicas: 1", "replicas: 2", "replicas: 2", "replicas: 1", "replicas: 3", "replicas: 3", "replicas: 3"}
+	testCases := []struct {
+		name             string
+		pattern          string
+		stable           int
+		errs             []string
+		maxRetries       int
+		expected         bool
+		expectedAttempts int
+	}{
+		{"Stabilizes", "", 3, nil, 10, true, 7},
+		{"Stable Output Must Match", "replicas: 3", 2, nil, 10, true, 6},
+		{"Too Few Retries", "", 3, nil, 6, false, 6},
+		{"Failed Check Breaks The Run", "", 3, []string{"", "", "", "", "", "exit status 1"}, 10, true, 9},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := &FailingSequenceWatcher{Outputs: flapping, Errs: tc.errs}
+			p := poller.New(w, tc.pattern, false, false, false,
+				poller.WithStableOutput(tc.stable), poller.WithOutput(io.Discard))
+			if got := p.Run(context.Background(), 1*time.Millisecond, tc.maxRetries, 1, 0); got != tc.expected {
+				t.Errorf("Expected Run to return %v, got %v", tc.expected, got)
+			}
+			if w.Attempts != tc.expectedAttempts {
+				t.Errorf("Expected %d attempts, got %d", tc.expectedAttempts, w.Attempts)
+			}
+		})
+	}
+}
+
+func TestPoller_Run_MinElapsed(t *testing.T) {
+	var log bytes.Buffer
+	mockWatcher := &MockWatcher{Output: []byte("SUCCESS")}
+	p := poller.New(mockWatcher, "SUCCESS", false, false, false,
+		poller.WithMinElapsed(80*time.Millisecond), poller.WithSettle(30*time.Millisecond), poller.WithOutput(&log))
+
+	start := time.Now()
+	if !p.Run(context.Background(), 1*time.Millisecond, 1, 1, 0) {
+		t.Fatalf("Expected Run to succeed after the minimum wait")
+	}
+	// The settle time counts towards the minimum, rather than adding to it.
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Errorf("Expected Run to take about 80ms, took %s", elapsed)
+	}
+	if mockWatcher.Attempts != 1 {
+		t.Errorf("Expected the immediate match to need 1 check, got %d", mockWatcher.Attempts)
+	}
+	if !strings.Contains(log.String(), "to take at least 80ms in total") {
+		t.Errorf("Expected the enforced wait to be logged, got: %s", log.String())
+	}
+
+	// A match that comes later than the minimum is not delayed.
+	log.Reset()
+	seqWatcher := &SequenceWatcher{Outputs: []string{"waiting", "SUCCESS"}}
+	p = poller.New(seqWatcher, "SUCCESS", false, false, false,
+		poller.WithMinElapsed(time.Millisecond), poller.WithOutput(&log))
+	if !p.Run(context.Background(), 20*time.Millisecond, 2, 1, 0) || strings.Contains(log.String(), "more, to take") {
+		t.Errorf("Expected no extra wait, got: %s", log.String())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	p = poller.New(&MockWatcher{Output: []byte("SUCCESS")}, "SUCCESS", false, false, false,
+		poller.WithMinElapsed(time.Minute), poller.WithOutput(io.Discard))
+	if p.Run(ctx, 1*time.Millisecond, 1, 1, 0) || p.StopReason() != poller.ReasonTimeoutAfterMatch {
+		t.Errorf("Expected a timeout when the context ends during the minimum wait, got %q", p.StopReason())
+	}
+}
+
+func TestPoller_Run_MinDistinctLines(t *testing.T) {
+	testCases := []struct {
+		name     string
+		outputs  []string
+		expected bool
+	}{
+		{"Distinct Across Attempts", []string{"node-a ready\n", "node-b ready\nnode-a ready\n", "node-c ready\n"}, true},
+		{"Duplicates Not Counted", []string{"node-a ready\nnode-a ready\n", "node-b ready\n", "node-a ready\r\nnode-b ready\n"}, false},
+		{"Non-Matching Lines Ignored", []string{"node-a ready\nnode-b starting\nnode-c failed\n", "node-d ready\n"}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			seqWatcher := &SequenceWatcher{Outputs: tc.outputs}
+			p := poller.New(seqWatcher, `^node-\w+ ready$`, false, true, false, poller.WithMinDistinctLines(3))
+			if success := p.Run(context.Background(), 1*time.Millisecond, len(tc.outputs), 1, 0); success != tc.expected {
+				t.Errorf("Expected success=%v, got %v", tc.expected, success)
+			}
+		})
+	}
+}
+
+// BlockingWatcher is a ContextWatcher whose checks only end when their context is done.
+type BlockingWatcher struct{}
+
+func (BlockingWatcher) Check() ([]byte, error) {
+	select {}
+}
+
+func (BlockingWatcher) CheckContext(ctx context.Context) ([]byte, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestPoller_Run_CancelsCheckInProgress(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	p := poller.New(BlockingWatcher{}, "ready", false, false, false, poller.WithOutput(io.Discard))
+	done := make(chan bool, 1)
+	go func() { done <- p.Run(ctx, time.Millisecond, 0, 1, 0) }()
+
+	select {
+	case success := <-done:
+		if success {
+			t.Error("Expected Run to fail once the context is done")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the check in progress to be cancelled with the context")
+	}
+}
+
+func TestPoller_Run_PatternTimeout(t *testing.T) {
+	testCases := []struct {
+		name     string
+		outputs  []string
+		expected bool
+		reason   poller.Reason
+	}{
+		// The window only starts with the first output, so a slow start is fine.
+		{"Match Within Window", []string{"", "", "", "", "", "", "starting", "READY"}, true, poller.ReasonMatched},
+		{"Stuck After First Output", []string{"", "starting"}, false, poller.ReasonPatternWindowExpired},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			seqWatcher := &SequenceWatcher{Outputs: tc.outputs}
+			p := poller.New(seqWatcher, "READY", false, false, false,
+				poller.WithOutput(io.Discard), poller.WithPatternTimeout(30*time.Millisecond))
+
+			start := time.Now()
+			if success := p.Run(context.Background(), 10*time.Millisecond, 0, 1, 0); success != tc.expected {
+				t.Errorf("Expected success=%v, got %v", tc.expected, success)
+			}
+			if reason := p.StopReason(); reason != tc.reason {
+				t.Errorf("Expected reason %q, got %q", tc.reason, reason)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Expected the window to end the run promptly, took %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestPoller_Run_SkipUnchanged(t *testing.T) {
+	seqWatcher := &SequenceWatcher{Outputs: []string{"starting", "starting", "starting", "loading", "loading", "READY"}}
+	calls := 0
+	m := matcherFunc(func(output []byte) (bool, error) {
+		calls++
+		return bytes.Contains(output, []byte("READY")), nil
+	})
+	p := poller.New(seqWatcher, "", false, false, false, poller.WithMatcher(m), poller.WithSkipUnchanged())
+
+	if success := p.Run(context.Background(), 1*time.Millisecond, 10, 1, 0); !success {
+		t.Fatal("Expected the pattern to be found")
+	}
+	if seqWatcher.Attempts != 6 {
+		t.Errorf("Expected 6 checks, got %d", seqWatcher.Attempts)
+	}
+	if calls != 3 {
+		t.Errorf("Expected only the 3 distinct outputs to be matched, got %d", calls)
+	}
+}
+
+func BenchmarkPoller_Run_SkipUnchanged(b *testing.B) {
+	output := bytes.Repeat([]byte("2024-05-01T10:00:00Z INFO worker-42 processed batch 1234 in 56ms\n"), 2000)
+	for _, skip := range []bool{false, true} {
+		b.Run(fmt.Sprintf("skip=%v", skip), func(b *testing.B) {
+			opts := []poller.Option{poller.WithOutput(io.Discard)}
+			if skip {
+				opts = append(opts, poller.WithSkipUnchanged())
+			}
+			p := poller.New(&MockWatcher{Output: output}, `(\w+-\d+).*batch (\d+).*FAILED`, false, true, false, opts...)
+			b.ResetTimer()
+			p.Run(context.Background(), 0, b.N, 1, 0)
+		})
+	}
+}
+
+// DeadlineWatcher reports READY from the given time on.
+type DeadlineWatcher struct {
+	ReadyAt time.Time
+}
+
+func (w DeadlineWatcher) Check() ([]byte, error) {
+	if time.Now().Before(w.ReadyAt) {
+		return []byte("starting"), nil
+	}
+	return []byte("READY"), nil
+}
+
+func TestPoller_Run_FinalCheck(t *testing.T) {
+	for _, final := range []bool{false, true} {
+		t.Run(fmt.Sprintf("final=%v", final), func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+			defer cancel()
+			deadline, _ := ctx.Deadline()
+
+			opts := []poller.Option{poller.WithOutput(io.Discard)}
+			if final {
+				opts = append(opts, poller.WithFinalCheck())
+			}
+			// The pattern appears exactly at the deadline, in the middle of a wait.
+			p := poller.New(DeadlineWatcher{ReadyAt: deadline}, "READY", false, false, false, opts...)
+			if success := p.Run(ctx, 100*time.Millisecond, 0, 1, 0); success != final {
+				t.Errorf("Expected success=%v, got %v", final, success)
+			}
+		})
+	}
+}
+
+func TestPoller_Run_MaxEmpty(t *testing.T) {
+	testCases := []struct {
+		name     string
+		outputs  []string
+		attempts int
+		reason   poller.Reason
+	}{
+		{"Silent Source", []string{"line 1", "", "", "", ""}, 4, poller.ReasonSourceSilent},
+		{"Output Resets The Count", []string{"", "", "line 1", "", "", "line 2", "", ""}, 8, poller.ReasonMaxRetries},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			seqWatcher := &SequenceWatcher{Outputs: tc.outputs}
+			p := poller.New(seqWatcher, "READY", false, false, false, poller.WithOutput(io.Discard), poller.WithMaxEmpty(2))
+			if p.Run(context.Background(), 1*time.Millisecond, 8, 1, 0) {
+				t.Fatal("Expected Run to fail")
+			}
+			if seqWatcher.Attempts != tc.attempts {
+				t.Errorf("Expected %d attempts, got %d", tc.attempts, seqWatcher.Attempts)
+			}
+			if reason := p.StopReason(); reason != tc.reason {
+				t.Errorf("Expected reason %q, got %q", tc.reason, reason)
+			}
+		})
+	}
+}
+
+func TestPoller_Run_MaxEmpty_IgnoresErrors(t *testing.T) {
+	mockWatcher := &MockWatcher{Err: errors.New("connection refused")}
+	p := poller.New(mockWatcher, "READY", false, false, false, poller.WithOutput(io.Discard), poller.WithMaxEmpty(1))
+	p.Run(context.Background(), 1*time.Millisecond, 5, 1, 0)
+	if reason := p.StopReason(); reason != poller.ReasonMaxRetries {
+		t.Errorf("Expected failed checks not to count as empty, got reason %q", reason)
+	}
+}
+
+func TestPoller_Run_NoNewDataSkipsMatching(t *testing.T) {
+	mockWatcher := &MockWatcher{Err: watcher.ErrNoNewData}
+	calls := 0
+	m := matcherFunc(func(output []byte) (bool, error) {
+		calls++
+		return false, nil
+	})
+	var attempts []poller.Attempt
+	p := poller.New(mockWatcher, "", false, false, false, poller.WithMatcher(m), poller.WithAbortOnErrors(poller.ErrorTypes...))
+	for a := range p.RunChan(context.Background(), 1*time.Millisecond, 3, 1, 0) {
+		attempts = append(attempts, a)
+	}
+
+	if mockWatcher.Attempts != 3 {
+		t.Errorf("Expected no new data not to abort the run, got %d attempts", mockWatcher.Attempts)
+	}
+	if calls != 0 {
+		t.Errorf("Expected matching to be skipped, got %d calls", calls)
+	}
+	if attempts[0].Err != nil {
+		t.Errorf("Expected no error to be reported for no new data, got %v", attempts[0].Err)
+	}
+}
+
+func TestPoller_Run_MinCount(t *testing.T) {
+	testCases := []struct {
+		name       string
+		outputs    []string
+		regex      bool
+		ignoreCase bool
+		expected   bool
+		offset     int64
+	}{
+		{"Single Buffer", []string{"ERR a\nok\nERR b\nERR c\nERR d\n"}, false, false, true, 15},
+		{"Across Checks", []string{"ERR a\n", "ok\n", "ERR b\nERR c\n"}, false, false, true, 15},
+		{"Not Enough", []string{"ERR a\n", "ERR b\n", ""}, false, false, false, -1},
+		{"Ignore Case", []string{"err a\nErr b\n", "ERR c\n"}, false, true, true, 12},
+		{"Regex", []string{"code=500 code=200 code=503\n"}, true, false, false, -1},
+		{"Regex Across Checks", []string{"code=500 code=200\n", "code=503\ncode=502\n"}, true, false, true, 27},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pattern := "ERR"
+			if tc.regex {
+				pattern = `code=5\d\d`
+			}
+			seqWatcher := &SequenceWatcher{Outputs: tc.outputs}
+			p := poller.New(seqWatcher, pattern, false, tc.regex, tc.ignoreCase,
+				poller.WithOutput(io.Discard), poller.WithMinCount(3))
+			if success := p.Run(context.Background(), 1*time.Millisecond, len(tc.outputs), 1, 0); success != tc.expected {
+				t.Errorf("Expected success=%v, got %v", tc.expected, success)
+			}
+			if offset := p.MatchOffset(); offset != tc.offset {
+				t.Errorf("Expected the third occurrence at offset %d, got %d", tc.offset, offset)
+			}
+			env := strings.Join(p.Status().Env(), " ")
+			if hasOffset := strings.Contains(env, fmt.Sprintf("WATCHFOR_MATCH_OFFSET=%d", tc.offset)); hasOffset != tc.expected {
+				t.Errorf("Expected WATCHFOR_MATCH_OFFSET in the environment only on success, got %s", env)
+			}
+		})
+	}
+}
+
+func TestPoller_Run_MinCountWithoutPattern(t *testing.T) {
+	seqWatcher := &SequenceWatcher{Outputs: []string{"a\n", "a\n"}}
+	p := poller.New(seqWatcher, "", false, false, false,
+		poller.WithOutput(io.Discard), poller.WithMinCount(2))
+	if p.Run(context.Background(), 1*time.Millisecond, 2, 1, 0) {
+		t.Fatal("Expected a minimum count without a pattern to fail")
+	}
+	if reason := p.Status().Reason; reason != poller.ReasonMatchError {
+		t.Errorf("Expected reason %q, got %q", poller.ReasonMatchError, reason)
+	}
+}
+
+func TestPoller_Run_Passthrough(t *testing.T) {
+	testCases := []struct {
+		name     string
+		prefix   string
+		expected string
+	}{
+		{"Raw", "", "booting\nstep 1\nstep 2\nREADY\n"},
+		{"Prefixed", "[app] ", "[app] booting\n[app] step 1\n[app] step 2\n[app] READY\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			seqWatcher := &SequenceWatcher{Outputs: []string{"booting", "", "step 1\nstep 2\n", "READY"}}
+			var passthrough bytes.Buffer
+			p := poller.New(seqWatcher, "READY", false, false, false,
+				poller.WithOutput(io.Discard), poller.WithPassthrough(&passthrough, tc.prefix))
+			if !p.Run(context.Background(), 1*time.Millisecond, 5, 1, 0) {
+				t.Fatal("Expected the pattern to be found")
+			}
+			if passthrough.String() != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, passthrough.String())
+			}
+		})
+	}
+}
+
+func TestPoller_Run_RegexFlags(t *testing.T) {
+	const output = "Status:\nstarting\nready TO SERVE\n"
+	testCases := []struct {
+		name       string
+		pattern    string
+		flags      string
+		ignoreCase bool
+		expected   bool
+	}{
+		{"Dot Stops At Newline", `Status:.*ready`, "", false, false},
+		{"Dot All", `Status:.*ready`, "s", false, true},
+		{"Anchor At Text Start Only", `^ready`, "", false, false},
+		{"Multiline", `^ready`, "m", false, true},
+		{"Multiline End Anchor", `starting$`, "m", false, true},
+		{"Dot All With Ignore Case", `status:.*to serve`, "s", true, true},
+		{"Both Flags", `^starting.*SERVE$`, "sm", false, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockWatcher := &MockWatcher{Output: []byte(output)}
+			p := poller.New(mockWatcher, tc.pattern, false, true, tc.ignoreCase,
+				poller.WithOutput(io.Discard), poller.WithRegexFlags(tc.flags))
+			if found := p.Run(context.Background(), 1*time.Millisecond, 1, 1, 0); found != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, found)
+			}
+		})
+	}
+}
+
+// SlowWatcher is ready after a delay, unless its context is cancelled first.
+type SlowWatcher struct {
+	Delay time.Duration
+}
+
+func (w SlowWatcher) Check() ([]byte, error) {
+	return w.CheckContext(context.Background())
+}
+
+func (w SlowWatcher) CheckContext(ctx context.Context) ([]byte, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(w.Delay):
+		return []byte("READY"), nil
+	}
+}
+
+func TestPoller_Run_TimeoutGrace(t *testing.T) {
+	testCases := []struct {
+		name     string
+		grace    time.Duration
+		expected bool
+		reason   poller.Reason
+	}{
+		{"No Grace", 0, false, poller.ReasonTimeout},
+		{"Check Completes Within Grace", time.Second, true, poller.ReasonMatched},
+		{"Grace Too Short", 20 * time.Millisecond, false, poller.ReasonTimeout},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+
+			// Settling is skipped, as there is no time left for it.
+			p := poller.New(SlowWatcher{Delay: 300 * time.Millisecond}, "READY", false, false, false,
+				poller.WithOutput(io.Discard), poller.WithTimeoutGrace(tc.grace), poller.WithSettle(time.Second))
+			if success := p.Run(ctx, time.Millisecond, 0, 1, 0); success != tc.expected {
+				t.Errorf("Expected success=%v, got %v", tc.expected, success)
+			}
+			if p.StopReason() != tc.reason {
+				t.Errorf("Expected reason %q, got %q", tc.reason, p.StopReason())
+			}
+		})
+	}
+}
+
+func TestPoller_Run_TimeoutGrace_Cancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	p := poller.New(BlockingWatcher{}, "READY", false, false, false,
+		poller.WithOutput(io.Discard), poller.WithTimeoutGrace(time.Minute))
+	done := make(chan bool, 1)
+	go func() { done <- p.Run(ctx, time.Millisecond, 0, 1, 0) }()
+
+	select {
+	case success := <-done:
+		if success {
+			t.Error("Expected Run to fail")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Cancelling the context did not stop the check")
+	}
+}
+
+func TestPoller_Run_Annotate(t *testing.T) {
+	seqWatcher := &SequenceWatcher{Outputs: []string{"line 1\nline 2", "READY"}}
+	var out, passthrough bytes.Buffer
+	// The anchored pattern only matches if the annotation is left out of matching.
+	p := poller.New(seqWatcher, "^READY", true, true, false, poller.WithOutput(&out),
+		poller.WithPassthrough(&passthrough, "[app] "), poller.WithAnnotate())
+	if !p.Run(context.Background(), 1*time.Millisecond, 2, 1, 0) {
+		t.Fatal("Expected the pattern to be found")
+	}
+
+	const ts = `t=\d\d:\d\d:\d\d\] `
+	expectLines := func(name, text string, patterns ...string) {
+		t.Helper()
+		for _, pattern := range patterns {
+			if !regexp.MustCompile(`(?m)^` + pattern + `$`).MatchString(text) {
+				t.Errorf("Expected %s to contain a line matching %s, got:\n%s", name, pattern, text)
+			}
+		}
+	}
+	expectLines("the verbose output", out.String(),
+		`\[attempt=1 `+ts+`line 1`,
+		`\[attempt=1 `+ts+`line 2`,
+		`\[attempt=2 `+ts+`READY`,
+	)
+	expectLines("the passthrough output", passthrough.String(),
+		`\[attempt=1 `+ts+`\[app\] line 1`,
+		`\[attempt=2 `+ts+`\[app\] READY`,
+	)
+}
+
+// SlowCheckWatcher takes a while to return a non-matching output.
+type SlowCheckWatcher struct {
+	Delay    time.Duration
+	Attempts int
+}
+
+func (w *SlowCheckWatcher) Check() ([]byte, error) {
+	w.Attempts++
+	time.Sleep(w.Delay)
+	return []byte("starting"), nil
+}
+
+func TestPoller_Run_MaxWaitTotal(t *testing.T) {
+	slow := &SlowCheckWatcher{Delay: 40 * time.Millisecond}
+	p := poller.New(slow, "READY", false, false, false,
+		poller.WithOutput(io.Discard), poller.WithMaxWaitTotal(100*time.Millisecond))
+	start := time.Now()
+	if p.Run(context.Background(), 25*time.Millisecond, 0, 1, 0) {
+		t.Fatal("Expected Run to fail")
+	}
+	elapsed := time.Since(start)
+
+	if p.StopReason() != poller.ReasonWaitBudget {
+		t.Errorf("Expected reason %q, got %q", poller.ReasonWaitBudget, p.StopReason())
+	}
+	// At most four waits of 25ms use up the budget, fewer if they overrun, each
+	// followed by a check. A budget including the 40ms checks would only fit two.
+	if slow.Attempts < 3 || slow.Attempts > 5 {
+		t.Errorf("Expected 3 to 5 attempts, got %d", slow.Attempts)
+	}
+	if minElapsed := 100*time.Millisecond + time.Duration(slow.Attempts)*slow.Delay; elapsed < minElapsed {
+		t.Errorf("Expected the checks to take time on top of the budget, at least %s, took %s", minElapsed, elapsed)
+	}
+}
+
+// waits extracts the delays logged in verbose mode.
+func waits(t *testing.T, log string) []time.Duration {
+	t.Helper()
+	var delays []time.Duration
+	for _, m := range regexp.MustCompile(`Waiting (\S+) before`).FindAllStringSubmatch(log, -1) {
+		d, err := time.ParseDuration(m[1])
+		if err != nil {
+			t.Fatalf("Invalid delay %q: %v", m[1], err)
+		}
+		delays = append(delays, d)
+	}
+	return delays
+}
+
+func TestPoller_Run_AnchoredBackoff(t *testing.T) {
+	const interval, backoff, jitter = time.Millisecond, 2.0, 0.5
+	run := func(opts ...poller.Option) []time.Duration {
+		var out bytes.Buffer
+		opts = append(opts, poller.WithOutput(&out), poller.WithRandSource(rand.NewSource(7)))
+		p := poller.New(&MockWatcher{Output: []byte("starting")}, "READY", true, false, false, opts...)
+		p.Run(context.Background(), interval, 6, backoff, jitter)
+		return waits(t, out.String())
+	}
+	standard, anchored := run(), run(poller.WithAnchoredBackoff())
+	if len(standard) != 5 || len(anchored) != 5 {
+		t.Fatalf("Expected 5 waits each, got %v and %v", standard, anchored)
+	}
+
+	// The same random numbers give the same first delay.
+	if standard[0] != anchored[0] {
+		t.Errorf("Expected the same first delay, got %s and %s", standard[0], anchored[0])
+	}
+	for i := 1; i < 5; i++ {
+		// Standard: recomputed from the interval, within the jitter of interval * backoff^n.
+		base := time.Duration(float64(interval) * math.Pow(backoff, float64(i+1)))
+		if standard[i] < base || standard[i] > time.Duration(float64(base)*(1+jitter)) {
+			t.Errorf("Standard wait %d: expected %s to %s, got %s", i+1, base, time.Duration(float64(base)*(1+jitter)), standard[i])
+		}
+		// Anchored: at least the previous delay times the factor, so jitter accumulates.
+		if anchored[i] < time.Duration(float64(anchored[i-1])*backoff) {
+			t.Errorf("Anchored wait %d: expected at least %s, got %s", i+1, time.Duration(float64(anchored[i-1])*backoff), anchored[i])
+		}
+	}
+	if anchored[4] <= standard[4] {
+		t.Errorf("Expected anchored delays to outgrow standard ones with jitter, got %v and %v", anchored, standard)
+	}
+}
+
+func TestPoller_Run_MaxDelay(t *testing.T) {
+	var out bytes.Buffer
+	p := poller.New(&MockWatcher{Output: []byte("starting")}, "READY", true, false, false,
+		poller.WithOutput(&out), poller.WithMaxDelay(5*time.Millisecond))
+	p.Run(context.Background(), time.Millisecond, 6, 2, 0.5)
+
+	got := waits(t, out.String())
+	if len(got) != 5 {
+		t.Fatalf("Expected 5 waits, got %v", got)
+	}
+	// 2ms and 4ms, plus jitter, then levelled off at the cap.
+	for i, d := range got {
+		if d > 5*time.Millisecond || (i >= 2 && d != 5*time.Millisecond) {
+			t.Errorf("Wait %d: expected at most 5ms, and 5ms from the third on, got %v", i+1, got)
+			break
+		}
+	}
+}
+
+func TestPoller_Run_DedupLog(t *testing.T) {
+	seqWatcher := &SequenceWatcher{Outputs: []string{
+		"retrying\nretrying\nretrying\nconnected\nretrying\nretrying",
+		"READY\nREADY\n",
+	}}
+	var out, passthrough bytes.Buffer
+	// The pattern only matches if the collapsed lines are left out of matching.
+	p := poller.New(seqWatcher, "retrying\nretrying\nretrying", true, false, false, poller.WithOutput(&out),
+		poller.WithPassthrough(&passthrough, "> "), poller.WithDedupLog())
+	if !p.Run(context.Background(), 1*time.Millisecond, 2, 1, 0) {
+		t.Fatal("Expected the pattern to be found")
+	}
+
+	expected := "retrying (x3)\nconnected\nretrying (x2)\n"
+	if !strings.Contains(out.String(), "Attempt 1: Output:\n"+expected) {
+		t.Errorf("Expected the verbose output to contain %q, got:\n%s", expected, out.String())
+	}
+	if passthrough.String() != "> retrying (x3)\n> connected\n> retrying (x2)\n" {
+		t.Errorf("Unexpected passthrough output: %q", passthrough.String())
+	}
+}
+
+func TestPoller_TrivialPatterns(t *testing.T) {
+	testCases := []struct {
+		name     string
+		patterns []string
+		regex    bool
+		expected []string
+	}{
+		{"Plain", []string{"ready", " "}, false, nil},
+		{"Regex", []string{"^ready$", `\d+`, "."}, true, []string{"."}},
+		{"Empty match", []string{".*", "a?", "^", "ready|"}, true, []string{".*", "a?", "^", "ready|"}},
+		{"Invalid regex", []string{"("}, true, nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := poller.New(&MockWatcher{}, "", false, tc.regex, false, poller.WithPatterns(tc.patterns...))
+			if got := p.TrivialPatterns(); !slices.Equal(got, tc.expected) {
+				t.Errorf("Expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+
+	p := poller.New(&MockWatcher{}, "ab", false, false, false, poller.WithMatcher(matcher.NewFuzzyMatcher("ab", 2, false)))
+	if got := p.TrivialPatterns(); !slices.Equal(got, []string{"ab"}) {
+		t.Errorf("Expected a fuzzy pattern within reach of empty output to be trivial, got %q", got)
+	}
+}
+
+// ConcurrentWatcher records how many checks run at the same time, across all
+// the watchers sharing active and peak.
+type ConcurrentWatcher struct {
+	Output       string
+	active, peak *atomic.Int32
+}
+
+func (w *ConcurrentWatcher) Check() ([]byte, error) {
+	n := w.active.Add(1)
+	defer w.active.Add(-1)
+	for {
+		peak := w.peak.Load()
+		if n <= peak || w.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	return []byte(w.Output), nil
+}
+
+func TestRunAll(t *testing.T) {
+	wait := func(name string, outputs ...string) poller.Wait {
+		return poller.Wait{Name: name, Poller: poller.New(&SequenceWatcher{Outputs: outputs}, "READY", false, false, false, poller.WithOutput(io.Discard))}
+	}
+
+	t.Run("All", func(t *testing.T) {
+		ok, results := poller.RunAll(context.Background(), []poller.Wait{
+			wait("db", "starting", "READY"),
+			wait("api", "READY"),
+		}, 0, false, time.Millisecond, 5, 1, 0)
+		if !ok {
+			t.Fatalf("Expected all waits to succeed, got %+v", results)
+		}
+		for i, name := range []string{"db", "api"} {
+			if results[i].Name != name || !results[i].Success || results[i].Reason != poller.ReasonMatched {
+				t.Errorf("Unexpected result %d: %+v", i, results[i])
+			}
+		}
+	})
+
+	t.Run("All, one failing", func(t *testing.T) {
+		start := time.Now()
+		ok, results := poller.RunAll(context.Background(), []poller.Wait{
+			wait("db", "starting"),
+			wait("api", "down"),
+			wait("cache", "READY"),
+		}, 0, false, 100*time.Millisecond, 2, 1, 0)
+		if ok {
+			t.Fatal("Expected the combined wait to fail")
+		}
+		// The first failure decides; the other still pending is stopped.
+		failed := 0
+		for _, r := range results[:2] {
+			switch r.Reason {
+			case poller.ReasonMaxRetries:
+				failed++
+			case "":
+			default:
+				t.Errorf("Unexpected result: %+v", r)
+			}
+		}
+		if failed == 0 {
+			t.Errorf("Expected a failed wait, got %+v", results)
+		}
+		if !results[2].Success {
+			t.Errorf("Expected cache to have matched, got %+v", results[2])
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Expected the remaining waits to be stopped, took %s", elapsed)
+		}
+	})
+
+	t.Run("Any", func(t *testing.T) {
+		ok, results := poller.RunAll(context.Background(), []poller.Wait{
+			wait("primary", "down"),
+			wait("replica", "starting", "READY"),
+		}, 0, true, 10*time.Millisecond, 0, 1, 0)
+		if !ok {
+			t.Fatalf("Expected the combined wait to succeed, got %+v", results)
+		}
+		if !results[1].Success || results[0].Success || results[0].Reason != "" {
+			t.Errorf("Expected replica to match and primary to be stopped, got %+v", results)
+		}
+	})
+
+	t.Run("Parallel", func(t *testing.T) {
+		var active, peak atomic.Int32
+		var waits []poller.Wait
+		for i := range 5 {
+			w := &ConcurrentWatcher{Output: "READY", active: &active, peak: &peak}
+			waits = append(waits, poller.Wait{Name: fmt.Sprint(i), Poller: poller.New(w, "READY", false, false, false, poller.WithOutput(io.Discard))})
+		}
+		if ok, _ := poller.RunAll(context.Background(), waits, 2, false, time.Millisecond, 1, 1, 0); !ok {
+			t.Fatal("Expected all waits to succeed")
+		}
+		if peak.Load() != 2 {
+			t.Errorf("Expected at most 2 checks at a time, and 2 at some point, got %d", peak.Load())
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		ok, results := poller.RunAll(ctx, []poller.Wait{
+			wait("db", "starting"),
+			wait("api", "starting"),
+		}, 0, false, 10*time.Millisecond, 0, 1, 0)
+		if ok {
+			t.Fatal("Expected the combined wait to fail")
+		}
+		// Both are stopped by the shared deadline, and report it.
+		for _, r := range results {
+			if r.Reason != poller.ReasonTimeout {
+				t.Errorf("Expected a timeout, got %+v", r)
+			}
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package poller
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Status describes how far a run has progressed.
+type Status struct {
+	// Attempt is the number of checks made so far.
+	Attempt int
+	// MaxRetries is the attempt limit, or 0 if there is none.
+	MaxRetries int
+	// Elapsed is the time since the run started.
+	Elapsed time.Duration
+	// Reason is why the run stopped, or "" while it is still running.
+	Reason Reason
+	// MatchOffset is where the occurrence reaching WithMinCount starts, or -1.
+	MatchOffset int64
+	// Percent is how much of the attempt limit or timeout has been used, whichever
+	// is closer to running out, from 0 to 100. It is -1 when neither is set.
+	Percent float64
+}
+
+// Env returns the status as WATCHFOR_* environment variables, for commands run
+// after or during the wait. WATCHFOR_PROGRESS_PCT and WATCHFOR_MATCH_OFFSET are left
+// out when unknown.
+func (s Status) Env() []string {
+	env := []string{
+		"WATCHFOR_ATTEMPT=" + strconv.Itoa(s.Attempt),
+		"WATCHFOR_MAX_RETRIES=" + strconv.Itoa(s.MaxRetries),
+		"WATCHFOR_ELAPSED_MS=" + strconv.FormatInt(s.Elapsed.Milliseconds(), 10),
+	}
+	if s.Reason != "" {
+		env = append(env, "WATCHFOR_REASON="+string(s.Reason))
+	}
+	if s.MatchOffset >= 0 {
+		env = append(env, "WATCHFOR_MATCH_OFFSET="+strconv.FormatInt(s.MatchOffset, 10))
+	}
+	if s.Percent >= 0 {
+		env = append(env, fmt.Sprintf("WATCHFOR_PROGRESS_PCT=%d", int(math.Round(s.Percent))))
+	}
+	return env
+}
+
+// Status returns the progress of the current or last run.
+func (p *Poller) Status() Status {
+	s := Status{Attempt: p.attempts, MaxRetries: p.maxRetries, Reason: p.reason, MatchOffset: p.MatchOffset(), Percent: -1}
+	if p.start.IsZero() {
+		return s
+	}
+	s.Elapsed = time.Since(p.start)
+	if p.maxRetries > 0 {
+		s.Percent = 100 * float64(p.attempts) / float64(p.maxRetries)
+	}
+	if !p.deadline.IsZero() {
+		if total := p.deadline.Sub(p.start); total > 0 {
+			s.Percent = math.Max(s.Percent, 100*float64(s.Elapsed)/float64(total))
+		}
+	}
+	if s.Percent > 100 {
+		s.Percent = 100
+	}
+	return s
+}
+
+// Reason tells why a run stopped.
+type Reason string
+
+const (
+	ReasonMatched              Reason = "matched"
+	ReasonMaxRetries           Reason = "max-retries"
+	ReasonTimeout              Reason = "timeout"
+	ReasonAborted              Reason = "aborted"
+	ReasonMatchError           Reason = "match-error"
+	ReasonPatternWindowExpired Reason = "pattern-window-expired"
+	ReasonSourceSilent         Reason = "source-silent"
+	ReasonWaitBudget           Reason = "wait-budget"
+	ReasonTimeoutAfterMatch    Reason = "timeout-after-match"
+)
+
+// Reasons lists all stop reasons, e.g. for validating user input.
+var Reasons = []Reason{
+	ReasonMatched, ReasonMaxRetries, ReasonTimeout, ReasonAborted, ReasonMatchError,
+	ReasonPatternWindowExpired, ReasonSourceSilent, ReasonWaitBudget, ReasonTimeoutAfterMatch,
+}
+
+// reasonAliases are other names accepted for reasons by ParseExitCodes.
+var reasonAliases = map[string]Reason{
+	"abort": ReasonAborted,
+}
+
+// ExitCodes maps stop reasons to the exit codes to use for them.
+type ExitCodes map[Reason]int
+
+// ParseExitCodes checks reason=code pairs, e.g. given on the command line: the
+// reasons must be known and the codes valid exit codes, from 0 to 255. "abort"
+// is accepted for "aborted".
+func ParseExitCodes(pairs map[string]int) (ExitCodes, error) {
+	codes := make(ExitCodes, len(pairs))
+	for name, code := range pairs {
+		reason, ok := reasonAliases[name]
+		if !ok {
+			reason = Reason(name)
+		}
+		if !slices.Contains(Reasons, reason) {
+			return nil, fmt.Errorf("unknown reason %q, expected one of %v", name, Reasons)
+		}
+		if _, dup := codes[reason]; dup {
+			return nil, fmt.Errorf("reason %s given twice", reason)
+		}
+		if code < 0 || code > 255 {
+			return nil, fmt.Errorf("exit code %d for %s is not between 0 and 255", code, name)
+		}
+		codes[reason] = code
+	}
+	return codes, nil
+}
+
+// Code returns the exit code for reason, or def if none is set.
+func (c ExitCodes) Code(reason Reason, def int) int {
+	if code, ok := c[reason]; ok {
+		return code
+	}
+	return def
+}
+
+// StopReason returns why the last run stopped, or "" if it has not stopped yet.
+func (p *Poller) StopReason() Reason {
+	return p.reason
+}
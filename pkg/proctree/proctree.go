@@ -0,0 +1,39 @@
+// Package proctree makes cancelling a command terminate every process it
+// started, not only the shell that runs it.
+package proctree
+
+import (
+	"os/exec"
+	"time"
+)
+
+// waitDelay bounds how long a killed command may keep its output pipes open,
+// e.g. through a process that escaped the tree.
+const waitDelay = 2 * time.Second
+
+// Configure starts cmd in its own process group, so that when the context of an
+// exec.CommandContext is done, the whole tree is killed instead of just cmd.
+// It must be called before the command is started.
+func Configure(cmd *exec.Cmd) {
+	setGroup(cmd)
+	ConfigureLeader(cmd)
+}
+
+// ConfigureLeader is like Configure, for a command that is made the leader of
+// its own process group in another way, e.g. by starting it in a new session
+// on Unix, which a process group set by Configure would conflict with.
+func ConfigureLeader(cmd *exec.Cmd) {
+	cmd.Cancel = func() error {
+		return Kill(cmd)
+	}
+	cmd.WaitDelay = waitDelay
+}
+
+// Kill terminates a command started after Configure, along with all of its
+// descendants. It does nothing if the command has not been started.
+func Kill(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return killGroup(cmd)
+}
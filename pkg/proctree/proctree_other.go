@@ -0,0 +1,12 @@
+//go:build !unix && !windows
+
+package proctree
+
+import "os/exec"
+
+func setGroup(cmd *exec.Cmd) {}
+
+// killGroup only kills the command itself, as process groups are not supported.
+func killGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,42 @@
+//go:build unix
+
+package proctree_test
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/gregory-chatelier/watchfor/pkg/proctree"
+)
+
+func TestConfigure_CancelKillsDescendants(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// The subshell holds the output pipe open; if it survived the cancellation,
+	// reading the output would only end after WaitDelay.
+	cmd := exec.CommandContext(ctx, "sh", "-c", "(sleep 10; echo late) & wait")
+	proctree.Configure(cmd)
+
+	start := time.Now()
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatal("Expected an error from the cancelled command")
+	}
+	if len(output) > 0 {
+		t.Errorf("Expected no output, got %q", output)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the command tree to be killed promptly, took %s", elapsed)
+	}
+}
+
+func TestKill_NotStarted(t *testing.T) {
+	cmd := exec.Command("true")
+	proctree.Configure(cmd)
+	if err := proctree.Kill(cmd); err != nil {
+		t.Errorf("Expected no error for a command that was never started, got %v", err)
+	}
+}
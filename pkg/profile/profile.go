@@ -0,0 +1,58 @@
+// Package profile writes pprof profiles of a whole run.
+package profile
+
+import (
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// Profile is a run being profiled.
+type Profile struct {
+	cpu *os.File
+	mem *os.File
+}
+
+// Start starts writing a CPU profile to cpuPath, and creates memPath for the
+// heap profile written by Stop, so that a bad path is reported before the run
+// starts. Either path may be empty.
+func Start(cpuPath, memPath string) (*Profile, error) {
+	p := &Profile{}
+	if cpuPath != "" {
+		f, err := os.Create(cpuPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		p.cpu = f
+	}
+	if memPath != "" {
+		f, err := os.Create(memPath)
+		if err != nil {
+			p.Stop()
+			return nil, err
+		}
+		p.mem = f
+	}
+	return p, nil
+}
+
+// Stop stops the CPU profile and writes the heap profile. The profiles are
+// incomplete unless it is called before the process exits.
+func (p *Profile) Stop() error {
+	if p.cpu != nil {
+		pprof.StopCPUProfile()
+		p.cpu.Close()
+		p.cpu = nil
+	}
+	if p.mem == nil {
+		return nil
+	}
+	defer func() { p.mem = nil }()
+	defer p.mem.Close()
+	runtime.GC() // Up-to-date statistics of what is still in use.
+	return pprof.WriteHeapProfile(p.mem)
+}
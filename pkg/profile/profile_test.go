@@ -0,0 +1,52 @@
+package profile_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gregory-chatelier/watchfor/pkg/profile"
+)
+
+func TestStartStop(t *testing.T) {
+	dir := t.TempDir()
+	cpuPath := filepath.Join(dir, "cpu.prof")
+	memPath := filepath.Join(dir, "mem.prof")
+
+	p, err := profile.Start(cpuPath, memPath)
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if info, err := os.Stat(memPath); err != nil || info.Size() != 0 {
+		t.Fatalf("Expected an empty heap profile before Stop, got %v, %v", info, err)
+	}
+	if err := p.Stop(); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	for _, path := range []string{cpuPath, memPath} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Stat failed: %v", err)
+		}
+		if info.Size() == 0 {
+			t.Errorf("Expected %s to hold a profile after Stop", filepath.Base(path))
+		}
+	}
+	if err := p.Stop(); err != nil {
+		t.Errorf("Expected a second Stop to do nothing, got %v", err)
+	}
+}
+
+func TestStart_BadPath(t *testing.T) {
+	dir := t.TempDir()
+	cpuPath := filepath.Join(dir, "cpu.prof")
+	if _, err := profile.Start(cpuPath, filepath.Join(dir, "missing", "mem.prof")); err == nil {
+		t.Fatal("Expected an error for a heap profile in a missing directory")
+	}
+	// The CPU profile was stopped, so another one can start.
+	p, err := profile.Start(cpuPath, "")
+	if err != nil {
+		t.Fatalf("Expected the CPU profile to be stopped after the error, got %v", err)
+	}
+	p.Stop()
+}
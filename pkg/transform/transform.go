@@ -0,0 +1,223 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gregory-chatelier/watchfor/pkg/executor"
+)
+
+// Func rewrites a watcher's output before it is matched.
+// A returned error makes the attempt a non-match.
+type Func func(output []byte) ([]byte, error)
+
+// Command pipes the output into a shell command and uses its standard output.
+func Command(command string) Func {
+	return func(output []byte) ([]byte, error) {
+		return executor.Capture(command, output)
+	}
+}
+
+// Between keeps only the region between the first start marker and the next end
+// marker. If the end marker is missing, everything after the start marker is kept;
+// if the start marker is missing, nothing is.
+func Between(start, end string) Func {
+	return func(output []byte) ([]byte, error) {
+		i := bytes.Index(output, []byte(start))
+		if i < 0 {
+			return nil, nil
+		}
+		region := output[i+len(start):]
+		if j := bytes.Index(region, []byte(end)); j >= 0 {
+			region = region[:j]
+		}
+		return region, nil
+	}
+}
+
+// LineRange parses a range of lines, `START:END`, and keeps only those lines of
+// the output. Lines are numbered from 1 and both ends are included; an omitted
+// START means the first line and an omitted END the last one. A range reaching
+// past the end of the output is clamped to it.
+func LineRange(spec string) (Func, error) {
+	startSpec, endSpec, ok := strings.Cut(spec, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid line range %q: expected START:END", spec)
+	}
+	start, end := 1, 0
+	var err error
+	if startSpec != "" {
+		if start, err = strconv.Atoi(startSpec); err != nil || start < 1 {
+			return nil, fmt.Errorf("invalid line range %q: START must be a line number from 1", spec)
+		}
+	}
+	if endSpec != "" {
+		if end, err = strconv.Atoi(endSpec); err != nil || end < start {
+			return nil, fmt.Errorf("invalid line range %q: END must be a line number from START", spec)
+		}
+	}
+
+	return func(output []byte) ([]byte, error) {
+		var region []byte
+		n := 0
+		for line := range bytes.Lines(output) {
+			n++
+			if end > 0 && n > end {
+				break
+			}
+			if n >= start {
+				region = append(region, line...)
+			}
+		}
+		return region, nil
+	}, nil
+}
+
+// NewLines keeps only the lines that are new compared to the previous output
+// it was given, for sources that return their whole output on every check. A
+// line is new if it occurs more times than in the previous output, wherever
+// it is, so lines that only moved are not new. Everything is new the first
+// time. An empty output does not replace the previous one.
+func NewLines() Func {
+	seen := map[string]int{}
+	return func(output []byte) ([]byte, error) {
+		if len(output) == 0 {
+			return nil, nil
+		}
+		counts := map[string]int{}
+		var added []byte
+		for line := range bytes.Lines(output) {
+			key := string(bytes.TrimSuffix(line, []byte("\n")))
+			counts[key]++
+			if counts[key] > seen[key] {
+				added = append(added, line...)
+			}
+		}
+		seen = counts
+		return added, nil
+	}
+}
+
+// Base64 decodes the output, ignoring surrounding whitespace. With urlSafe, the
+// URL-safe alphabet is used instead of the standard one. Padding is optional.
+func Base64(urlSafe bool) Func {
+	padded, raw := base64.StdEncoding, base64.RawStdEncoding
+	if urlSafe {
+		padded, raw = base64.URLEncoding, base64.RawURLEncoding
+	}
+
+	return func(output []byte) ([]byte, error) {
+		encoded := bytes.TrimSpace(output)
+		enc := padded
+		if len(encoded)%4 != 0 {
+			enc = raw
+		}
+		decoded := make([]byte, enc.DecodedLen(len(encoded)))
+		n, err := enc.Decode(decoded, encoded)
+		if err != nil {
+			return nil, err
+		}
+		return decoded[:n], nil
+	}
+}
+
+// NormalizeNewlines converts CRLF and lone CR line endings to LF.
+func NormalizeNewlines(output []byte) ([]byte, error) {
+	output = bytes.ReplaceAll(output, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(output, []byte("\r"), []byte("\n")), nil
+}
+
+// DefaultTimestampRegex matches an RFC 3339 timestamp anywhere in a line.
+const DefaultTimestampRegex = `\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:\d{2})`
+
+// Since drops the lines whose timestamp is before since. The timestamp is the first
+// capture group of re, or the whole match if re has none, parsed as RFC 3339.
+// Lines without a parseable timestamp are kept, unless dropUntimed is set.
+func Since(since time.Time, re *regexp.Regexp, dropUntimed bool) Func {
+	return func(output []byte) ([]byte, error) {
+		var kept []byte
+		for _, line := range bytes.SplitAfter(output, []byte("\n")) {
+			if len(line) == 0 {
+				continue
+			}
+			ts, ok := lineTime(re, line)
+			if (ok && ts.Before(since)) || (!ok && dropUntimed) {
+				continue
+			}
+			kept = append(kept, line...)
+		}
+		return kept, nil
+	}
+}
+
+func lineTime(re *regexp.Regexp, line []byte) (time.Time, bool) {
+	m := re.FindSubmatch(line)
+	if m == nil {
+		return time.Time{}, false
+	}
+	raw := m[0]
+	if len(m) > 1 {
+		raw = m[1]
+	}
+	ts, err := time.Parse(time.RFC3339, string(raw))
+	return ts, err == nil
+}
+
+// Substitute parses a sed-style substitution, `s/regex/replacement/`, and applies
+// it to every match in the output. Any delimiter may follow the `s`, and can be
+// escaped with a backslash. The replacement may reference groups as `$1` or `${name}`.
+// The only supported flags are `g`, which is implied, and `i` for case-insensitive matching.
+func Substitute(expr string) (Func, error) {
+	if len(expr) < 2 || expr[0] != 's' {
+		return nil, fmt.Errorf("invalid substitution %q: expected s/regex/replacement/", expr)
+	}
+	parts := splitUnescaped(expr[2:], expr[1])
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid substitution %q: expected s/regex/replacement/", expr)
+	}
+
+	pattern, replacement, flags := parts[0], []byte(parts[1]), parts[2]
+	for _, flag := range flags {
+		switch flag {
+		case 'g':
+		case 'i':
+			pattern = "(?i)" + pattern
+		default:
+			return nil, fmt.Errorf("invalid substitution %q: unknown flag %q", expr, flag)
+		}
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid substitution %q: %w", expr, err)
+	}
+
+	return func(output []byte) ([]byte, error) {
+		return re.ReplaceAll(output, replacement), nil
+	}, nil
+}
+
+// splitUnescaped splits s on delim, turning an escaped delimiter into a literal one.
+// Other escapes are kept, so regex escapes such as \d still work.
+func splitUnescaped(s string, delim byte) []string {
+	var parts []string
+	var current strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == delim:
+			current.WriteByte(delim)
+			i++
+		case s[i] == delim:
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(s[i])
+		}
+	}
+	return append(parts, current.String())
+}
@@ -0,0 +1,264 @@
+package transform_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/gregory-chatelier/watchfor/pkg/transform"
+)
+
+func TestCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on sed")
+	}
+
+	output, err := transform.Command("sed 's/status=//'")([]byte("status=ready\n"))
+	if err != nil {
+		t.Fatalf("Transform failed: %v", err)
+	}
+	if string(output) != "ready\n" {
+		t.Errorf("Expected 'ready\\n', got '%s'", string(output))
+	}
+
+	if _, err := transform.Command("exit 1")([]byte("anything")); err == nil {
+		t.Error("Expected a failing transform to return an error, got nil")
+	}
+}
+
+func TestBetween(t *testing.T) {
+	testCases := []struct {
+		name     string
+		output   string
+		expected string
+	}{
+		{"Both Markers", "noise BEGIN status=ok END noise", " status=ok "},
+		{"First Region Only", "BEGIN a END BEGIN b END", " a "},
+		{"Missing End Marker", "noise BEGIN status=ok", " status=ok"},
+		{"Missing Start Marker", "noise status=ok END", ""},
+		{"End Before Start Is Ignored", "END noise BEGIN status=ok", " status=ok"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			output, err := transform.Between("BEGIN", "END")([]byte(tc.output))
+			if err != nil {
+				t.Fatalf("Transform failed: %v", err)
+			}
+			if string(output) != tc.expected {
+				t.Errorf("Expected '%s', got '%s'", tc.expected, string(output))
+			}
+		})
+	}
+}
+
+func TestLineRange(t *testing.T) {
+	const output = "line 1\nline 2\nline 3\nline 4\nline 5"
+	testCases := []struct {
+		name     string
+		spec     string
+		expected string
+	}{
+		{"Middle", "2:3", "line 2\nline 3\n"},
+		{"Single Line", "4:4", "line 4\n"},
+		{"Last Line Without Newline", "5:5", "line 5"},
+		{"Open Start", ":2", "line 1\nline 2\n"},
+		{"Open End", "4:", "line 4\nline 5"},
+		{"Whole Output", ":", output},
+		{"End Clamped", "3:100", "line 3\nline 4\nline 5"},
+		{"Past The End", "10:20", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fn, err := transform.LineRange(tc.spec)
+			if err != nil {
+				t.Fatalf("LineRange failed: %v", err)
+			}
+			region, err := fn([]byte(output))
+			if err != nil {
+				t.Fatalf("Transform failed: %v", err)
+			}
+			if string(region) != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, region)
+			}
+		})
+	}
+}
+
+func TestLineRange_Invalid(t *testing.T) {
+	for _, spec := range []string{"", "5", "0:3", "-1:3", "5:3", "a:b", "1:x"} {
+		if _, err := transform.LineRange(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+}
+
+func TestNewLines(t *testing.T) {
+	steps := []struct {
+		output   string
+		expected string
+	}{
+		{"a\nb\n", "a\nb\n"},          // Everything is new at first.
+		{"a\nb\nc\n", "c\n"},          // Appended line.
+		{"b\nc\nd\n", "d\n"},          // Scrolled window, overlapping the previous output.
+		{"b\nc\nd\n", ""},             // Unchanged.
+		{"", ""},                      // Empty output is ignored...
+		{"b\nc\nd\ne", "e"},           // ...so only the new line is reported afterwards.
+		{"c\nb\nd\ne\ne\n", "e\n"},    // Moved lines are not new, a repeated one is.
+		{"x\nc\nb\nd\ne\ne\n", "x\n"}, // Inserted at the top.
+	}
+
+	newLines := transform.NewLines()
+	for i, step := range steps {
+		output, err := newLines([]byte(step.output))
+		if err != nil {
+			t.Fatalf("Step %d: transform failed: %v", i+1, err)
+		}
+		if string(output) != step.expected {
+			t.Errorf("Step %d: after %q, expected %q, got %q", i+1, step.output, step.expected, output)
+		}
+	}
+}
+
+func TestBase64(t *testing.T) {
+	testCases := []struct {
+		name      string
+		urlSafe   bool
+		encoded   string
+		expected  string
+		expectErr bool
+	}{
+		// {"status":"ready?"} encodes with '+' and '/' in the standard alphabet.
+		{"Standard", false, "eyJzdGF0dXMiOiJyZWFkeT8ifQ==\n", `{"status":"ready?"}`, false},
+		{"Standard Unpadded", false, "eyJzdGF0dXMiOiJyZWFkeT8ifQ", `{"status":"ready?"}`, false},
+		{"URL Safe", true, "PD8-Pz8_", "<?>???", false},
+		{"URL Safe Rejects Standard Alphabet", true, "PD8+Pz8/", "", true},
+		{"Invalid", false, "not base64!", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			output, err := transform.Base64(tc.urlSafe)([]byte(tc.encoded))
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("Expected error=%v, got: %v", tc.expectErr, err)
+			}
+			if !tc.expectErr && string(output) != tc.expected {
+				t.Errorf("Expected '%s', got '%s'", tc.expected, string(output))
+			}
+		})
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	testCases := []struct {
+		name     string
+		exprs    []string
+		output   string
+		expected string
+	}{
+		{"Strip Timestamps", []string{`s/\d{2}:\d{2}:\d{2} //`}, "12:00:01 ready\n12:00:02 ready\n", "ready\nready\n"},
+		{"Group Reference", []string{`s/build-(\d+)/build $1/`}, "build-42 ok", "build 42 ok"},
+		{"Other Delimiter", []string{`s|/tmp/[a-z0-9]+|TMP|`}, "wrote /tmp/x1y2z3", "wrote TMP"},
+		{"Escaped Delimiter", []string{`s/a\/b/c/`}, "a/b", "c"},
+		{"Case Insensitive", []string{`s/ERROR/error/i`}, "Error ERROR", "error error"},
+		{"Applied In Order", []string{`s/id=[0-9a-f]+/id=X/`, `s/X/ID/`}, "job id=9f3c done", "job id=ID done"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			output := []byte(tc.output)
+			for _, expr := range tc.exprs {
+				fn, err := transform.Substitute(expr)
+				if err != nil {
+					t.Fatalf("Substitute(%q) failed: %v", expr, err)
+				}
+				output, _ = fn(output)
+			}
+			if string(output) != tc.expected {
+				t.Errorf("Expected '%s', got '%s'", tc.expected, string(output))
+			}
+		})
+	}
+}
+
+func TestSubstitute_MatchesOnlyAfterNormalization(t *testing.T) {
+	output := []byte("deploy 7f3a9c2 finished in 1234ms")
+	pattern := []byte("deploy <sha> finished")
+
+	if bytes.Contains(output, pattern) {
+		t.Fatal("Expected the raw output not to match")
+	}
+
+	fn, err := transform.Substitute(`s/[0-9a-f]{7}/<sha>/`)
+	if err != nil {
+		t.Fatalf("Substitute failed: %v", err)
+	}
+	normalized, _ := fn(output)
+	if !bytes.Contains(normalized, pattern) {
+		t.Errorf("Expected the normalized output to match, got '%s'", string(normalized))
+	}
+}
+
+func TestSubstitute_Invalid(t *testing.T) {
+	for _, expr := range []string{"", "s", "y/a/b/", "s/a/b", "s/a/b/c/", "s/[a/b/", "s/a/b/x"} {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := transform.Substitute(expr); err == nil {
+				t.Errorf("Expected an error for %q, got nil", expr)
+			}
+		})
+	}
+}
+
+func TestNormalizeNewlines(t *testing.T) {
+	output, err := transform.NormalizeNewlines([]byte("READY\r\nold\rnew\n\r\n"))
+	if err != nil {
+		t.Fatalf("Transform failed: %v", err)
+	}
+	if string(output) != "READY\nold\nnew\n\n" {
+		t.Errorf("Expected LF line endings, got %q", string(output))
+	}
+}
+
+func TestSince(t *testing.T) {
+	log, err := os.ReadFile(filepath.Join("testdata", "mixed.log"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	since := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	re := regexp.MustCompile(transform.DefaultTimestampRegex)
+
+	testCases := []struct {
+		name        string
+		re          *regexp.Regexp
+		dropUntimed bool
+		expected    string
+	}{
+		{"Keep Untimed", re, false, "    at db.connect (db.go:42)\n" +
+			"2024-05-01T10:00:00Z INFO service ready\n" +
+			"2024-05-01T12:00:01+02:00 INFO replica ready\n" +
+			"2024-05-01T10:00:05.250Z WARN slow query\n" +
+			"2024-05-01T10:01:00Z ERROR connection refused\n"},
+		{"Drop Untimed", re, true, "2024-05-01T10:00:00Z INFO service ready\n" +
+			"2024-05-01T12:00:01+02:00 INFO replica ready\n" +
+			"2024-05-01T10:00:05.250Z WARN slow query\n" +
+			"2024-05-01T10:01:00Z ERROR connection refused\n"},
+		{"Capture Group", regexp.MustCompile(`^(\S+) ERROR`), true, "2024-05-01T10:01:00Z ERROR connection refused\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			output, err := transform.Since(since, tc.re, tc.dropUntimed)(log)
+			if err != nil {
+				t.Fatalf("Transform failed: %v", err)
+			}
+			if string(output) != tc.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tc.expected, string(output))
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package watcher
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// The built-in watchers, available to FromSpec.
+func init() {
+	Register("cmd", func(spec string) (Watcher, error) {
+		return NewCommandWatcher(spec), nil
+	})
+	Register("pty", func(spec string) (Watcher, error) {
+		return nonNil(NewPTYWatcher(spec))
+	})
+	Register("file", func(spec string) (Watcher, error) {
+		return nonNil(NewFileWatcher(spec))
+	})
+	Register("fifo", func(spec string) (Watcher, error) {
+		return nonNil(NewFIFOWatcher(spec))
+	})
+	Register("dir", func(spec string) (Watcher, error) {
+		return nonNil(NewDirWatcher(spec, "*"))
+	})
+	Register("journal", func(spec string) (Watcher, error) {
+		return nonNil(NewJournalWatcher(spec))
+	})
+	Register("tls", func(spec string) (Watcher, error) {
+		return NewTLSCertWatcher(spec, 0), nil
+	})
+	Register("lock", func(spec string) (Watcher, error) {
+		return NewFileLockWatcher(spec), nil
+	})
+	Register("redis", newRedisSource)
+	Register("mqtt", func(spec string) (Watcher, error) {
+		// The topic follows the broker, e.g. "user:password@host:1883/devices/+/status".
+		broker, topic, _ := strings.Cut(spec, "/")
+		if broker == "" || topic == "" {
+			return nil, errors.New("expected [user:password@]host:port/topic")
+		}
+		return nonNil(NewMQTTWatcher(broker, topic))
+	})
+	Register("listen", func(spec string) (Watcher, error) {
+		// The path follows the address, e.g. ":8099/ready", and defaults to "/".
+		addr, path, _ := strings.Cut(spec, "/")
+		return nonNil(NewListenWatcher(addr, "/"+path))
+	})
+	Register("pid", func(spec string) (Watcher, error) {
+		pid, err := strconv.Atoi(spec)
+		if err != nil {
+			return nil, err
+		}
+		return nonNil(NewProcessWatcher(pid, 0, 0))
+	})
+}
+
+// newRedisSource creates a watcher from a spec such as
+// "[:password@]host:port[/db]?key=name", or "?channel=name" for a channel.
+func newRedisSource(spec string) (Watcher, error) {
+	addr, query, _ := strings.Cut(spec, "?")
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	key, channel := values.Get("key"), values.Get("channel")
+	if (key == "") == (channel == "") {
+		return nil, errors.New("expected either ?key=name or ?channel=name")
+	}
+	if channel != "" {
+		return nonNil(NewRedisChannelWatcher("redis://"+addr, channel))
+	}
+	return nonNil(NewRedisWatcher("redis://"+addr, key))
+}
+
+// nonNil converts the result of a constructor to a Watcher, making sure that an
+// error comes with a nil interface rather than a nil pointer.
+func nonNil[W Watcher](w W, err error) (Watcher, error) {
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
@@ -0,0 +1,135 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DirWatcher reports files matching a glob that appear in a directory. Files
+// present when the watcher is created are ignored.
+//
+// The directory is watched with fsnotify where possible, so it is only listed
+// again after a change. Otherwise, it is listed on every check. A directory that
+// doesn't exist yet returns ErrFileNotFound until it is created.
+type DirWatcher struct {
+	dir      string
+	glob     string
+	seen     map[string]bool
+	fsw      *fsnotify.Watcher
+	watching bool
+	dirty    atomic.Bool
+}
+
+// NewDirWatcher creates a new watcher for files matching glob in dir, e.g. `*.tar.gz`.
+func NewDirWatcher(dir, glob string) (*DirWatcher, error) {
+	if _, err := filepath.Match(glob, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %w", glob, err)
+	}
+
+	dw := &DirWatcher{dir: dir, glob: glob, seen: make(map[string]bool)}
+	if fsw, err := fsnotify.NewWatcher(); err == nil {
+		dw.fsw = fsw
+		go dw.loop(fsw)
+	}
+
+	// Only files that appear from now on count.
+	names, err := dw.list()
+	if err != nil && !errors.Is(err, ErrFileNotFound) {
+		dw.Close()
+		return nil, err
+	}
+	for _, name := range names {
+		dw.seen[name] = true
+	}
+	return dw, nil
+}
+
+// Check returns the names of the matching files that appeared since the previous
+// check, one per line.
+func (dw *DirWatcher) Check() ([]byte, error) {
+	names, err := dw.list()
+	if err != nil {
+		return nil, err
+	}
+
+	var output []byte
+	for _, name := range names {
+		if !dw.seen[name] {
+			dw.seen[name] = true
+			output = append(output, name+"\n"...)
+		}
+	}
+	return output, nil
+}
+
+// list returns the matching file names, or nothing if the directory has not
+// changed since the last listing.
+func (dw *DirWatcher) list() ([]string, error) {
+	if dw.watching && !dw.dirty.Swap(false) {
+		return nil, nil
+	}
+	if dw.fsw != nil && !dw.watching {
+		// Watch before listing, so no file created in between is missed.
+		err := dw.fsw.Add(dw.dir)
+		switch {
+		case err == nil:
+			dw.watching = true
+		case !errors.Is(err, os.ErrNotExist):
+			// Keep listing on every check instead.
+			dw.fsw.Close()
+			dw.fsw = nil
+		}
+	}
+
+	entries, err := os.ReadDir(dw.dir)
+	if err != nil {
+		// The directory may have been removed: watch it again once it is back.
+		dw.watching = false
+		if dw.fsw != nil {
+			dw.fsw.Remove(dw.dir)
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if ok, _ := filepath.Match(dw.glob, entry.Name()); ok && !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+func (dw *DirWatcher) loop(fsw *fsnotify.Watcher) {
+	for {
+		select {
+		case _, ok := <-fsw.Events:
+			if !ok {
+				return
+			}
+			dw.dirty.Store(true)
+		case _, ok := <-fsw.Errors:
+			if !ok {
+				return
+			}
+			// Events may have been lost, so list the directory again.
+			dw.dirty.Store(true)
+		}
+	}
+}
+
+// Close stops watching the directory.
+func (dw *DirWatcher) Close() error {
+	if dw.fsw != nil {
+		return dw.fsw.Close()
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package watcher
+
+import "errors"
+
+// Errors returned by the watchers. They wrap the underlying error, so both can
+// be tested with errors.Is and errors.As.
+var (
+	// ErrFileNotFound is returned when the watched file or pipe does not exist.
+	ErrFileNotFound = errors.New("file not found")
+	// ErrCommandStartFailed is returned when the watched command could not be
+	// started at all, as opposed to running and exiting with a non-zero code.
+	ErrCommandStartFailed = errors.New("command could not be started")
+	// ErrTruncated is informational: the watched file was truncated, e.g. by log
+	// rotation, and is read again from the start. The output is still valid.
+	ErrTruncated = errors.New("file truncated, reading from the start")
+	// ErrNoNewData is informational: the watched file has not grown since the
+	// previous check, so there is nothing new to match. No output comes with it.
+	ErrNoNewData = errors.New("no new data")
+	// ErrProcessExited is returned when the watched process is gone, so waiting
+	// any longer is pointless.
+	ErrProcessExited = errors.New("process exited")
+)
@@ -0,0 +1,23 @@
+//go:build !unix
+
+package watcher
+
+import "errors"
+
+// FIFOWatcher reads from a named pipe. It is only supported on Unix-like systems.
+type FIFOWatcher struct{}
+
+// NewFIFOWatcher always fails on this platform.
+func NewFIFOWatcher(path string) (*FIFOWatcher, error) {
+	return nil, errors.New("named pipes are only supported on Unix-like systems")
+}
+
+// Check is never reached, as a FIFOWatcher cannot be created on this platform.
+func (fw *FIFOWatcher) Check() ([]byte, error) {
+	return nil, errors.New("named pipes are only supported on Unix-like systems")
+}
+
+// Close does nothing on this platform.
+func (fw *FIFOWatcher) Close() error {
+	return nil
+}
@@ -0,0 +1,87 @@
+//go:build unix
+
+package watcher
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// FIFOWatcher reads whatever is available from a named pipe without blocking.
+// The pipe is opened with O_NONBLOCK, so neither opening it without a writer
+// nor reading it between writes stalls the poll loop.
+type FIFOWatcher struct {
+	path string
+	fd   int
+}
+
+// NewFIFOWatcher opens a named pipe for non-blocking reads.
+func NewFIFOWatcher(path string) (*FIFOWatcher, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode()&os.ModeNamedPipe == 0 {
+		return nil, fmt.Errorf("%s is not a named pipe", path)
+	}
+
+	fd, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	syscall.CloseOnExec(fd)
+
+	return &FIFOWatcher{path: path, fd: fd}, nil
+}
+
+// Incremental reports that checks only return the data written since the
+// previous one.
+func (fw *FIFOWatcher) Incremental() bool {
+	return true
+}
+
+// Check returns all data currently buffered in the pipe.
+// When the writer disconnects, reads return EOF until a new writer
+// connects, so reconnecting producers are picked up transparently.
+func (fw *FIFOWatcher) Check() ([]byte, error) {
+	if fw.fd < 0 {
+		return nil, os.ErrClosed
+	}
+
+	buf := new(bytes.Buffer)
+	chunk := make([]byte, 32*1024)
+	for {
+		n, err := syscall.Read(fw.fd, chunk)
+		if n > 0 {
+			buf.Write(chunk[:n])
+		}
+		switch {
+		case errors.Is(err, syscall.EINTR):
+			continue
+		case errors.Is(err, syscall.EAGAIN):
+			// A writer is connected but has nothing more for us.
+			return buf.Bytes(), nil
+		case err != nil:
+			return buf.Bytes(), &os.PathError{Op: "read", Path: fw.path, Err: err}
+		case n == 0:
+			// No writer is connected.
+			return buf.Bytes(), nil
+		}
+	}
+}
+
+// Close closes the pipe.
+func (fw *FIFOWatcher) Close() error {
+	if fw.fd >= 0 {
+		err := syscall.Close(fw.fd)
+		fw.fd = -1 // Prevent double close
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+//go:build unix
+
+package watcher_test
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/gregory-chatelier/watchfor/pkg/watcher"
+)
+
+func writeFIFO(t *testing.T, path, content string) {
+	t.Helper()
+	// The watcher holds the read end open, so this does not block.
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Failed to open FIFO for writing: %v", err)
+	}
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatalf("Failed to write to FIFO: %v", err)
+	}
+	f.Close()
+}
+
+func TestFIFOWatcher_Check_Reconnect(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.fifo")
+	if err := syscall.Mkfifo(path, 0600); err != nil {
+		t.Fatalf("Mkfifo failed: %v", err)
+	}
+
+	fw, err := watcher.NewFIFOWatcher(path)
+	if err != nil {
+		t.Fatalf("NewFIFOWatcher failed: %v", err)
+	}
+	defer fw.Close()
+
+	// 1. No writer connected yet: must return immediately with no data.
+	output, err := fw.Check()
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if len(output) != 0 {
+		t.Errorf("Expected no data before a writer connects, got: %s", string(output))
+	}
+
+	// 2. First writer connects, writes and disconnects.
+	writeFIFO(t, path, "first\n")
+	output, err = fw.Check()
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if string(output) != "first\n" {
+		t.Errorf("Expected 'first\\n', got '%s'", string(output))
+	}
+
+	// 3. A new writer reconnects.
+	writeFIFO(t, path, "second\n")
+	output, err = fw.Check()
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if string(output) != "second\n" {
+		t.Errorf("Expected 'second\\n', got '%s'", string(output))
+	}
+}
+
+func TestNewFIFOWatcher_NotAPipe(t *testing.T) {
+	filePath := createTempFile(t, "")
+	defer os.Remove(filePath)
+
+	if _, err := watcher.NewFIFOWatcher(filePath); err == nil {
+		t.Error("Expected an error for a regular file, got nil")
+	}
+}
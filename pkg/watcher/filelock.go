@@ -0,0 +1,35 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/gregory-chatelier/watchfor/pkg/filelock"
+)
+
+// FileLockWatcher reports when the advisory lock on a file is free, e.g. once
+// another build releases it: flock on Unix, LockFileEx on Windows.
+type FileLockWatcher struct {
+	path string
+}
+
+// NewFileLockWatcher creates a watcher for the lock on the file at path.
+func NewFileLockWatcher(path string) *FileLockWatcher {
+	return &FileLockWatcher{path: path}
+}
+
+// Check tries to take the lock without blocking, and releases it at once. It
+// returns "unlocked" if that worked, and no output while another process holds
+// the lock. A file that does not exist yet returns ErrFileNotFound, and is not
+// created.
+func (lw *FileLockWatcher) Check() ([]byte, error) {
+	free, err := filelock.Probe(lw.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
+	}
+	if err != nil || !free {
+		return nil, err
+	}
+	return []byte("unlocked\n"), nil
+}
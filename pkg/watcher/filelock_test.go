@@ -0,0 +1,46 @@
+package watcher_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gregory-chatelier/watchfor/pkg/filelock"
+	"github.com/gregory-chatelier/watchfor/pkg/watcher"
+)
+
+func TestFileLockWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "build.lock")
+	lw := watcher.NewFileLockWatcher(path)
+
+	// A missing file is retried, and not created.
+	if _, err := lw.Check(); !errors.Is(err, watcher.ErrFileNotFound) {
+		t.Fatalf("Expected ErrFileNotFound, got %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("Expected the lock file not to be created")
+	}
+
+	held, err := filelock.TryLock(path)
+	if err != nil {
+		t.Fatalf("TryLock failed: %v", err)
+	}
+	for range 2 {
+		if output, err := lw.Check(); err != nil || len(output) != 0 {
+			t.Fatalf("Expected no output while the lock is held, got %q, %v", output, err)
+		}
+	}
+
+	held.Unlock()
+	output, err := lw.Check()
+	if err != nil || string(output) != "unlocked\n" {
+		t.Fatalf("Expected %q once released, got %q, %v", "unlocked\n", output, err)
+	}
+	// Checking does not keep the lock.
+	lock, err := filelock.TryLock(path)
+	if err != nil {
+		t.Fatalf("Expected the lock to be free after the check, got %v", err)
+	}
+	lock.Unlock()
+}
@@ -0,0 +1,70 @@
+//go:build linux
+
+package watcher
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// JournalWatcher returns the systemd journal entries logged by a unit since the
+// previous check, mimicking `journalctl -fu unit`. Only entries logged after the
+// watcher was created are returned. A unit that doesn't exist yet simply has no entries.
+type JournalWatcher struct {
+	unit       string
+	since      time.Time
+	cursorDir  string
+	cursorFile string
+}
+
+// NewJournalWatcher creates a new watcher for the journal of a systemd unit.
+// It fails if journalctl is not installed.
+func NewJournalWatcher(unit string) (*JournalWatcher, error) {
+	if _, err := exec.LookPath("journalctl"); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "watchfor-journal-")
+	if err != nil {
+		return nil, err
+	}
+	return &JournalWatcher{
+		unit:       unit,
+		since:      time.Now(),
+		cursorDir:  dir,
+		cursorFile: filepath.Join(dir, "cursor"),
+	}, nil
+}
+
+// Incremental reports that checks only return the entries logged since the
+// previous one.
+func (jw *JournalWatcher) Incremental() bool {
+	return true
+}
+
+// Check returns the entries logged since the previous check.
+func (jw *JournalWatcher) Check() ([]byte, error) {
+	// journalctl resumes after the cursor saved in the file, and saves the new one.
+	cmd := exec.Command("journalctl",
+		"--unit", jw.unit,
+		"--since", fmt.Sprintf("@%d", jw.since.Unix()),
+		"--cursor-file", jw.cursorFile,
+		"--output", "short-iso",
+		"--no-pager", "--quiet")
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil && stderr.Len() > 0 {
+		err = fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return output, err
+}
+
+// Close removes the saved cursor.
+func (jw *JournalWatcher) Close() error {
+	return os.RemoveAll(jw.cursorDir)
+}
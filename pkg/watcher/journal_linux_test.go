@@ -0,0 +1,73 @@
+//go:build linux
+
+package watcher_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gregory-chatelier/watchfor/pkg/watcher"
+)
+
+// fakeJournalctl installs a journalctl on PATH that prints the next entry of
+// entries after the saved cursor, and records its arguments.
+func fakeJournalctl(t *testing.T) (argsFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	argsFile = filepath.Join(dir, "args")
+	script := `#!/bin/sh
+echo "$@" > ` + argsFile + `
+while [ $# -gt 0 ]; do
+	[ "$1" = "--cursor-file" ] && cursor="$2"
+	shift
+done
+n=$(cat "$cursor" 2>/dev/null || echo 0)
+if [ "$n" -lt 2 ]; then
+	n=$((n + 1))
+	echo "2024-05-01T10:00:0${n}+0000 host app[1]: entry $n"
+fi
+echo "$n" > "$cursor"
+`
+	if err := os.WriteFile(filepath.Join(dir, "journalctl"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return argsFile
+}
+
+func TestJournalWatcher_Check(t *testing.T) {
+	argsFile := fakeJournalctl(t)
+
+	jw, err := watcher.NewJournalWatcher("app.service")
+	if err != nil {
+		t.Fatalf("NewJournalWatcher failed: %v", err)
+	}
+	defer jw.Close()
+
+	for i, expected := range []string{"entry 1", "entry 2", ""} {
+		output, err := jw.Check()
+		if err != nil {
+			t.Fatalf("Check %d failed: %v", i+1, err)
+		}
+		if expected == "" && len(output) != 0 {
+			t.Errorf("Check %d: expected no new entries, got '%s'", i+1, string(output))
+		}
+		if !strings.Contains(string(output), expected) {
+			t.Errorf("Check %d: expected '%s', got '%s'", i+1, expected, string(output))
+		}
+	}
+
+	args, _ := os.ReadFile(argsFile)
+	if !strings.Contains(string(args), "--unit app.service") {
+		t.Errorf("Expected journalctl to be filtered by unit, got args: %s", string(args))
+	}
+}
+
+func TestJournalWatcher_NoJournalctl(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	if _, err := watcher.NewJournalWatcher("app.service"); err == nil {
+		t.Error("Expected an error when journalctl is missing, got nil")
+	}
+}
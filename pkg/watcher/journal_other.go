@@ -0,0 +1,23 @@
+//go:build !linux
+
+package watcher
+
+import "errors"
+
+// JournalWatcher reads the systemd journal. It is only supported on Linux.
+type JournalWatcher struct{}
+
+// NewJournalWatcher always fails on this platform.
+func NewJournalWatcher(unit string) (*JournalWatcher, error) {
+	return nil, errors.New("the systemd journal is only supported on Linux")
+}
+
+// Check is never reached, as a JournalWatcher cannot be created on this platform.
+func (jw *JournalWatcher) Check() ([]byte, error) {
+	return nil, errors.New("the systemd journal is only supported on Linux")
+}
+
+// Close does nothing on this platform.
+func (jw *JournalWatcher) Close() error {
+	return nil
+}
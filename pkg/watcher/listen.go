@@ -0,0 +1,138 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxRequestBody is the most of a request body that ListenWatcher keeps.
+const maxRequestBody = 1 << 20
+
+// ListenWatcher runs an HTTP server and returns the bodies of the requests it
+// receives on a path, for services that signal readiness by calling a webhook
+// rather than being polled.
+type ListenWatcher struct {
+	server   *http.Server
+	listener net.Listener
+	c        chan struct{}
+
+	mu       sync.Mutex
+	bodies   [][]byte
+	received bool
+	last     []byte
+	closed   bool
+}
+
+// NewListenWatcher starts listening on addr, host:port, and accepts requests of
+// any method on path. Other paths get a 404. Requests are queued from the start,
+// so one sent before the first check is not missed.
+func NewListenWatcher(addr, path string) (*ListenWatcher, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	lw := &ListenWatcher{
+		listener: listener,
+		c:        make(chan struct{}, 1),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, lw.handle)
+	lw.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go lw.server.Serve(listener)
+	return lw, nil
+}
+
+func (lw *ListenWatcher) handle(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	lw.mu.Lock()
+	lw.bodies = append(lw.bodies, body)
+	lw.mu.Unlock()
+	select {
+	case lw.c <- struct{}{}:
+	default:
+		// A notification is already pending.
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Addr returns the address the server listens on, e.g. to find the port
+// picked for ":0".
+func (lw *ListenWatcher) Addr() string {
+	return lw.listener.Addr().String()
+}
+
+// C returns a channel that receives a value when a request arrives, to check
+// it right away instead of at the next interval.
+func (lw *ListenWatcher) C() <-chan struct{} {
+	return lw.c
+}
+
+// Check returns the body of the oldest request not yet returned, so that each
+// request is matched on its own. It returns nothing when there is none.
+func (lw *ListenWatcher) Check() ([]byte, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	lw.received = len(lw.bodies) > 0
+	if !lw.received {
+		lw.last = nil
+		return nil, nil
+	}
+	body := lw.bodies[0]
+	lw.last = body
+	lw.bodies = lw.bodies[1:]
+	if len(lw.bodies) > 0 {
+		// Wake the poller again for the requests still queued.
+		select {
+		case lw.c <- struct{}{}:
+		default:
+		}
+	}
+	return body, nil
+}
+
+// Received reports whether the previous check returned a request, which may
+// have had an empty body.
+func (lw *ListenWatcher) Received() bool {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.received
+}
+
+// LastBody returns the body of the request returned by the previous check, or
+// nil if there was none. Unlike the poller's last output, it may be empty.
+func (lw *ListenWatcher) LastBody() []byte {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.last
+}
+
+// Close stops the server, letting the requests in progress finish for up to a
+// second. It is safe to call more than once.
+func (lw *ListenWatcher) Close() error {
+	lw.mu.Lock()
+	closed := lw.closed
+	lw.closed = true
+	lw.mu.Unlock()
+	if closed {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := lw.server.Shutdown(ctx); errors.Is(err, context.DeadlineExceeded) {
+		return lw.server.Close()
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package watcher_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gregory-chatelier/watchfor/pkg/watcher"
+)
+
+func TestListenWatcher_FromSpec(t *testing.T) {
+	w, err := watcher.FromSpec("listen://127.0.0.1:0/hooks/ready")
+	if err != nil {
+		t.Fatalf("FromSpec failed: %v", err)
+	}
+	lw, ok := w.(*watcher.ListenWatcher)
+	if !ok {
+		t.Fatalf("Expected a ListenWatcher, got %T", w)
+	}
+	defer lw.Close()
+
+	resp, err := http.Post("http://"+lw.Addr()+"/hooks/ready", "text/plain", strings.NewReader("ready"))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if output, err := lw.Check(); err != nil || string(output) != "ready" {
+		t.Errorf("Expected %q, got %q, %v", "ready", output, err)
+	}
+
+	if w, err := watcher.FromSpec("listen://not-an-address/"); err == nil || w != nil {
+		t.Errorf("Expected an error and a nil watcher, got %v, %v", w, err)
+	}
+}
+
+func TestListenWatcher(t *testing.T) {
+	lw, err := watcher.NewListenWatcher("127.0.0.1:0", "/ready")
+	if err != nil {
+		t.Fatalf("NewListenWatcher failed: %v", err)
+	}
+	defer lw.Close()
+	url := "http://" + lw.Addr()
+
+	output, err := lw.Check()
+	if err != nil || output != nil || lw.Received() {
+		t.Fatalf("Expected no request yet, got %q, %v", output, err)
+	}
+
+	resp, err := http.Post(url+"/other", "text/plain", strings.NewReader("ignored"))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for another path, got %d", resp.StatusCode)
+	}
+
+	for _, body := range []string{`{"status":"starting"}`, `{"status":"ready"}`, ""} {
+		resp, err := http.Post(url+"/ready", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			t.Errorf("Expected 202, got %d", resp.StatusCode)
+		}
+	}
+
+	select {
+	case <-lw.C():
+	case <-time.After(time.Second):
+		t.Error("Expected a notification for the requests")
+	}
+	// Each check returns one request, in the order they arrived.
+	for _, want := range []string{`{"status":"starting"}`, `{"status":"ready"}`, ""} {
+		output, err := lw.Check()
+		if err != nil || string(output) != want || !lw.Received() || string(lw.LastBody()) != want {
+			t.Errorf("Expected %q, got %q, %v", want, output, err)
+		}
+	}
+	if output, _ := lw.Check(); output != nil || lw.Received() || lw.LastBody() != nil {
+		t.Errorf("Expected the queue to be empty, got %q", output)
+	}
+
+	if err := lw.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := http.Post(url+"/ready", "text/plain", strings.NewReader("late")); err == nil {
+		t.Error("Expected the listener to be shut down")
+	}
+}
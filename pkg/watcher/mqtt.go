@@ -0,0 +1,158 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// ErrMQTTNotConnected is returned when the broker connection dropped since
+// the previous check. The next check reconnects.
+var ErrMQTTNotConnected = errors.New("connection to the MQTT broker lost")
+
+// MQTTWatcher returns the messages published on an MQTT topic.
+type MQTTWatcher struct {
+	topic  string
+	qos    byte
+	client mqtt.Client
+
+	mu       sync.Mutex
+	messages bytes.Buffer
+	lost     error
+}
+
+// MQTTOption configures optional MQTTWatcher behavior.
+type MQTTOption func(*mqtt.ClientOptions, *MQTTWatcher)
+
+// WithMQTTQoS sets the quality of service of the subscription, 0 to 2.
+func WithMQTTQoS(qos byte) MQTTOption {
+	return func(_ *mqtt.ClientOptions, mw *MQTTWatcher) {
+		mw.qos = qos
+	}
+}
+
+// WithMQTTCredentials sets the username and password sent to the broker.
+func WithMQTTCredentials(username, password string) MQTTOption {
+	return func(o *mqtt.ClientOptions, _ *MQTTWatcher) {
+		o.SetUsername(username)
+		o.SetPassword(password)
+	}
+}
+
+// NewMQTTWatcher creates a watcher for the messages published on topic, which
+// may contain wildcards. broker is host:port or a tcp://, ssl:// or ws:// URL.
+// It connects on the first check, so only messages published from then on,
+// and the retained message of the topic, are seen.
+func NewMQTTWatcher(broker, topic string, opts ...MQTTOption) (*MQTTWatcher, error) {
+	if !strings.Contains(broker, "://") {
+		broker = "tcp://" + broker
+	}
+	if _, err := url.Parse(broker); err != nil {
+		return nil, fmt.Errorf("invalid broker address: %w", err)
+	}
+	mw := &MQTTWatcher{topic: topic}
+
+	o := mqtt.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(fmt.Sprintf("watchfor-%d-%d", os.Getpid(), time.Now().UnixNano())).
+		SetConnectTimeout(10 * time.Second).
+		// The poller retries failed checks, which reconnect.
+		SetAutoReconnect(false).
+		SetConnectionLostHandler(mw.connectionLost).
+		SetDefaultPublishHandler(mw.receive)
+	for _, opt := range opts {
+		opt(o, mw)
+	}
+	mw.client = mqtt.NewClient(o)
+	return mw, nil
+}
+
+func (mw *MQTTWatcher) receive(_ mqtt.Client, msg mqtt.Message) {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+	mw.messages.Write(msg.Payload())
+	mw.messages.WriteByte('\n')
+}
+
+func (mw *MQTTWatcher) connectionLost(_ mqtt.Client, err error) {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+	mw.lost = fmt.Errorf("%w: %w", ErrMQTTNotConnected, err)
+}
+
+// Incremental reports that checks only return the messages received since the
+// previous one.
+func (mw *MQTTWatcher) Incremental() bool {
+	return true
+}
+
+// Check returns the messages received since the previous check.
+func (mw *MQTTWatcher) Check() ([]byte, error) {
+	return mw.CheckContext(context.Background())
+}
+
+// CheckContext returns the messages received since the previous check, one
+// per line. A lost connection is reported once, then re-established by the
+// following check; messages published while disconnected are not seen.
+func (mw *MQTTWatcher) CheckContext(ctx context.Context) ([]byte, error) {
+	mw.mu.Lock()
+	lost := mw.lost
+	mw.lost = nil
+	mw.mu.Unlock()
+	if lost != nil {
+		return nil, lost
+	}
+
+	if !mw.client.IsConnectionOpen() {
+		if err := waitToken(ctx, mw.client.Connect()); err != nil {
+			return nil, err
+		}
+		if err := waitToken(ctx, mw.client.Subscribe(mw.topic, mw.qos, nil)); err != nil {
+			mw.client.Disconnect(0)
+			return nil, err
+		}
+	}
+
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+	output := bytes.Clone(mw.messages.Bytes())
+	mw.messages.Reset()
+	return output, nil
+}
+
+// waitToken waits for token to complete, or for ctx to be done.
+func waitToken(ctx context.Context, token mqtt.Token) error {
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Ping checks that the broker accepts the connection.
+func (mw *MQTTWatcher) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := waitToken(ctx, mw.client.Connect()); err != nil {
+		return err
+	}
+	mw.client.Disconnect(0)
+	return nil
+}
+
+// Close disconnects from the broker.
+func (mw *MQTTWatcher) Close() error {
+	if mw.client.IsConnected() {
+		mw.client.Disconnect(250)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package watcher_test
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	mqttserver "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+
+	"github.com/gregory-chatelier/watchfor/pkg/watcher"
+)
+
+// startBroker runs an in-process MQTT broker and returns its address. With a
+// ledger, only its users may connect. The caller closes the server.
+func startBroker(t *testing.T, ledger *auth.Ledger) (*mqttserver.Server, string) {
+	t.Helper()
+	server := mqttserver.New(&mqttserver.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	var err error
+	if ledger != nil {
+		err = server.AddHook(new(auth.Hook), &auth.Options{Ledger: ledger})
+	} else {
+		err = server.AddHook(new(auth.AllowHook), nil)
+	}
+	if err != nil {
+		t.Fatalf("AddHook failed: %v", err)
+	}
+	tcp := listeners.NewTCP(listeners.Config{ID: "tcp", Address: "127.0.0.1:0"})
+	if err := server.AddListener(tcp); err != nil {
+		t.Fatalf("AddListener failed: %v", err)
+	}
+	if err := server.Serve(); err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+	return server, tcp.Address()
+}
+
+// receiveMQTT checks until want has been received, or two seconds passed.
+func receiveMQTT(t *testing.T, mw *watcher.MQTTWatcher, want string) string {
+	t.Helper()
+	var received string
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline) && received != want; {
+		output, err := mw.Check()
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		received += string(output)
+		time.Sleep(10 * time.Millisecond)
+	}
+	return received
+}
+
+func TestMQTTWatcher_Check(t *testing.T) {
+	server, addr := startBroker(t, nil)
+	defer server.Close()
+	server.Publish("devices/gw1/status", []byte("booting"), true, 0)
+
+	mw, err := watcher.NewMQTTWatcher(addr, "devices/+/status", watcher.WithMQTTQoS(1))
+	if err != nil {
+		t.Fatalf("NewMQTTWatcher failed: %v", err)
+	}
+	defer mw.Close()
+
+	// The first check subscribes, and receives the retained message.
+	if got := receiveMQTT(t, mw, "booting\n"); got != "booting\n" {
+		t.Fatalf("Expected the retained message, got %q", got)
+	}
+
+	server.Publish("devices/gw1/status", []byte("starting"), false, 1)
+	server.Publish("devices/gw2/status", []byte("ready"), false, 1)
+	server.Publish("devices/gw2/other", []byte("ignored"), false, 1)
+	if got := receiveMQTT(t, mw, "starting\nready\n"); got != "starting\nready\n" {
+		t.Errorf("Expected both messages, got %q", got)
+	}
+}
+
+func TestMQTTWatcher_FromSpec(t *testing.T) {
+	server, addr := startBroker(t, &auth.Ledger{
+		Auth: auth.AuthRules{{Username: "watchfor", Password: "secret", Allow: true}},
+	})
+	defer server.Close()
+	server.Publish("devices/gw1/status", []byte("ready"), true, 0)
+
+	w, err := watcher.FromSpec("mqtt://watchfor:secret@" + addr + "/devices/+/status")
+	if err != nil {
+		t.Fatalf("FromSpec failed: %v", err)
+	}
+	mw, ok := w.(*watcher.MQTTWatcher)
+	if !ok {
+		t.Fatalf("Expected an MQTTWatcher, got %T", w)
+	}
+	defer mw.Close()
+	if got := receiveMQTT(t, mw, "ready\n"); got != "ready\n" {
+		t.Errorf("Expected the retained message, got %q", got)
+	}
+
+	for _, spec := range []string{"mqtt://" + addr, "mqtt://" + addr + "/", "mqtt:///status"} {
+		if w, err := watcher.FromSpec(spec); err == nil || w != nil {
+			t.Errorf("%s: expected an error and a nil watcher, got %v, %v", spec, w, err)
+		}
+	}
+}
+
+func TestMQTTWatcher_Credentials(t *testing.T) {
+	server, addr := startBroker(t, &auth.Ledger{
+		Auth: auth.AuthRules{{Username: "watchfor", Password: "secret", Allow: true}},
+	})
+	defer server.Close()
+
+	mw, err := watcher.NewMQTTWatcher(addr, "status", watcher.WithMQTTCredentials("watchfor", "wrong"))
+	if err != nil {
+		t.Fatalf("NewMQTTWatcher failed: %v", err)
+	}
+	if _, err := mw.Check(); err == nil {
+		t.Error("Expected an error for wrong credentials")
+	}
+	mw.Close()
+
+	for _, broker := range []string{addr, "tcp://watchfor:secret@" + addr} {
+		var opts []watcher.MQTTOption
+		if broker == addr {
+			opts = append(opts, watcher.WithMQTTCredentials("watchfor", "secret"))
+		}
+		mw, err := watcher.NewMQTTWatcher(broker, "status", opts...)
+		if err != nil {
+			t.Fatalf("NewMQTTWatcher failed: %v", err)
+		}
+		if _, err := mw.Check(); err != nil {
+			t.Errorf("%s: expected to connect, got %v", broker, err)
+		}
+		mw.Close()
+	}
+}
+
+func TestMQTTWatcher_ConnectionLost(t *testing.T) {
+	server, addr := startBroker(t, nil)
+	mw, err := watcher.NewMQTTWatcher(addr, "status")
+	if err != nil {
+		t.Fatalf("NewMQTTWatcher failed: %v", err)
+	}
+	defer mw.Close()
+
+	if _, err := mw.Check(); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	server.Close()
+
+	// The lost connection is reported, and reconnecting fails while the
+	// broker is down; both are errors the poller retries.
+	var lost error
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline) && !errors.Is(lost, watcher.ErrMQTTNotConnected); {
+		_, lost = mw.Check()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !errors.Is(lost, watcher.ErrMQTTNotConnected) {
+		t.Errorf("Expected ErrMQTTNotConnected, got %v", lost)
+	}
+	if _, err := mw.Check(); err == nil {
+		t.Error("Expected an error while the broker is down")
+	}
+}
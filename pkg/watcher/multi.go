@@ -0,0 +1,87 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// MultiCommandWatcher runs several commands on each check and combines their output.
+type MultiCommandWatcher struct {
+	watchers []*CommandWatcher
+	parallel int
+	order    []int
+}
+
+// NewMultiCommandWatcher creates a watcher for a list of shell commands, running
+// at most parallel of them at a time. The options apply to every command, so a
+// WithStderr writer must be safe for concurrent use.
+func NewMultiCommandWatcher(commands []string, parallel int, opts ...CommandOption) *MultiCommandWatcher {
+	mw := &MultiCommandWatcher{parallel: max(parallel, 1)}
+	for i, cmd := range commands {
+		mw.watchers = append(mw.watchers, NewCommandWatcher(cmd, opts...))
+		mw.order = append(mw.order, i)
+	}
+	return mw
+}
+
+// Check runs every command and returns their outputs in the order the commands
+// were given, each ending with a newline. A failing command does not stop the
+// others: its output is still included, and the failures are returned joined together.
+func (mw *MultiCommandWatcher) Check() ([]byte, error) {
+	return mw.CheckContext(context.Background())
+}
+
+// CheckContext is like Check, but kills the commands still running when ctx is done.
+func (mw *MultiCommandWatcher) CheckContext(ctx context.Context) ([]byte, error) {
+	outputs := make([][]byte, len(mw.watchers))
+	errs := make([]error, len(mw.watchers))
+
+	// The commands start in order, each as soon as one of the parallel slots
+	// is free.
+	sem := make(chan struct{}, mw.parallel)
+	var wg sync.WaitGroup
+	for _, i := range mw.order {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			outputs[i], errs[i] = mw.watchers[i].CheckContext(ctx)
+		}()
+	}
+	wg.Wait()
+
+	var combined bytes.Buffer
+	var failures []error
+	for i, output := range outputs {
+		combined.Write(output)
+		if len(output) > 0 && output[len(output)-1] != '\n' {
+			combined.WriteByte('\n')
+		}
+		if errs[i] != nil {
+			failures = append(failures, fmt.Errorf("%s: %w", mw.watchers[i].command, errs[i]))
+		}
+	}
+	return combined.Bytes(), errors.Join(failures...)
+}
+
+// Shuffle changes the order in which the following checks start the commands,
+// which matters when they do not all run at once. Their outputs are still
+// combined in the order the commands were given.
+func (mw *MultiCommandWatcher) Shuffle(shuffle func(n int, swap func(i, j int))) {
+	shuffle(len(mw.order), func(i, j int) {
+		mw.order[i], mw.order[j] = mw.order[j], mw.order[i]
+	})
+}
+
+// Close kills the commands of a check still in progress.
+func (mw *MultiCommandWatcher) Close() error {
+	var errs []error
+	for _, w := range mw.watchers {
+		errs = append(errs, w.Close())
+	}
+	return errors.Join(errs...)
+}
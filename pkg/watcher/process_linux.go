@@ -0,0 +1,135 @@
+//go:build linux
+
+package watcher
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is the unit of the CPU times in /proc, USER_HZ, which is 100 on
+// every mainstream Linux platform.
+const clockTicks = 100
+
+// cpuSampleWindow is how long the first check measures CPU usage over, as there
+// is no previous check to compare with.
+const cpuSampleWindow = 250 * time.Millisecond
+
+// ProcessWatcher reports the CPU and memory usage of a running process, read from /proc.
+type ProcessWatcher struct {
+	pid      int
+	cpuBelow float64
+	memBelow int64
+
+	lastTicks int64
+	lastTime  time.Time
+}
+
+// NewProcessWatcher creates a watcher for the process with the given PID. If
+// cpuBelow or memBelow are positive, CPU usage (in percent of one core) and
+// resident memory (in bytes) at or above them are reported as errors.
+func NewProcessWatcher(pid int, cpuBelow float64, memBelow int64) (*ProcessWatcher, error) {
+	pw := &ProcessWatcher{pid: pid, cpuBelow: cpuBelow, memBelow: memBelow}
+	if _, err := pw.cpuTicks(); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// Check returns the process usage, one value per line: pid, cpu (percent of one
+// core since the previous check), rss (bytes) and rssMiB. Once the process has
+// exited, it returns ErrProcessExited.
+func (pw *ProcessWatcher) Check() ([]byte, error) {
+	if pw.lastTime.IsZero() {
+		ticks, err := pw.cpuTicks()
+		if err != nil {
+			return nil, err
+		}
+		pw.lastTicks, pw.lastTime = ticks, time.Now()
+		time.Sleep(cpuSampleWindow)
+	}
+
+	ticks, err := pw.cpuTicks()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	cpu := float64(ticks-pw.lastTicks) / clockTicks / now.Sub(pw.lastTime).Seconds() * 100
+	pw.lastTicks, pw.lastTime = ticks, now
+
+	rss, err := pw.rss()
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "pid: %d\n", pw.pid)
+	fmt.Fprintf(buf, "cpu: %.1f\n", cpu)
+	fmt.Fprintf(buf, "rss: %d\n", rss)
+	fmt.Fprintf(buf, "rssMiB: %d\n", rss>>20)
+
+	// Withhold the values so the pattern cannot match a busy process.
+	if pw.cpuBelow > 0 && cpu >= pw.cpuBelow {
+		return nil, fmt.Errorf("cpu at %.1f%%, not below %g%%", cpu, pw.cpuBelow)
+	}
+	if pw.memBelow > 0 && rss >= pw.memBelow {
+		return nil, fmt.Errorf("rss at %d MiB, not below %d MiB", rss>>20, pw.memBelow>>20)
+	}
+	return buf.Bytes(), nil
+}
+
+// cpuTicks returns the CPU time used by the process so far, in clock ticks.
+func (pw *ProcessWatcher) cpuTicks() (int64, error) {
+	stat, err := pw.read("stat")
+	if err != nil {
+		return 0, err
+	}
+	// The command name in parentheses may contain spaces, so the fields are counted
+	// from its end: state, then 10 more fields before utime and stime.
+	fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+	if len(fields) < 13 {
+		return 0, fmt.Errorf("unexpected format of /proc/%d/stat", pw.pid)
+	}
+	if fields[0] == "Z" || fields[0] == "X" {
+		return 0, fmt.Errorf("%w: pid %d", ErrProcessExited, pw.pid)
+	}
+	utime, err := strconv.ParseInt(fields[11], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	stime, err := strconv.ParseInt(fields[12], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return utime + stime, nil
+}
+
+// rss returns the resident memory of the process, in bytes.
+func (pw *ProcessWatcher) rss() (int64, error) {
+	statm, err := pw.read("statm")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(statm)
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("unexpected format of /proc/%d/statm", pw.pid)
+	}
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return pages * int64(os.Getpagesize()), nil
+}
+
+func (pw *ProcessWatcher) read(name string) (string, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/%s", pw.pid, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%w: pid %d", ErrProcessExited, pw.pid)
+	}
+	return string(data), err
+}
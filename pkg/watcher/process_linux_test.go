@@ -0,0 +1,68 @@
+//go:build linux
+
+package watcher_test
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/gregory-chatelier/watchfor/pkg/watcher"
+)
+
+func TestProcessWatcher_Check(t *testing.T) {
+	pw, err := watcher.NewProcessWatcher(os.Getpid(), 0, 0)
+	if err != nil {
+		t.Fatalf("NewProcessWatcher failed: %v", err)
+	}
+	output, err := pw.Check()
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	for _, want := range []string{"pid: ", "cpu: ", "rss: ", "rssMiB: "} {
+		if !strings.Contains(string(output), want) {
+			t.Errorf("Expected the output to contain %q, got %q", want, output)
+		}
+	}
+}
+
+func TestProcessWatcher_Thresholds(t *testing.T) {
+	// The test binary uses far more than a byte of memory, and a sleeping process
+	// far less than 1000% of a core.
+	pw, _ := watcher.NewProcessWatcher(os.Getpid(), 0, 1)
+	if output, err := pw.Check(); err == nil || output != nil {
+		t.Errorf("Expected an error and no output above the memory threshold, got %q, %v", output, err)
+	}
+
+	cmd := exec.Command("sleep", "5")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start sleep: %v", err)
+	}
+	defer cmd.Process.Kill()
+	pw, _ = watcher.NewProcessWatcher(cmd.Process.Pid, 1000, 0)
+	if _, err := pw.Check(); err != nil {
+		t.Errorf("Expected a sleeping process to be below the CPU threshold, got %v", err)
+	}
+}
+
+func TestProcessWatcher_Exited(t *testing.T) {
+	cmd := exec.Command("sleep", "5")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start sleep: %v", err)
+	}
+	pw, err := watcher.NewProcessWatcher(cmd.Process.Pid, 0, 0)
+	if err != nil {
+		t.Fatalf("NewProcessWatcher failed: %v", err)
+	}
+	cmd.Process.Kill()
+	cmd.Wait()
+
+	if _, err := pw.Check(); !errors.Is(err, watcher.ErrProcessExited) {
+		t.Errorf("Expected ErrProcessExited, got %v", err)
+	}
+	if _, err := watcher.NewProcessWatcher(cmd.Process.Pid, 0, 0); !errors.Is(err, watcher.ErrProcessExited) {
+		t.Errorf("Expected ErrProcessExited for a process that is gone, got %v", err)
+	}
+}
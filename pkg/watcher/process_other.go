@@ -0,0 +1,18 @@
+//go:build !linux
+
+package watcher
+
+import "errors"
+
+// ProcessWatcher reports the resource usage of a process. It is only supported on Linux.
+type ProcessWatcher struct{}
+
+// NewProcessWatcher always fails on this platform.
+func NewProcessWatcher(pid int, cpuBelow float64, memBelow int64) (*ProcessWatcher, error) {
+	return nil, errors.New("watching a process is only supported on Linux")
+}
+
+// Check is never reached, as a ProcessWatcher cannot be created on this platform.
+func (pw *ProcessWatcher) Check() ([]byte, error) {
+	return nil, errors.New("watching a process is only supported on Linux")
+}
@@ -0,0 +1,36 @@
+//go:build !unix
+
+package watcher
+
+import (
+	"context"
+	"errors"
+)
+
+// PTYWatcher runs a command under a pseudo-terminal. It is only supported on Unix-like systems.
+type PTYWatcher struct{}
+
+// NewPTYWatcher always fails on this platform.
+func NewPTYWatcher(cmd string) (*PTYWatcher, error) {
+	return nil, errors.New("pseudo-terminals are only supported on Unix-like systems")
+}
+
+// Check is never reached, as a PTYWatcher cannot be created on this platform.
+func (pw *PTYWatcher) Check() ([]byte, error) {
+	return nil, errors.New("pseudo-terminals are only supported on Unix-like systems")
+}
+
+// CheckContext is never reached, as a PTYWatcher cannot be created on this platform.
+func (pw *PTYWatcher) CheckContext(ctx context.Context) ([]byte, error) {
+	return pw.Check()
+}
+
+// Close does nothing on this platform.
+func (pw *PTYWatcher) Close() error {
+	return nil
+}
+
+// ExitCode always returns -1 on this platform.
+func (pw *PTYWatcher) ExitCode() int {
+	return -1
+}
@@ -0,0 +1,96 @@
+//go:build unix
+
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"syscall"
+
+	"github.com/creack/pty"
+
+	"github.com/gregory-chatelier/watchfor/pkg/proctree"
+)
+
+// PTYWatcher runs a command attached to a pseudo-terminal and captures what it
+// writes to it. Programs that only print progress or readiness messages when
+// they detect a terminal behave as they would in an interactive shell.
+//
+// The terminal translates line endings, so the output uses "\r\n".
+type PTYWatcher struct {
+	command  string
+	exitCode int
+
+	mu      sync.Mutex
+	running *exec.Cmd
+}
+
+// NewPTYWatcher creates a new watcher for a shell command run under a pseudo-terminal.
+func NewPTYWatcher(cmd string) (*PTYWatcher, error) {
+	return &PTYWatcher{command: cmd}, nil
+}
+
+// Check executes the command and returns everything it wrote to the terminal.
+func (pw *PTYWatcher) Check() ([]byte, error) {
+	return pw.CheckContext(context.Background())
+}
+
+// CheckContext executes the command and returns everything it wrote to the
+// terminal. When ctx is done, the command is killed along with any process it
+// started.
+func (pw *PTYWatcher) CheckContext(ctx context.Context) ([]byte, error) {
+	pw.exitCode = -1
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", pw.command)
+	// pty.Start runs the command in a new session, of which it leads the only
+	// process group.
+	proctree.ConfigureLeader(cmd)
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCommandStartFailed, err)
+	}
+	defer ptmx.Close()
+	pw.setRunning(cmd)
+	defer pw.setRunning(nil)
+
+	var output bytes.Buffer
+	// Once the command and its children close the terminal, reads fail with EIO
+	// rather than returning EOF.
+	if _, err := io.Copy(&output, ptmx); err != nil && !errors.Is(err, syscall.EIO) {
+		cmd.Wait()
+		return output.Bytes(), err
+	}
+
+	err = cmd.Wait()
+	if cmd.ProcessState != nil {
+		pw.exitCode = cmd.ProcessState.ExitCode()
+	}
+	return output.Bytes(), err
+}
+
+// ExitCode returns the exit code of the command run by the last check.
+func (pw *PTYWatcher) ExitCode() int {
+	return pw.exitCode
+}
+
+func (pw *PTYWatcher) setRunning(cmd *exec.Cmd) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	pw.running = cmd
+}
+
+// Close kills the command of a check still in progress, along with any process
+// it started, so that nothing is left behind when watchfor exits.
+func (pw *PTYWatcher) Close() error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if pw.running == nil {
+		return nil
+	}
+	return proctree.Kill(pw.running)
+}
@@ -0,0 +1,77 @@
+//go:build unix
+
+package watcher_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gregory-chatelier/watchfor/pkg/watcher"
+)
+
+func TestPTYWatcher_Check(t *testing.T) {
+	pw, err := watcher.NewPTYWatcher(`if [ -t 1 ]; then echo "tty ready"; else echo "pipe"; fi; exit 3`)
+	if err != nil {
+		t.Fatalf("NewPTYWatcher failed: %v", err)
+	}
+
+	output, err := pw.Check()
+	if err == nil {
+		t.Errorf("Expected an error for the non-zero exit code")
+	}
+	if !strings.Contains(string(output), "tty ready") {
+		t.Errorf("Expected the command to detect a terminal, got '%s'", string(output))
+	}
+	if pw.ExitCode() != 3 {
+		t.Errorf("Expected exit code 3, got %d", pw.ExitCode())
+	}
+}
+
+func TestPTYWatcher_CheckContext_KillsProcessTree(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	pw, err := watcher.NewPTYWatcher("echo started; (sleep 10; echo late) & wait")
+	if err != nil {
+		t.Fatalf("NewPTYWatcher failed: %v", err)
+	}
+	start := time.Now()
+	output, err := pw.CheckContext(ctx)
+	if err == nil {
+		t.Fatal("Expected an error from the cancelled command")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the check to stop promptly, took %s", elapsed)
+	}
+	if string(output) != "started\r\n" {
+		t.Errorf("Expected the output written before the cancellation, got %q", output)
+	}
+}
+
+func TestPTYWatcher_Close_KillsRunningCheck(t *testing.T) {
+	pw, err := watcher.NewPTYWatcher("sleep 10 & wait")
+	if err != nil {
+		t.Fatalf("NewPTYWatcher failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := pw.Check()
+		done <- err
+	}()
+
+	// Give the command time to start, then close the watcher.
+	time.Sleep(100 * time.Millisecond)
+	if err := pw.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Expected an error from the killed command")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected Close to kill the running check")
+	}
+}
@@ -0,0 +1,136 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisWatcher reads a Redis key, or the messages published on a channel.
+type RedisWatcher struct {
+	client  *redis.Client
+	key     string
+	channel string
+
+	mu     sync.Mutex
+	pubsub *redis.PubSub
+}
+
+// NewRedisWatcher creates a watcher for the value of key. addr is either
+// host:port or a redis:// URL, which may carry a password and a database.
+func NewRedisWatcher(addr, key string) (*RedisWatcher, error) {
+	client, err := newRedisClient(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisWatcher{client: client, key: key}, nil
+}
+
+// NewRedisChannelWatcher creates a watcher for the messages published on
+// channel. It subscribes on the first check, so only messages published from
+// then on are seen.
+func NewRedisChannelWatcher(addr, channel string) (*RedisWatcher, error) {
+	client, err := newRedisClient(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisWatcher{client: client, channel: channel}, nil
+}
+
+// Incremental reports whether checks return new messages only, as they do for
+// a channel, rather than the whole value of a key.
+func (rw *RedisWatcher) Incremental() bool {
+	return rw.channel != ""
+}
+
+// quietRedis silences the client's own logging, as errors are returned anyway.
+var quietRedis sync.Once
+
+type discardLogger struct{}
+
+func (discardLogger) Printf(context.Context, string, ...any) {}
+
+func newRedisClient(addr string) (*redis.Client, error) {
+	quietRedis.Do(func() { redis.SetLogger(discardLogger{}) })
+
+	opts := &redis.Options{Addr: addr}
+	if strings.Contains(addr, "://") {
+		var err error
+		if opts, err = redis.ParseURL(addr); err != nil {
+			return nil, err
+		}
+	}
+	// The poller retries failed checks itself.
+	opts.MaxRetries = -1
+	opts.DialerRetries = 1
+	return redis.NewClient(opts), nil
+}
+
+// Check reads the key or channel once.
+func (rw *RedisWatcher) Check() ([]byte, error) {
+	return rw.CheckContext(context.Background())
+}
+
+// CheckContext returns the value of the key, or nothing while it is not set.
+// For a channel, it returns the messages received since the previous check,
+// one per line. Connection errors are returned as-is so they can be retried.
+func (rw *RedisWatcher) CheckContext(ctx context.Context) ([]byte, error) {
+	if rw.channel != "" {
+		return rw.receive(ctx)
+	}
+	value, err := rw.client.Get(ctx, rw.key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return value, err
+}
+
+func (rw *RedisWatcher) receive(ctx context.Context) ([]byte, error) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if rw.pubsub == nil {
+		pubsub := rw.client.Subscribe(ctx, rw.channel)
+		// Wait for the confirmation, so that connection errors are reported.
+		if _, err := pubsub.Receive(ctx); err != nil {
+			pubsub.Close()
+			return nil, err
+		}
+		rw.pubsub = pubsub
+	}
+
+	// Messages are buffered between checks, and the connection is
+	// re-established by the client if it drops.
+	var buf bytes.Buffer
+	messages := rw.pubsub.Channel()
+	for {
+		select {
+		case msg := <-messages:
+			buf.WriteString(msg.Payload)
+			buf.WriteByte('\n')
+		default:
+			return buf.Bytes(), nil
+		}
+	}
+}
+
+// Ping checks that the server can be reached.
+func (rw *RedisWatcher) Ping() error {
+	return rw.client.Ping(context.Background()).Err()
+}
+
+// Close unsubscribes and closes the connection.
+func (rw *RedisWatcher) Close() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if rw.pubsub != nil {
+		rw.pubsub.Close()
+		rw.pubsub = nil
+	}
+	return rw.client.Close()
+}
@@ -0,0 +1,144 @@
+package watcher_test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/gregory-chatelier/watchfor/pkg/watcher"
+)
+
+func TestRedisWatcher_Key(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rw, err := watcher.NewRedisWatcher(mr.Addr(), "app:status")
+	if err != nil {
+		t.Fatalf("NewRedisWatcher failed: %v", err)
+	}
+	defer rw.Close()
+
+	output, err := rw.Check()
+	if err != nil || len(output) != 0 {
+		t.Fatalf("Expected no output for a missing key, got %q, %v", output, err)
+	}
+
+	mr.Set("app:status", "ready")
+	output, err = rw.Check()
+	if err != nil || string(output) != "ready" {
+		t.Errorf("Expected %q, got %q, %v", "ready", output, err)
+	}
+}
+
+func TestRedisWatcher_FromSpec(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.RequireAuth("secret")
+	mr.Select(2)
+	mr.Set("app:status", "ready")
+
+	w, err := watcher.FromSpec("redis://:secret@" + mr.Addr() + "/2?key=app:status")
+	if err != nil {
+		t.Fatalf("FromSpec failed: %v", err)
+	}
+	defer w.(io.Closer).Close()
+	output, err := w.Check()
+	if err != nil || string(output) != "ready" {
+		t.Errorf("Expected %q, got %q, %v", "ready", output, err)
+	}
+
+	w, err = watcher.FromSpec("redis://" + mr.Addr() + "?channel=deploys")
+	if err != nil {
+		t.Fatalf("FromSpec failed: %v", err)
+	}
+	defer w.(io.Closer).Close()
+	if inc, ok := w.(watcher.Incremental); !ok || !inc.Incremental() {
+		t.Errorf("Expected a channel watcher, got %T", w)
+	}
+
+	for _, spec := range []string{"redis://" + mr.Addr(), "redis://" + mr.Addr() + "?key=a&channel=b"} {
+		if w, err := watcher.FromSpec(spec); err == nil || w != nil {
+			t.Errorf("%s: expected an error and a nil watcher, got %v, %v", spec, w, err)
+		}
+	}
+}
+
+func TestRedisWatcher_URL(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.RequireAuth("secret")
+	mr.Select(2)
+	mr.Set("app:status", "ready")
+
+	rw, err := watcher.NewRedisWatcher("redis://:secret@"+mr.Addr()+"/2", "app:status")
+	if err != nil {
+		t.Fatalf("NewRedisWatcher failed: %v", err)
+	}
+	defer rw.Close()
+
+	output, err := rw.Check()
+	if err != nil || string(output) != "ready" {
+		t.Errorf("Expected %q, got %q, %v", "ready", output, err)
+	}
+
+	if _, err := watcher.NewRedisWatcher("http://"+mr.Addr(), "key"); err == nil {
+		t.Error("Expected an error for an invalid URL")
+	}
+}
+
+func TestRedisWatcher_Channel(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rw, err := watcher.NewRedisChannelWatcher(mr.Addr(), "deploys")
+	if err != nil {
+		t.Fatalf("NewRedisChannelWatcher failed: %v", err)
+	}
+	defer rw.Close()
+
+	// The first check subscribes; nothing has been published yet.
+	output, err := rw.Check()
+	if err != nil || len(output) != 0 {
+		t.Fatalf("Expected no output before publishing, got %q, %v", output, err)
+	}
+
+	mr.Publish("deploys", "started")
+	mr.Publish("deploys", "finished")
+	var received string
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline) && received != "started\nfinished\n"; {
+		output, err := rw.Check()
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		received += string(output)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if received != "started\nfinished\n" {
+		t.Errorf("Expected both messages, got %q", received)
+	}
+}
+
+func TestRedisWatcher_ConnectionError(t *testing.T) {
+	mr := miniredis.RunT(t)
+	addr := mr.Addr()
+	mr.Close()
+
+	for _, channel := range []bool{false, true} {
+		var rw *watcher.RedisWatcher
+		var err error
+		if channel {
+			rw, err = watcher.NewRedisChannelWatcher(addr, "deploys")
+		} else {
+			rw, err = watcher.NewRedisWatcher(addr, "app:status")
+		}
+		if err != nil {
+			t.Fatalf("Constructor failed: %v", err)
+		}
+
+		// A server that is down is a network error, which the poller retries.
+		_, err = rw.Check()
+		var netErr net.Error
+		if !errors.As(err, &netErr) {
+			t.Errorf("channel=%v: expected a network error, got %v", channel, err)
+		}
+		rw.Close()
+	}
+}
@@ -0,0 +1,63 @@
+package watcher
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Factory creates a watcher from the part of a source spec after "name://".
+type Factory func(spec string) (Watcher, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a watcher available to FromSpec under the given scheme name,
+// e.g. "nats" for "nats://host/subject". It is meant to be called from an init
+// function, and panics if the name is empty or already registered.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if name == "" || factory == nil {
+		panic("watcher: Register called with an empty name or a nil factory")
+	}
+	if _, dup := registry[name]; dup {
+		panic("watcher: Register called twice for " + name)
+	}
+	registry[name] = factory
+}
+
+// Schemes returns the registered scheme names, sorted.
+func Schemes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// FromSpec creates a watcher from a source spec of the form "name://spec", using
+// the factory registered under name.
+func FromSpec(spec string) (Watcher, error) {
+	name, rest, ok := strings.Cut(spec, "://")
+	if !ok {
+		return nil, fmt.Errorf("invalid source %q, expected scheme://spec", spec)
+	}
+
+	registryMu.RLock()
+	factory := registry[name]
+	registryMu.RUnlock()
+
+	if factory == nil {
+		return nil, fmt.Errorf("unknown source scheme %q, expected one of %s", name, strings.Join(Schemes(), ", "))
+	}
+	return factory(rest)
+}
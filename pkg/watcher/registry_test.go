@@ -0,0 +1,75 @@
+package watcher_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gregory-chatelier/watchfor/pkg/watcher"
+)
+
+// echoWatcher returns its spec as the output.
+type echoWatcher struct {
+	spec string
+}
+
+func (ew echoWatcher) Check() ([]byte, error) {
+	return []byte(ew.spec), nil
+}
+
+func init() {
+	watcher.Register("echo", func(spec string) (watcher.Watcher, error) {
+		return echoWatcher{spec: spec}, nil
+	})
+}
+
+func TestFromSpec_Registered(t *testing.T) {
+	w, err := watcher.FromSpec("echo://hello world")
+	if err != nil {
+		t.Fatalf("FromSpec failed: %v", err)
+	}
+	output, _ := w.Check()
+	if string(output) != "hello world" {
+		t.Errorf("Expected the registered watcher to get the spec, got %q", output)
+	}
+	if !slices.Contains(watcher.Schemes(), "echo") {
+		t.Errorf("Expected echo among the schemes, got %v", watcher.Schemes())
+	}
+}
+
+func TestFromSpec_Builtin(t *testing.T) {
+	w, err := watcher.FromSpec("cmd://echo built-in")
+	if err != nil {
+		t.Fatalf("FromSpec failed: %v", err)
+	}
+	if _, ok := w.(*watcher.CommandWatcher); !ok {
+		t.Errorf("Expected a CommandWatcher, got %T", w)
+	}
+
+	// A failing constructor must not return a non-nil watcher.
+	w, err = watcher.FromSpec("file://does-not-exist.log")
+	if err == nil || w != nil {
+		t.Errorf("Expected an error and a nil watcher, got %v, %v", w, err)
+	}
+}
+
+func TestFromSpec_Invalid(t *testing.T) {
+	for _, spec := range []string{"nope://x", "no-scheme"} {
+		if _, err := watcher.FromSpec(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+	_, err := watcher.FromSpec("nope://x")
+	if !strings.Contains(err.Error(), "cmd") {
+		t.Errorf("Expected the error to list the known schemes, got %v", err)
+	}
+}
+
+func TestRegister_Duplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering a name twice to panic")
+		}
+	}()
+	watcher.Register("cmd", func(string) (watcher.Watcher, error) { return nil, nil })
+}
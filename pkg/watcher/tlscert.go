@@ -0,0 +1,83 @@
+package watcher
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// TLSCertWatcher connects to a TLS endpoint and reports its certificate.
+type TLSCertWatcher struct {
+	addr        string
+	minDaysLeft int
+	dialer      *net.Dialer
+}
+
+// NewTLSCertWatcher creates a watcher for the certificate served at host:port.
+// If minDaysLeft is positive, certificates expiring sooner are reported as errors.
+func NewTLSCertWatcher(addr string, minDaysLeft int) *TLSCertWatcher {
+	return &TLSCertWatcher{
+		addr:        addr,
+		minDaysLeft: minDaysLeft,
+		dialer:      &net.Dialer{Timeout: 10 * time.Second},
+	}
+}
+
+// Check fetches the peer certificate and returns its details, one per line:
+// subject, issuer, serial, notBefore, notAfter, daysLeft, dnsNames and verified.
+// Connection errors are returned as-is so they can be retried.
+func (tw *TLSCertWatcher) Check() ([]byte, error) {
+	host, _, err := net.SplitHostPort(tw.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verification is done below, so that an untrusted certificate can still be
+	// inspected and its status reported instead of failing the handshake.
+	conn, err := tls.DialWithDialer(tw.dialer, "tcp", tw.addr, &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%s presented no certificate", tw.addr)
+	}
+	leaf := certs[0]
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	verified := "true"
+	if _, err := leaf.Verify(x509.VerifyOptions{DNSName: host, Intermediates: intermediates}); err != nil {
+		verified = fmt.Sprintf("false (%v)", err)
+	}
+
+	daysLeft := int(time.Until(leaf.NotAfter).Hours() / 24)
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "subject: %s\n", leaf.Subject)
+	fmt.Fprintf(buf, "issuer: %s\n", leaf.Issuer)
+	fmt.Fprintf(buf, "serial: %x\n", leaf.SerialNumber)
+	fmt.Fprintf(buf, "notBefore: %s\n", leaf.NotBefore.UTC().Format(time.RFC3339))
+	fmt.Fprintf(buf, "notAfter: %s\n", leaf.NotAfter.UTC().Format(time.RFC3339))
+	fmt.Fprintf(buf, "daysLeft: %d\n", daysLeft)
+	fmt.Fprintf(buf, "dnsNames: %s\n", strings.Join(leaf.DNSNames, ", "))
+	fmt.Fprintf(buf, "verified: %s\n", verified)
+
+	if tw.minDaysLeft > 0 && daysLeft < tw.minDaysLeft {
+		// Withhold the details so the pattern cannot match an expiring certificate.
+		return nil, fmt.Errorf("certificate expires in %d days, fewer than the required %d", daysLeft, tw.minDaysLeft)
+	}
+
+	return buf.Bytes(), nil
+}
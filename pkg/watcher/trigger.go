@@ -0,0 +1,82 @@
+package watcher
+
+import (
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Trigger signals when a file is created, written, renamed or removed.
+// It watches the parent directory so that files replaced by editors or
+// created after startup are still picked up.
+type Trigger struct {
+	fsw  *fsnotify.Watcher
+	path string
+	c    chan struct{}
+	done chan struct{}
+}
+
+// NewTrigger starts watching the given file path for changes.
+func NewTrigger(path string) (*Trigger, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		fsw.Close()
+		return nil, err
+	}
+
+	if err := fsw.Add(filepath.Dir(absPath)); err != nil {
+		fsw.Close()
+		return nil, err
+	}
+
+	t := &Trigger{
+		fsw:  fsw,
+		path: absPath,
+		c:    make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	go t.loop()
+	return t, nil
+}
+
+// C returns a channel that receives a value after each change to the file.
+// Bursts of events are coalesced into a single notification.
+func (t *Trigger) C() <-chan struct{} {
+	return t.c
+}
+
+func (t *Trigger) loop() {
+	defer close(t.done)
+	for {
+		select {
+		case event, ok := <-t.fsw.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) != t.path {
+				continue
+			}
+			select {
+			case t.c <- struct{}{}:
+			default:
+				// A notification is already pending.
+			}
+		case _, ok := <-t.fsw.Errors:
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+// Close stops watching the file.
+func (t *Trigger) Close() error {
+	err := t.fsw.Close()
+	<-t.done
+	return err
+}
@@ -2,10 +2,17 @@ package watcher
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"runtime"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/gregory-chatelier/watchfor/pkg/proctree"
 )
 
 // Watcher defines the interface for checking a source for a pattern.
@@ -14,21 +21,86 @@ type Watcher interface {
 	Check() ([]byte, error)
 }
 
+// ContextWatcher is implemented by watchers whose checks can be cancelled.
+type ContextWatcher interface {
+	// CheckContext is like Check, but gives up when ctx is done.
+	CheckContext(ctx context.Context) ([]byte, error)
+}
+
+// ExitCoder is implemented by watchers that run a process, to report the
+// exit code of the most recent check.
+type ExitCoder interface {
+	// ExitCode returns the exit code of the last check, or -1 if the
+	// process could not be started or was terminated by a signal.
+	ExitCode() int
+}
+
+// Shuffler is implemented by watchers that combine several sources, to vary
+// the order in which they are checked.
+type Shuffler interface {
+	// Shuffle reorders the sources for the following checks, calling shuffle
+	// like rand.Shuffle.
+	Shuffle(shuffle func(n int, swap func(i, j int)))
+}
+
+// Incremental is implemented by watchers whose checks return only the content
+// that is new since the previous check, such as the lines appended to a file.
+type Incremental interface {
+	// Incremental reports whether checks return new content only.
+	Incremental() bool
+}
+
 // --- Command Watcher ---
 
 // CommandWatcher runs a command and captures its output.
 type CommandWatcher struct {
-	command string
+	command   string
+	stdinFile string
+	stderr    io.Writer
+	exitCode  int
+
+	mu      sync.Mutex
+	running *exec.Cmd
+}
+
+// CommandOption configures optional CommandWatcher behavior.
+type CommandOption func(*CommandWatcher)
+
+// WithStdinFile feeds the content of the file at path to the command's
+// standard input. The file is opened anew for every check, so each one reads
+// all of it, as it is at that time.
+func WithStdinFile(path string) CommandOption {
+	return func(cw *CommandWatcher) {
+		cw.stdinFile = path
+	}
+}
+
+// WithStderr sends the command's standard error to w, e.g. io.Discard, instead
+// of capturing it with the output, so that only standard output is matched
+// and a warning on stderr cannot cause a false match.
+func WithStderr(w io.Writer) CommandOption {
+	return func(cw *CommandWatcher) {
+		cw.stderr = w
+	}
 }
 
 // NewCommandWatcher creates a new watcher for a shell command.
-func NewCommandWatcher(cmd string) *CommandWatcher {
-	return &CommandWatcher{command: cmd}
+func NewCommandWatcher(cmd string, opts ...CommandOption) *CommandWatcher {
+	cw := &CommandWatcher{command: cmd}
+	for _, opt := range opts {
+		opt(cw)
+	}
+	return cw
 }
 
 // Check executes the command and returns its standard output.
 func (cw *CommandWatcher) Check() ([]byte, error) {
-	var cmd *exec.Cmd
+	return cw.CheckContext(context.Background())
+}
+
+// CheckContext executes the command and returns its standard output. When ctx is
+// done, the command is killed along with any process it started.
+func (cw *CommandWatcher) CheckContext(ctx context.Context) ([]byte, error) {
 	var shell, flag string
 
 	if runtime.GOOS == "windows" {
@@ -39,28 +111,97 @@ func (cw *CommandWatcher) Check() ([]byte, error) {
 		flag = "-c"
 	}
 
-	cmd = exec.Command(shell, flag, cw.command)
+	cmd := exec.CommandContext(ctx, shell, flag, cw.command)
+	proctree.Configure(cmd)
+
+	// Capture both stdout and stderr for pattern matching, unless WithStderr
+	// sends stderr elsewhere.
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	if cw.stderr != nil {
+		cmd.Stderr = cw.stderr
+	}
+	if cw.stdinFile != "" {
+		f, err := os.Open(cw.stdinFile)
+		if err != nil {
+			cw.exitCode = -1
+			return nil, fmt.Errorf("%w: %w", ErrCommandStartFailed, err)
+		}
+		defer f.Close()
+		cmd.Stdin = f
+	}
+	err := cmd.Start()
+	if err == nil {
+		cw.setRunning(cmd)
+		err = cmd.Wait()
+		cw.setRunning(nil)
+	}
+	output := buf.Bytes()
 
-	// Use CombinedOutput to capture both stdout and stderr for pattern matching
-	output, err := cmd.CombinedOutput()
+	cw.exitCode = -1
+	if cmd.ProcessState != nil {
+		cw.exitCode = cmd.ProcessState.ExitCode()
+	} else if err != nil {
+		err = fmt.Errorf("%w: %w", ErrCommandStartFailed, err)
+	}
 
 	// Return the output and the error (if any).
 	// The poller will decide whether to treat a non-zero exit code as a failure.
 	return output, err
 }
 
+// ExitCode returns the exit code of the command run by the last check.
+func (cw *CommandWatcher) ExitCode() int {
+	return cw.exitCode
+}
+
+func (cw *CommandWatcher) setRunning(cmd *exec.Cmd) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	cw.running = cmd
+}
+
+// Close kills the command of a check still in progress, along with any process
+// it started, so that nothing is left behind when watchfor exits.
+func (cw *CommandWatcher) Close() error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	if cw.running == nil {
+		return nil
+	}
+	return proctree.Kill(cw.running)
+}
+
 // --- File Watcher ---
 
 // FileWatcher reads new content from a file, mimicking `tail -f`.
 type FileWatcher struct {
-	filepath string
-	file     *os.File
-	offset   int64
+	filepath      string
+	file          *os.File
+	offset        int64
+	completeLines bool
+	pending       []byte
+}
+
+// FileOption configures optional FileWatcher behavior.
+type FileOption func(*FileWatcher)
+
+// WithCompleteLines holds back a trailing partial line until its newline has
+// been written, so each check only returns complete lines. This keeps
+// structured records such as JSON lines intact across writes.
+func WithCompleteLines() FileOption {
+	return func(fw *FileWatcher) {
+		fw.completeLines = true
+	}
 }
 
 // NewFileWatcher creates a new watcher for a file path.
-func NewFileWatcher(path string) (*FileWatcher, error) {
+func NewFileWatcher(path string, opts ...FileOption) (*FileWatcher, error) {
 	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -72,14 +213,20 @@ func NewFileWatcher(path string) (*FileWatcher, error) {
 		return nil, err
 	}
 
-	return &FileWatcher{
+	fw := &FileWatcher{
 		filepath: path,
 		file:     file,
 		offset:   offset,
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(fw)
+	}
+	return fw, nil
 }
 
 // Check reads any new content appended to the file since the last check.
+// After a truncation, the new content is returned along with ErrTruncated.
+// If the file has not changed size, it returns ErrNoNewData without reading it.
 func (fw *FileWatcher) Check() ([]byte, error) {
 	// Get current file info to check for truncation
 	info, err := fw.file.Stat()
@@ -89,8 +236,13 @@ func (fw *FileWatcher) Check() ([]byte, error) {
 
 	// Check for truncation: if the current offset is greater than the file size,
 	// the file has been truncated (e.g., by logrotate). Reset offset to 0.
+	var truncated error
 	if fw.offset > info.Size() {
 		fw.offset = 0
+		fw.pending = nil
+		truncated = ErrTruncated
+	} else if fw.offset == info.Size() {
+		return nil, ErrNoNewData
 	}
 
 	// Move the cursor to the last known offset.
@@ -109,7 +261,49 @@ func (fw *FileWatcher) Check() ([]byte, error) {
 	// Update the offset for the next read.
 	fw.offset += n
 
-	return buf.Bytes(), nil
+	if fw.completeLines {
+		return fw.splitCompleteLines(buf.Bytes()), truncated
+	}
+	return fw.splitCompleteRunes(buf.Bytes()), truncated
+}
+
+// Incremental reports that checks only return the content appended since the
+// previous one.
+func (fw *FileWatcher) Incremental() bool {
+	return true
+}
+
+// splitCompleteRunes returns the data, including any bytes held back from the
+// previous check, except for a trailing UTF-8 sequence that is still being
+// written, which is kept for the next one.
+func (fw *FileWatcher) splitCompleteRunes(data []byte) []byte {
+	data = append(fw.pending, data...)
+	end := len(data) - partialRune(data)
+	fw.pending = append([]byte(nil), data[end:]...)
+	return data[:end]
+}
+
+// partialRune returns the length of an incomplete UTF-8 sequence at the end of
+// data, or 0. Invalid bytes are not held back, as no write will complete them.
+func partialRune(data []byte) int {
+	for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+		if start := len(data) - i; utf8.RuneStart(data[start]) {
+			if utf8.FullRune(data[start:]) {
+				return 0
+			}
+			return i
+		}
+	}
+	return 0
+}
+
+// splitCompleteLines returns the complete lines, including any held back from
+// the previous check, and keeps the trailing partial line for the next one.
+func (fw *FileWatcher) splitCompleteLines(data []byte) []byte {
+	data = append(fw.pending, data...)
+	end := bytes.LastIndexByte(data, '\n') + 1
+	fw.pending = append([]byte(nil), data[end:]...)
+	return data[:end]
 }
 
 // Close closes the file handle.
@@ -1,10 +1,19 @@
 package watcher_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gregory-chatelier/watchfor/pkg/watcher"
 )
@@ -68,6 +77,104 @@ func TestCommandWatcher_Check_NonZeroExit(t *testing.T) {
 	}
 }
 
+func TestCommandWatcher_ExitCode(t *testing.T) {
+	cmdStr := "exit 3"
+	cw := watcher.NewCommandWatcher(cmdStr)
+
+	cw.Check()
+	if cw.ExitCode() != 3 {
+		t.Errorf("Expected exit code 3, got %d", cw.ExitCode())
+	}
+
+	cw = watcher.NewCommandWatcher("echo ok")
+	cw.Check()
+	if cw.ExitCode() != 0 {
+		t.Errorf("Expected exit code 0, got %d", cw.ExitCode())
+	}
+}
+
+func TestCommandWatcher_StdinFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on sh syntax")
+	}
+	path := filepath.Join(t.TempDir(), "query.sql")
+	if err := os.WriteFile(path, []byte("SELECT 1;\nSELECT 2;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cw := watcher.NewCommandWatcher("wc -l; echo done", watcher.WithStdinFile(path))
+
+	// Every check reads the whole file again, as it is then.
+	for i, expected := range []string{"2", "3"} {
+		if i > 0 {
+			os.WriteFile(path, []byte("SELECT 1;\nSELECT 2;\nSELECT 3;\n"), 0644)
+		}
+		output, err := cw.Check()
+		if err != nil {
+			t.Fatalf("Check %d failed: %v", i+1, err)
+		}
+		if fields := strings.Fields(string(output)); len(fields) != 2 || fields[0] != expected {
+			t.Errorf("Check %d: expected %s lines read, got %q", i+1, expected, output)
+		}
+	}
+
+	os.Remove(path)
+	if _, err := cw.Check(); !errors.Is(err, watcher.ErrCommandStartFailed) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected ErrCommandStartFailed for a missing input file, got %v", err)
+	}
+}
+
+func TestCommandWatcher_Stderr(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on sh syntax")
+	}
+	command := "echo 'WARN: READY check skipped' >&2; echo starting"
+
+	// By default, stderr is matched too.
+	output, err := watcher.NewCommandWatcher(command).Check()
+	if err != nil || !strings.Contains(string(output), "READY") {
+		t.Errorf("Expected the combined output, got %q, %v", output, err)
+	}
+
+	stderr := &lockedBuffer{}
+	for _, cw := range []watcher.Watcher{
+		watcher.NewCommandWatcher(command, watcher.WithStderr(stderr)),
+		watcher.NewMultiCommandWatcher([]string{command, "echo done >&2"}, 2, watcher.WithStderr(stderr)),
+	} {
+		stderr.Reset()
+		output, err := cw.Check()
+		if err != nil || strings.Contains(string(output), "READY") || !strings.Contains(string(output), "starting") {
+			t.Errorf("Expected stdout only, got %q, %v", output, err)
+		}
+		if !strings.Contains(stderr.String(), "WARN: READY check skipped") {
+			t.Errorf("Expected stderr to be sent to the writer, got %q", stderr.String())
+		}
+	}
+}
+
+// lockedBuffer is a buffer the commands of a MultiCommandWatcher can share.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *lockedBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
+
 // --- FileWatcher Tests ---
 
 func TestFileWatcher_Check_Append(t *testing.T) {
@@ -82,8 +189,8 @@ func TestFileWatcher_Check_Append(t *testing.T) {
 
 	// 1. Initial check should return nothing (starts at EOF)
 	output, err := fw.Check()
-	if err != nil {
-		t.Fatalf("Check failed: %v", err)
+	if !errors.Is(err, watcher.ErrNoNewData) {
+		t.Fatalf("Expected ErrNoNewData for an unchanged file, got %v", err)
 	}
 	if len(output) != 0 {
 		t.Errorf("Expected initial check to return 0 bytes, got %d: %s", len(output), string(output))
@@ -123,10 +230,10 @@ func TestFileWatcher_Check_Truncation(t *testing.T) {
 	f.Close() // File size is now 0.
 
 	// 2. Call Check() to trigger the offset reset (11 > 0 -> offset = 0)
-	// This check should return 0 bytes.
+	// This check should return 0 bytes and report the truncation.
 	output, err := fw.Check()
-	if err != nil {
-		t.Fatalf("Check failed after truncation: %v", err)
+	if !errors.Is(err, watcher.ErrTruncated) {
+		t.Fatalf("Expected ErrTruncated after truncation, got: %v", err)
 	}
 	if len(output) != 0 {
 		t.Fatalf("Expected 0 bytes after truncation, got: %s", string(output))
@@ -147,3 +254,389 @@ func TestFileWatcher_Check_Truncation(t *testing.T) {
 		t.Errorf("Expected '%s', got '%s'", expected, string(output))
 	}
 }
+
+func TestFileWatcher_NotFound(t *testing.T) {
+	_, err := watcher.NewFileWatcher(filepath.Join(t.TempDir(), "missing.log"))
+	if !errors.Is(err, watcher.ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound, got: %v", err)
+	}
+	var pathErr *os.PathError
+	if !errors.As(err, &pathErr) {
+		t.Errorf("Expected the underlying *os.PathError to be wrapped, got: %v", err)
+	}
+}
+
+func TestCommandWatcher_StartFailed(t *testing.T) {
+	// Without a PATH, the shell itself cannot be found.
+	t.Setenv("PATH", "")
+	_, err := watcher.NewCommandWatcher("echo hello").Check()
+	if !errors.Is(err, watcher.ErrCommandStartFailed) {
+		t.Errorf("Expected ErrCommandStartFailed, got: %v", err)
+	}
+	if !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("Expected the underlying exec.ErrNotFound to be wrapped, got: %v", err)
+	}
+}
+
+func TestMultiCommandWatcher_Check(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on sh syntax")
+	}
+
+	mw := watcher.NewMultiCommandWatcher([]string{
+		"echo db=ready",
+		"printf cache=warming; exit 1",
+		"echo api=ready",
+	}, 2)
+
+	output, err := mw.Check()
+	expected := "db=ready\ncache=warming\napi=ready\n"
+	if string(output) != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, string(output))
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || !strings.Contains(err.Error(), "printf cache=warming; exit 1") {
+		t.Errorf("Expected the failing command to be reported, got: %v", err)
+	}
+}
+
+func TestMultiCommandWatcher_Parallel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on sh syntax")
+	}
+
+	// Each command fails if another one is running at the same time.
+	lock := filepath.Join(t.TempDir(), "lock")
+	cmd := "mkdir " + lock + " && sleep 0.05 && rmdir " + lock
+	mw := watcher.NewMultiCommandWatcher([]string{cmd, cmd, cmd}, 1)
+
+	if _, err := mw.Check(); err != nil {
+		t.Errorf("Expected the commands to run one at a time, got: %v", err)
+	}
+}
+
+func TestMultiCommandWatcher_Shuffle(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on sh syntax")
+	}
+
+	// Each command records when it starts.
+	started := filepath.Join(t.TempDir(), "started")
+	var commands []string
+	for _, name := range []string{"a", "b", "c"} {
+		commands = append(commands, "printf "+name+" >> "+started+"; echo "+name)
+	}
+	mw := watcher.NewMultiCommandWatcher(commands, 1)
+
+	reverse := func(n int, swap func(i, j int)) {
+		for i := range n / 2 {
+			swap(i, n-1-i)
+		}
+	}
+	for _, expected := range []string{"abc", "cba"} {
+		os.Remove(started)
+		output, err := mw.Check()
+		if err != nil || string(output) != "a\nb\nc\n" {
+			t.Errorf("Expected the outputs in the given order, got %q, %v", output, err)
+		}
+		if got, _ := os.ReadFile(started); string(got) != expected {
+			t.Errorf("Expected the commands to start in the order %s, got %s", expected, got)
+		}
+		mw.Shuffle(reverse)
+	}
+}
+
+// --- DirWatcher Tests ---
+
+// checkUntil checks the watcher until it returns some output, as fsnotify
+// events are delivered asynchronously.
+func checkUntil(t *testing.T, w watcher.Watcher) (string, error) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		output, err := w.Check()
+		if len(output) > 0 || time.Now().After(deadline) {
+			return string(output), err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDirWatcher_Check(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "old.tar.gz"), nil, 0644)
+
+	dw, err := watcher.NewDirWatcher(dir, "*.tar.gz")
+	if err != nil {
+		t.Fatalf("NewDirWatcher failed: %v", err)
+	}
+	defer dw.Close()
+
+	if output, _ := dw.Check(); len(output) != 0 {
+		t.Errorf("Expected existing files to be ignored, got '%s'", string(output))
+	}
+
+	os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0644)
+	os.WriteFile(filepath.Join(dir, "app-1.2.tar.gz"), nil, 0644)
+	output, err := checkUntil(t, dw)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if output != "app-1.2.tar.gz\n" {
+		t.Errorf("Expected only the new matching file, got '%s'", output)
+	}
+
+	os.WriteFile(filepath.Join(dir, "app-1.2.tar.gz"), []byte("rewritten"), 0644)
+	time.Sleep(50 * time.Millisecond)
+	if output, _ := dw.Check(); len(output) != 0 {
+		t.Errorf("Expected a file to be reported only once, got '%s'", string(output))
+	}
+}
+
+func TestDirWatcher_MissingDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dist")
+	dw, err := watcher.NewDirWatcher(dir, "*.tar.gz")
+	if err != nil {
+		t.Fatalf("NewDirWatcher failed: %v", err)
+	}
+	defer dw.Close()
+
+	if _, err := dw.Check(); !errors.Is(err, watcher.ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound for a missing directory, got: %v", err)
+	}
+
+	os.Mkdir(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "app.tar.gz"), nil, 0644)
+	output, err := checkUntil(t, dw)
+	if err != nil || output != "app.tar.gz\n" {
+		t.Errorf("Expected the file in the new directory, got '%s' (err: %v)", output, err)
+	}
+}
+
+func TestDirWatcher_InvalidGlob(t *testing.T) {
+	if _, err := watcher.NewDirWatcher(t.TempDir(), "[*.tar.gz"); err == nil {
+		t.Error("Expected an error for an invalid glob, got nil")
+	}
+}
+
+// --- Trigger Tests ---
+
+func TestTrigger_FiresOnWrite(t *testing.T) {
+	filePath := createTempFile(t, "")
+	defer os.Remove(filePath)
+
+	trigger, err := watcher.NewTrigger(filePath)
+	if err != nil {
+		t.Fatalf("NewTrigger failed: %v", err)
+	}
+	defer trigger.Close()
+
+	if err := os.WriteFile(filePath, []byte("changed\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	select {
+	case <-trigger.C():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the trigger to fire after the file was written")
+	}
+}
+
+// --- TLSCertWatcher Tests ---
+
+func TestTLSCertWatcher_Check(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "https://")
+
+	tw := watcher.NewTLSCertWatcher(addr, 0)
+	output, err := tw.Check()
+	if err != nil {
+		t.Fatalf("TLSCertWatcher failed with error: %v", err)
+	}
+
+	// The test server's certificate is self-signed, so it cannot be verified.
+	for _, expected := range []string{"subject: O=Acme Co", "serial: ", "daysLeft: ", "verified: false"} {
+		if !strings.Contains(string(output), expected) {
+			t.Errorf("Expected output to contain '%s', got: %s", expected, string(output))
+		}
+	}
+}
+
+func TestTLSCertWatcher_Check_MinDaysLeft(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "https://")
+
+	// No certificate is valid for a million days.
+	tw := watcher.NewTLSCertWatcher(addr, 1000000)
+	output, err := tw.Check()
+	if err == nil {
+		t.Fatal("Expected an error for a certificate expiring too soon, got nil")
+	}
+	if len(output) != 0 {
+		t.Errorf("Expected no output for a certificate expiring too soon, got: %s", string(output))
+	}
+}
+
+func TestTLSCertWatcher_Check_ConnectionRefused(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	addr := strings.TrimPrefix(server.URL, "https://")
+	server.Close()
+
+	if _, err := watcher.NewTLSCertWatcher(addr, 0).Check(); err == nil {
+		t.Error("Expected an error for a closed endpoint, got nil")
+	}
+}
+
+func TestFileWatcher_Check_CompleteLines(t *testing.T) {
+	filePath := createTempFile(t, "")
+	defer os.Remove(filePath)
+
+	fw, err := watcher.NewFileWatcher(filePath, watcher.WithCompleteLines())
+	if err != nil {
+		t.Fatalf("NewFileWatcher failed: %v", err)
+	}
+	defer fw.Close()
+
+	appendAndCheck := func(fragment, expected string) {
+		t.Helper()
+		f, _ := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0644)
+		f.WriteString(fragment)
+		f.Close()
+
+		output, err := fw.Check()
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		if string(output) != expected {
+			t.Errorf("After appending %q, expected '%s', got '%s'", fragment, expected, string(output))
+		}
+	}
+
+	// A JSON record written in fragments is only returned once complete.
+	appendAndCheck(`{"level":"info",`, "")
+	appendAndCheck(`"msg":"starting"}`, "")
+	appendAndCheck("\n{\"msg\":", `{"level":"info","msg":"starting"}`+"\n")
+	appendAndCheck("\"ready\"}\n{\"msg\":\"done\"}\n", `{"msg":"ready"}`+"\n"+`{"msg":"done"}`+"\n")
+}
+
+func TestFileWatcher_Check_PartialRune(t *testing.T) {
+	filePath := createTempFile(t, "")
+	defer os.Remove(filePath)
+
+	fw, err := watcher.NewFileWatcher(filePath)
+	if err != nil {
+		t.Fatalf("NewFileWatcher failed: %v", err)
+	}
+	defer fw.Close()
+
+	appendAndCheck := func(fragment, expected string) {
+		t.Helper()
+		f, _ := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0644)
+		f.WriteString(fragment)
+		f.Close()
+
+		output, err := fw.Check()
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		if string(output) != expected {
+			t.Errorf("After appending %q, expected %q, got %q", fragment, expected, output)
+		}
+	}
+
+	// "é" is C3 A9, split across two writes.
+	appendAndCheck("caf\xc3", "caf")
+	appendAndCheck("\xa9 prêt\n", "é prêt\n")
+	// "🚀" is F0 9F 9A 80, written a byte or two at a time.
+	appendAndCheck("go \xf0", "go ")
+	appendAndCheck("\x9f\x9a", "")
+	appendAndCheck("\x80!", "🚀!")
+	// Invalid bytes are returned as-is rather than held back forever.
+	appendAndCheck("bad \xff", "bad \xff")
+}
+
+func TestCommandWatcher_CheckContext_KillsProcessTree(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	cw := watcher.NewCommandWatcher("echo started; (sleep 10; echo late) & wait")
+	start := time.Now()
+	output, err := cw.CheckContext(ctx)
+	if err == nil {
+		t.Fatal("Expected an error from the cancelled command")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the check to stop promptly, took %s", elapsed)
+	}
+	if string(output) != "started\n" {
+		t.Errorf("Expected the output written before the cancellation, got %q", output)
+	}
+}
+
+func TestCommandWatcher_Close_KillsRunningCheck(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	cw := watcher.NewCommandWatcher("sleep 10 & wait")
+	done := make(chan error, 1)
+	go func() {
+		_, err := cw.Check()
+		done <- err
+	}()
+
+	// Give the command time to start, then close the watcher.
+	time.Sleep(100 * time.Millisecond)
+	if err := cw.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Expected an error from the killed command")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected Close to kill the running check")
+	}
+}
+
+func TestCommandWatcher_MultiLineScript(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	script := `status=starting
+if [ -n "$HOME" ]; then
+	status=READY
+fi
+echo "service is $status"`
+
+	cw := watcher.NewCommandWatcher(script)
+	output, err := cw.Check()
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if string(output) != "service is READY\n" {
+		t.Errorf("Expected the whole script to run, got %q", output)
+	}
+}
+
+func BenchmarkFileWatcher_Check_Idle(b *testing.B) {
+	dir := b.TempDir()
+	filePath := filepath.Join(dir, "idle.log")
+	if err := os.WriteFile(filePath, bytes.Repeat([]byte("log line\n"), 1000), 0644); err != nil {
+		b.Fatal(err)
+	}
+	fw, err := watcher.NewFileWatcher(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer fw.Close()
+
+	for b.Loop() {
+		fw.Check()
+	}
+}
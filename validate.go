@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/gregory-chatelier/watchfor/pkg/envfile"
+	"github.com/gregory-chatelier/watchfor/pkg/matcher"
+	"github.com/gregory-chatelier/watchfor/pkg/watcher"
+)
+
+// preflight is the result of one check made by --validate.
+type preflight struct {
+	name string
+	err  error
+}
+
+// validate checks that the environment is ready for the configured wait, prints a
+// report, and returns the exit code: 0 if every check passed, 1 otherwise.
+func validate(extraPatterns []string, successCommand string) int {
+	var checks []preflight
+	add := func(name string, err error) {
+		checks = append(checks, preflight{name, err})
+	}
+
+	shell, err := exec.LookPath(shellName())
+	add("shell "+shellName(), err)
+
+	switch {
+	case len(*commands) > 0:
+		for _, cmd := range *commands {
+			add(fmt.Sprintf("command %q", cmd), checkCommand(shell, cmd))
+		}
+		if *commandInput != "" {
+			add(fmt.Sprintf("command input %q", *commandInput), checkReadable(*commandInput))
+		}
+	case *file != "":
+		add(fmt.Sprintf("file %q", *file), checkReadable(*file))
+	case *fifo != "":
+		add(fmt.Sprintf("named pipe %q", *fifo), checkFIFO(*fifo))
+	case *watchDir != "":
+		add(fmt.Sprintf("directory %q", *watchDir), checkDir(*watchDir))
+		_, err := filepath.Match(*glob, "")
+		add(fmt.Sprintf("glob %q", *glob), err)
+	case *source != "":
+		w, err := watcher.FromSpec(*source)
+		if c, ok := w.(io.Closer); ok {
+			c.Close()
+		}
+		add(fmt.Sprintf("source %q", *source), err)
+	case *waitsFile != "":
+		specs, err := loadWaits(*waitsFile)
+		add(fmt.Sprintf("waits file %q", *waitsFile), err)
+		for _, s := range specs {
+			w, err := watcher.FromSpec(s.Source)
+			if c, ok := w.(io.Closer); ok {
+				c.Close()
+			}
+			if err == nil && s.Regex {
+				_, err = regexp.Compile(s.Pattern)
+			}
+			add(fmt.Sprintf("wait %q", s.Name), err)
+		}
+	case *pid != 0:
+		_, err := watcher.NewProcessWatcher(*pid, 0, 0)
+		add(fmt.Sprintf("process %d", *pid), err)
+	case *unit != "":
+		_, err := exec.LookPath("journalctl")
+		add("journalctl", err)
+	case *tlsCert != "":
+		_, _, err := net.SplitHostPort(*tlsCert)
+		add(fmt.Sprintf("address %q", *tlsCert), err)
+	case *redisAddr != "":
+		w, err := watcher.NewRedisWatcher(*redisAddr, *redisKey)
+		if err == nil {
+			err = w.Ping()
+			w.Close()
+		}
+		add(fmt.Sprintf("redis %q", *redisAddr), err)
+	case *listenAddr != "":
+		l, err := net.Listen("tcp", *listenAddr)
+		if err == nil {
+			l.Close()
+		}
+		add(fmt.Sprintf("listen address %q", *listenAddr), err)
+	case *waitUnlock != "":
+		// The file itself may not exist yet.
+		add(fmt.Sprintf("lock file directory %q", filepath.Dir(*waitUnlock)), checkDir(filepath.Dir(*waitUnlock)))
+	case *mqttBroker != "":
+		w, err := watcher.NewMQTTWatcher(*mqttBroker, *mqttTopic, mqttOptions()...)
+		if err == nil {
+			err = w.Ping()
+			w.Close()
+		}
+		add(fmt.Sprintf("mqtt %q", *mqttBroker), err)
+	}
+
+	patterns := extraPatterns
+	if *pattern != "" {
+		patterns = append([]string{*pattern}, extraPatterns...)
+	}
+	if *regex {
+		for _, p := range patterns {
+			_, err := regexp.Compile(p)
+			add(fmt.Sprintf("regex %q", p), err)
+		}
+	}
+	if *xpathExpr != "" {
+		_, err := matcher.NewXPathMatcher(*xpathExpr, *xpathEquals)
+		add(fmt.Sprintf("xpath %q", *xpathExpr), err)
+	}
+	if *jsonSchema != "" {
+		_, err := matcher.NewJSONSchemaMatcher(*jsonSchema)
+		add(fmt.Sprintf("json schema %q", *jsonSchema), err)
+	}
+	if *equalsEnv != "" {
+		var err error
+		if !envDefined(*equalsEnv) {
+			err = errors.New("not set")
+		}
+		add(fmt.Sprintf("environment variable %s", *equalsEnv), err)
+	}
+	if *progressRe != "" {
+		_, err := regexp.Compile(*progressRe)
+		add(fmt.Sprintf("progress regex %q", *progressRe), err)
+	}
+
+	hooks := []struct{ name, command string }{
+		{"setup", *setupCommand},
+		{"transform", *transformCmd},
+		{"probe", *probeCommand},
+		{"on-match", *onMatch},
+		{"success command", successCommand},
+		{"escalation command", *failEscalate},
+	}
+	for _, cmd := range *failCommands {
+		hooks = append(hooks, struct{ name, command string }{"fail command", cmd})
+	}
+	for _, hook := range hooks {
+		if strings.TrimSpace(hook.command) != "" {
+			add(fmt.Sprintf("%s %q", hook.name, hook.command), checkCommand(shell, hook.command))
+		}
+	}
+
+	if *envFile != "" {
+		_, err := envfile.Load(*envFile)
+		add(fmt.Sprintf("env file %q", *envFile), err)
+	}
+	if *lockFile != "" {
+		add(fmt.Sprintf("lock file directory %q", filepath.Dir(*lockFile)), checkDir(filepath.Dir(*lockFile)))
+	}
+
+	fmt.Println("Preflight checks:")
+	failed := 0
+	for _, c := range checks {
+		if c.err != nil {
+			failed++
+			fmt.Printf("  FAIL  %s: %v\n", c.name, c.err)
+		} else {
+			fmt.Printf("  ok    %s\n", c.name)
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("%d of %d checks failed.\n", failed, len(checks))
+		return 1
+	}
+	fmt.Println("All checks passed.")
+	return 0
+}
+
+// shellName returns the shell commands are run through.
+func shellName() string {
+	if runtime.GOOS == "windows" {
+		return "powershell"
+	}
+	return "sh"
+}
+
+// simpleName matches a command name that can be looked up on its own, as opposed
+// to an assignment, a redirection or a subshell.
+var simpleName = regexp.MustCompile(`^[\w./-]+$`)
+
+// checkCommand checks that the program a command starts with can be found, either
+// as a shell builtin or on the PATH. Commands that do not start with a plain name
+// are assumed to be fine.
+func checkCommand(shell, command string) error {
+	fields := strings.Fields(command)
+	if len(fields) == 0 || !simpleName.MatchString(fields[0]) {
+		return nil
+	}
+	name := fields[0]
+	if shell == "" {
+		_, err := exec.LookPath(name)
+		return err
+	}
+	lookup := exec.Command(shell, "-c", `command -v "$1" >/dev/null`, "sh", name)
+	if runtime.GOOS == "windows" {
+		// The name cannot contain quotes, see simpleName.
+		lookup = exec.Command(shell, "-Command", "Get-Command -ErrorAction Stop '"+name+"' | Out-Null")
+	}
+	if lookup.Run() != nil {
+		return fmt.Errorf("%s: command not found", name)
+	}
+	return nil
+}
+
+func checkReadable(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func checkFIFO(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeNamedPipe == 0 {
+		return errors.New("not a named pipe")
+	}
+	return nil
+}
+
+func checkDir(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New("not a directory")
+	}
+	return nil
+}
+
+// envDefined reports whether name is set in the environment, or will be by
+// --env or --env-file.
+func envDefined(name string) bool {
+	if _, ok := os.LookupEnv(name); ok {
+		return true
+	}
+	env := *envVars
+	if *envFile != "" {
+		loaded, _ := envfile.Load(*envFile)
+		env = append(loaded, env...)
+	}
+	for _, kv := range env {
+		if key, _, _ := strings.Cut(kv, "="); key == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gregory-chatelier/watchfor/pkg/executor"
+	"github.com/gregory-chatelier/watchfor/pkg/poller"
+	"github.com/gregory-chatelier/watchfor/pkg/watcher"
+)
+
+// waitSpec is one of the waits listed in a --waits file.
+type waitSpec struct {
+	Name       string `json:"name"`
+	Source     string `json:"source"`
+	Pattern    string `json:"pattern"`
+	Regex      bool   `json:"regex"`
+	IgnoreCase bool   `json:"ignore_case"`
+}
+
+// loadWaits reads a --waits file: a JSON array of waits, each with a source
+// spec, as for --source, and a pattern. Names default to the source.
+func loadWaits(path string) ([]waitSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var specs []waitSpec
+	if err := dec.Decode(&specs); err != nil {
+		return nil, err
+	}
+	if len(specs) == 0 {
+		return nil, errors.New("no waits listed")
+	}
+	names := make(map[string]bool)
+	for i := range specs {
+		s := &specs[i]
+		if s.Source == "" || s.Pattern == "" {
+			return nil, fmt.Errorf("wait %d: source and pattern are required", i+1)
+		}
+		if s.Name == "" {
+			s.Name = s.Source
+		}
+		if names[s.Name] {
+			return nil, fmt.Errorf("wait %d: name %q is used twice", i+1, s.Name)
+		}
+		names[s.Name] = true
+	}
+	return specs, nil
+}
+
+// runWaits runs the waits of the --waits file together, then the success or
+// fail commands as for a single wait, and returns the exit code.
+func runWaits(successCommand string) int {
+	specs, err := loadWaits(*waitsFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --waits: %v\n", err)
+		return 1
+	}
+
+	var out sync.Mutex
+	var waits []poller.Wait
+	for _, s := range specs {
+		w, err := watcher.FromSpec(s.Source)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --waits: %s: %v\n", s.Name, err)
+			return 1
+		}
+		if c, ok := w.(io.Closer); ok {
+			defer c.Close()
+			onExit(func() { c.Close() })
+		}
+		opts := []poller.Option{poller.WithOutput(&prefixWriter{prefix: "[" + s.Name + "] ", mu: &out, w: os.Stdout})}
+		if *backoffMode == "anchored" {
+			opts = append(opts, poller.WithAnchoredBackoff())
+		}
+		if *maxDelay > 0 {
+			opts = append(opts, poller.WithMaxDelay(*maxDelay))
+		}
+		waits = append(waits, poller.Wait{Name: s.Name, Poller: poller.New(w, s.Pattern, *verbose, s.Regex, s.IgnoreCase, opts...)})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if *timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), *timeout)
+	}
+	defer cancel()
+
+	success, results := poller.RunAll(ctx, waits, *maxParallel, *anyWait, *interval, *maxRetries, *backoff, *jitter)
+
+	fmt.Println("\nWaits:")
+	for _, r := range results {
+		switch {
+		case r.Success:
+			fmt.Printf("  ok    %s (%s)\n", r.Name, r.Elapsed.Round(time.Millisecond))
+		case r.Reason != "":
+			fmt.Printf("  FAIL  %s: %s (%s)\n", r.Name, r.Reason, r.Elapsed.Round(time.Millisecond))
+		default:
+			fmt.Printf("  -     %s: stopped, the result was known\n", r.Name)
+		}
+	}
+	announceCompletion(success)
+
+	if *noExec {
+		if success {
+			printBanner("success", "Success.")
+			return 0
+		}
+		printBanner("fail", "Failure.")
+		return 1
+	}
+	if success {
+		printBanner("success", "Success: Executing success command.")
+		runner := &executor.Runner{SuccessCodes: *successCodes, Repeat: *repeatSuccess}
+		if err := runner.Execute(successCommand); err != nil {
+			fmt.Fprintf(os.Stderr, "Error executing success command: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	printBanner("fail", "Failure: Executing fail command.")
+	runner := &executor.Runner{SuccessCodes: *failCodes}
+	if err := runner.ExecuteAll(*failCommands); err != nil {
+		fmt.Fprintf(os.Stderr, "Error executing fail commands:\n%v\n", err)
+	}
+	return 1
+}
+
+// prefixWriter writes complete lines to w with prefix before each, holding back
+// a partial line until it is complete. Writers sharing mu keep their lines
+// whole when they write concurrently.
+type prefixWriter struct {
+	prefix  string
+	mu      *sync.Mutex
+	w       io.Writer
+	pending []byte
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	pw.pending = append(pw.pending, p...)
+	for {
+		i := bytes.IndexByte(pw.pending, '\n')
+		if i < 0 {
+			break
+		}
+		line := pw.pending[:i+1]
+		if len(bytes.TrimSpace(line)) > 0 {
+			if _, err := io.WriteString(pw.w, pw.prefix+string(line)); err != nil {
+				return len(p), err
+			}
+		}
+		pw.pending = pw.pending[i+1:]
+	}
+	return len(p), nil
+}
+
+// describeWaits summarizes a --waits file for --explain.
+func describeWaits() string {
+	specs, err := loadWaits(*waitsFile)
+	if err != nil {
+		return fmt.Sprintf("waits in %s (invalid: %v)", *waitsFile, err)
+	}
+	names := make([]string, len(specs))
+	for i, s := range specs {
+		names[i] = s.Name
+	}
+	mode := "all of"
+	if *anyWait {
+		mode = "any of"
+	}
+	return fmt.Sprintf("%s %s, from %s, %d at a time", mode, strings.Join(names, ", "), *waitsFile, min(*maxParallel, len(specs)))
+}